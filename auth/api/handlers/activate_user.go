@@ -6,6 +6,7 @@ import (
 
 	"github.com/todo-app/api/helpers"
 	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
 	"github.com/todo-app/internal/domain"
 	"github.com/todo-app/internal/repositories"
 	"github.com/todo-app/internal/validator"
@@ -33,10 +34,10 @@ TokenRepository.DeleteAllForUser() method that we made earlier.
 */
 func ActivateUser(app *application.App) http.HandlerFunc {
 
-	return activateUser(app.UserRepository, app.TokenRepository)
+	return activateUser(app.UserRepository, app.TokenRepository, app.AuditLog)
 }
 
-func activateUser(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface) http.HandlerFunc {
+func activateUser(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// parse the plaintext activation token from the request
 		var input struct {
@@ -69,8 +70,13 @@ func activateUser(userRepo repositories.UserRepositoryInterface, tokenRepo repos
 			return
 		}
 
-		// Update the user's activation status
-		user.Activated = true
+		// Activate the account. Only pending accounts can be activated, an account
+		// that was suspended before it was activated stays suspended.
+		if err := user.SetStatus(domain.StatusActive, "activated by the user"); err != nil {
+			v.AddError("token", "invalid or expired activation token")
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
 
 		// Save the updated record in the database, checking for any edit conflicts
 		err = userRepo.Update(user)
@@ -92,6 +98,8 @@ func activateUser(userRepo repositories.UserRepositoryInterface, tokenRepo repos
 			return
 		}
 
+		auditLog.Record(userAuditEvent(r, domain.AuditUserActivated, user))
+
 		err = helpers.SendJSON(w, http.StatusOK, user.ToHTTPResponse(), nil)
 		if err != nil {
 			helpers.ServerErrReponse(w, r, err)
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+func ListAuditEvents(app *application.App) http.HandlerFunc {
+	return listAuditEvents(app.AuditRepository)
+}
+
+// listAuditEvents searches the audit log, newest events first. The query string
+// can filter the events with actor_id, target_id, user_id (events by or about
+// the user), action, and since and until (RFC 3339 times), and page through them
+// with limit and the cursor returned as next_cursor by the previous page.
+func listAuditEvents(auditRepo repositories.AuditRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+		v := validator.New()
+
+		filter := repositories.AuditFilter{
+			ActorID:  strings.TrimSpace(qs.Get("actor_id")),
+			TargetID: strings.TrimSpace(qs.Get("target_id")),
+			UserID:   strings.TrimSpace(qs.Get("user_id")),
+			Action:   strings.TrimSpace(qs.Get("action")),
+			Since:    helpers.ReadQueryTime(qs, "since", v),
+			Until:    helpers.ReadQueryTime(qs, "until", v),
+		}
+		readAuditPage(r, v, &filter)
+
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		sendAuditEvents(w, r, auditRepo, filter)
+	}
+}
+
+// readAuditPage reads the limit and cursor of the page of audit events to
+// return from the query string.
+func readAuditPage(r *http.Request, v *validator.Validator, filter *repositories.AuditFilter) {
+	filter.Limit, filter.After = readPage(r, v)
+}
+
+// readPage reads the limit and cursor of a page of events, such as audit events
+// or sign ins, from the query string.
+func readPage(r *http.Request, v *validator.Validator) (int, *repositories.Cursor) {
+	qs := r.URL.Query()
+
+	limit := helpers.ReadQueryInt(qs, "limit", defaultAuditPageSize, v)
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= maxAuditPageSize, "limit", "must be a maximum of 200")
+
+	var after *repositories.Cursor
+	if cursor := qs.Get("cursor"); cursor != "" {
+		var err error
+		after, err = repositories.DecodeCursor(cursor)
+		if err != nil {
+			v.AddError("cursor", err.Error())
+		}
+	}
+	return limit, after
+}
+
+// sendAuditEvents responds with the page of audit events matching the filter.
+func sendAuditEvents(w http.ResponseWriter, r *http.Request, auditRepo repositories.AuditRepositoryInterface, filter repositories.AuditFilter) {
+	events, next, err := auditRepo.List(filter)
+	if err != nil {
+		switch {
+		case err == repositories.ErrInvalidCursor:
+			v := validator.New()
+			v.AddError("cursor", err.Error())
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrReponse(w, r, err)
+		}
+		return
+	}
+
+	metadata := map[string]interface{}{}
+	if next != nil {
+		metadata["next_cursor"] = next.Encode()
+	}
+
+	response := map[string]interface{}{
+		"events":   events,
+		"metadata": metadata,
+	}
+	err = helpers.SendJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		helpers.ServerErrReponse(w, r, err)
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+/** Workflow for impersonating a user:
+
+1. Someone with the users:impersonate permission sends POST /v1/admin/users/{id}/impersonate
+   with the reason they need to see the app as that user.
+
+2. The session is recorded, and their cookie is replaced with a short lived token for the user
+   whose "act" claim identifies them. The token carries none of the user's admin permissions,
+   and routes guarded by middleware.DenyImpersonation refuse it.
+
+3. POST /v1/impersonation/stop records the end of the session and signs them back in as
+   themselves. Sessions that are never stopped end when their token expires.
+
+*/
+
+func ImpersonateUser(app *application.App) http.HandlerFunc {
+	return impersonateUser(app.UserRepository, app.RoleRepository, app.OrganizationRepository, app.ImpersonationRepository, app.AuditLog, app.Confg.Impersonation.TTL)
+}
+
+func impersonateUser(userRepo repositories.UserRepositoryInterface, roleRepo repositories.RoleRepositoryInterface, orgRepo repositories.OrganizationRepositoryInterface, impRepo repositories.ImpersonationRepositoryInterface, auditLog *audit.Log, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		var input struct {
+			Reason string `json:"reason"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+		input.Reason = strings.TrimSpace(input.Reason)
+
+		v := validator.New()
+		v.Check(input.Reason != "", "reason", "must be provided")
+		v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 characters long")
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		target, ok := readUser(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		v.Check(target.ID != claims.UserId, "id", "you can't impersonate yourself")
+		v.Check(target.IsActive(), "id", "the user's account isn't active")
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		session := &domain.ImpersonationSession{
+			ActorID:     claims.UserId.String(),
+			ActorEmail:  claims.Email,
+			TargetID:    target.ID.String(),
+			TargetEmail: target.Email,
+			Reason:      input.Reason,
+			IP:          helpers.ClientIP(r),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+		err = impRepo.Start(session)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = loadSession(target, roleRepo, orgRepo, "")
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+		// Never hand the user's admin permissions to whoever is impersonating them
+		target.Roles, target.Permissions = nil, nil
+
+		actor := identity.ActorClaim{UserId: claims.UserId, Email: claims.Email, SessionID: session.ID}
+		err = identity.SetImpersonationCookie(w, r, target, actor, ttl)
+		if err != nil {
+			impRepo.End(session.ID)
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		auditLog.Record(auditEvent(r, domain.AuditImpersonationStarted).
+			SetTarget(target).
+			With("session_id", session.ID).
+			With("reason", session.Reason).
+			With("expires_at", session.ExpiresAt))
+
+		response := map[string]interface{}{
+			"session": session,
+			"user":    target.ToHTTPResponse(),
+		}
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func StopImpersonation(app *application.App) http.HandlerFunc {
+	return stopImpersonation(app.ImpersonationRepository, app.AuditLog)
+}
+
+// stopImpersonation isn't behind AuthenticationMiddleware, so that it can still
+// be used once the impersonation token has expired.
+func stopImpersonation(impRepo repositories.ImpersonationRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, err := identity.StopImpersonation(w, r)
+		if err != nil {
+			switch {
+			case errors.Is(err, identity.ErrNotImpersonating):
+				helpers.BadRequestErrResponseWithMsg(w, r, err)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		err = impRepo.End(sessionID)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		session, err := impRepo.Get(sessionID)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		// The request isn't authenticated, so take the actor from the session
+		event := auditEvent(r, domain.AuditImpersonationStopped).With("session_id", session.ID)
+		event.ActorID, event.ActorEmail = session.ActorID, session.ActorEmail
+		event.TargetType, event.TargetID = domain.AuditTargetUser, session.TargetID
+		auditLog.Record(event)
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "you are no longer impersonating a user",
+		}
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func ListImpersonations(app *application.App) http.HandlerFunc {
+	return listImpersonations(app.ImpersonationRepository)
+}
+
+// listImpersonations returns the latest impersonation sessions, up to the limit
+// in the query string.
+func listImpersonations(impRepo repositories.ImpersonationRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+		limit := helpers.ReadQueryInt(r.URL.Query(), "limit", 50, v)
+		v.Check(limit > 0, "limit", "must be greater than zero")
+		v.Check(limit <= 500, "limit", "must be a maximum of 500")
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		sessions, err := impRepo.GetRecent(limit)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, sessions, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+// The admin API for managing roles, permissions and which users have which roles.
+// Tokens carry a snapshot of the user's permissions, so any change to a user's
+// roles, or to the permissions of a role, revokes the sessions of the users
+// affected and applies straight away.
+
+// builtInRoles are created by the migrations and relied on elsewhere, so they
+// can't be renamed or deleted.
+var builtInRoles = []string{domain.RoleAdmin, domain.RoleSupport, domain.RoleUser}
+
+// ----------------------- Roles ----------------------- //
+
+func ListRoles(app *application.App) http.HandlerFunc {
+	return listRoles(app.RoleRepository)
+}
+
+func listRoles(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles, err := roleRepo.GetAll()
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, roles, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func GetRole(app *application.App) http.HandlerFunc {
+	return getRole(app.RoleRepository)
+}
+
+func getRole(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		role, err := roleRepo.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, role, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func CreateRole(app *application.App) http.HandlerFunc {
+	return createRole(app.RoleRepository)
+}
+
+func createRole(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Name        string   `json:"name"`
+			Description string   `json:"description"`
+			Permissions []string `json:"permissions"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		role := &domain.Role{
+			Name:        strings.TrimSpace(input.Name),
+			Description: strings.TrimSpace(input.Description),
+		}
+
+		v := validator.New()
+		if domain.ValidateRole(v, role); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = roleRepo.Insert(role)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrDuplicateRole):
+				v.AddError("name", err.Error())
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		if len(input.Permissions) > 0 {
+			if !setPermissions(w, r, roleRepo, role.ID, input.Permissions) {
+				// Don't leave a half created role behind
+				roleRepo.Delete(role.ID)
+				return
+			}
+			role.Permissions = input.Permissions
+		}
+
+		err = helpers.SendJSON(w, http.StatusCreated, role, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func UpdateRole(app *application.App) http.HandlerFunc {
+	return updateRole(app.RoleRepository)
+}
+
+func updateRole(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		// Pointers tell apart fields left out of the request from empty ones
+		var input struct {
+			Name        *string `json:"name"`
+			Description *string `json:"description"`
+		}
+
+		err = helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		role, err := roleRepo.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		v := validator.New()
+		if input.Name != nil {
+			name := strings.TrimSpace(*input.Name)
+			v.Check(name == role.Name || !v.In(role.Name, builtInRoles...), "name", "built in roles can't be renamed")
+			role.Name = name
+		}
+		if input.Description != nil {
+			role.Description = strings.TrimSpace(*input.Description)
+		}
+
+		if domain.ValidateRole(v, role); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = roleRepo.Update(role)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrDuplicateRole):
+				v.AddError("name", err.Error())
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, role, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func DeleteRole(app *application.App) http.HandlerFunc {
+	return deleteRole(app.RoleRepository)
+}
+
+func deleteRole(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		role, err := roleRepo.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		v := validator.New()
+		v.Check(!v.In(role.Name, builtInRoles...), "role", "built in roles can't be deleted")
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = roleRepo.Delete(role.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func SetRolePermissions(app *application.App) http.HandlerFunc {
+	return setRolePermissions(app.RoleRepository)
+}
+
+// setRolePermissions replaces every permission of a role with the ones given.
+func setRolePermissions(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		var input struct {
+			Permissions []string `json:"permissions"`
+		}
+
+		err = helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		if !setPermissions(w, r, roleRepo, id, input.Permissions) {
+			return
+		}
+
+		role, err := roleRepo.Get(id)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, role, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+// setPermissions sets the permissions of a role, writing an error response and
+// returning false if that fails.
+func setPermissions(w http.ResponseWriter, r *http.Request, roleRepo repositories.RoleRepositoryInterface, roleId int64, permissions []string) bool {
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	err := roleRepo.SetPermissions(roleId, permissions)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrUnknownPermission):
+			helpers.FailedValidationResponse(w, r, map[string]string{"permissions": err.Error()})
+		case errors.Is(err, repositories.ErrRecordNotFound):
+			helpers.NotFoundErrResponse(w, r)
+		default:
+			helpers.ServerErrReponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
+
+// ----------------------- Permissions ----------------------- //
+
+func ListPermissions(app *application.App) http.HandlerFunc {
+	return listPermissions(app.RoleRepository)
+}
+
+func listPermissions(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permissions, err := roleRepo.GetAllPermissions()
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, permissions, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func CreatePermission(app *application.App) http.HandlerFunc {
+	return createPermission(app.RoleRepository)
+}
+
+func createPermission(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		permission := &domain.Permission{
+			Name:        strings.TrimSpace(input.Name),
+			Description: strings.TrimSpace(input.Description),
+		}
+
+		v := validator.New()
+		if domain.ValidatePermission(v, permission); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = roleRepo.InsertPermission(permission)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrDuplicatePermission):
+				v.AddError("name", err.Error())
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusCreated, permission, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func DeletePermission(app *application.App) http.HandlerFunc {
+	return deletePermission(app.RoleRepository)
+}
+
+func deletePermission(roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		err = roleRepo.DeletePermission(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ----------------------- User roles ----------------------- //
+
+func ListUserRoles(app *application.App) http.HandlerFunc {
+	return listUserRoles(app.UserRepository, app.RoleRepository)
+}
+
+func listUserRoles(userRepo repositories.UserRepositoryInterface, roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := helpers.ReadUUIDParam(r, "userId")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		user, err := userRepo.GetById(userId.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		roles, err := roleRepo.GetForUser(user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, roles, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func AssignUserRole(app *application.App) http.HandlerFunc {
+	return assignUserRole(app.RoleRepository, app.AuditLog)
+}
+
+func assignUserRole(roleRepo repositories.RoleRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := helpers.ReadUUIDParam(r, "userId")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+		roleId, err := helpers.ReadIDParam(r, "roleId")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		err = roleRepo.AssignToUser(userId.String(), roleId)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		event := auditEvent(r, domain.AuditRoleAssigned).With("role_id", roleId)
+		event.TargetType, event.TargetID = domain.AuditTargetUser, userId.String()
+		auditLog.Record(event)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RemoveUserRole(app *application.App) http.HandlerFunc {
+	return removeUserRole(app.RoleRepository, app.AuditLog)
+}
+
+func removeUserRole(roleRepo repositories.RoleRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := helpers.ReadUUIDParam(r, "userId")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+		roleId, err := helpers.ReadIDParam(r, "roleId")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		err = roleRepo.RemoveFromUser(userId.String(), roleId)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		event := auditEvent(r, domain.AuditRoleRemoved).With("role_id", roleId)
+		event.TargetType, event.TargetID = domain.AuditTargetUser, userId.String()
+		auditLog.Record(event)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
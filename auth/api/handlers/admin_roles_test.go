@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestUserRolesInvalidUserId(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+	}{
+		{"List", http.MethodGet, listUserRoles(nil, nil)},
+		{"Assign", http.MethodPut, assignUserRole(nil, nil)},
+		{"Remove", http.MethodDelete, removeUserRole(nil, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r = mux.SetURLVars(r, map[string]string{"userId": "not-a-uuid", "roleId": "1"})
+			rr := httptest.NewRecorder()
+
+			// The id is refused before the repositories are used
+			tt.handler.ServeHTTP(rr, r)
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("want status %d; got %d: %s", http.StatusNotFound, rr.Code, rr.Body)
+			}
+		})
+	}
+}
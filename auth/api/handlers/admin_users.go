@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+// The admin API for support staff to find and manage user accounts.
+
+const (
+	defaultUsersPageSize = 20
+	maxUsersPageSize     = 100
+)
+
+func ListUsers(app *application.App) http.HandlerFunc {
+	return listUsers(app.UserRepository)
+}
+
+// listUsers returns a page of users. The query string can filter them with
+// status, created_after, created_before (RFC 3339 times) and email_prefix,
+// sort them with sort (created_at, email, or either with a leading "-" for
+// descending order), and page through them with limit and the cursor returned
+// as next_cursor by the previous page.
+func listUsers(userRepo repositories.UserRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+		v := validator.New()
+
+		filter := repositories.UserFilter{
+			Status:        strings.TrimSpace(qs.Get("status")),
+			CreatedAfter:  helpers.ReadQueryTime(qs, "created_after", v),
+			CreatedBefore: helpers.ReadQueryTime(qs, "created_before", v),
+			EmailPrefix:   strings.TrimSpace(qs.Get("email_prefix")),
+			Sort:          helpers.ReadQueryString(qs, "sort", "created_at"),
+			Limit:         helpers.ReadQueryInt(qs, "limit", defaultUsersPageSize, v),
+		}
+
+		v.Check(filter.Status == "" || domain.ValidStatus(filter.Status), "status", "invalid status")
+		v.Check(v.In(filter.Sort, repositories.UserSortSafelist...), "sort", "invalid sort value")
+		v.Check(filter.Limit > 0, "limit", "must be greater than zero")
+		v.Check(filter.Limit <= maxUsersPageSize, "limit", "must be a maximum of 100")
+
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		if cursor := qs.Get("cursor"); cursor != "" {
+			after, err := readUsersCursor(cursor, filter.Sort)
+			if err != nil {
+				helpers.BadRequestErrResponseWithMsg(w, r, err)
+				return
+			}
+			filter.After = after
+		}
+
+		users, next, err := userRepo.List(filter)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		total, err := userRepo.Count(filter)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		responses := make([]*domain.AdminUserResponse, 0, len(users))
+		for _, user := range users {
+			responses = append(responses, user.ToAdminResponse())
+		}
+
+		metadata := map[string]interface{}{
+			"total": total,
+		}
+		if next != nil {
+			metadata["next_cursor"] = next.Encode()
+		}
+
+		response := map[string]interface{}{
+			"users":    responses,
+			"metadata": metadata,
+		}
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func GetUser(app *application.App) http.HandlerFunc {
+	return getUser(app.UserRepository, app.RoleRepository)
+}
+
+func getUser(userRepo repositories.UserRepositoryInterface, roleRepo repositories.RoleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := readUser(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		var err error
+		user.Roles, _, err = roleRepo.GetNamesForUser(user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, user.ToAdminResponse(), nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func UpdateUser(app *application.App) http.HandlerFunc {
+	return updateUser(app.UserRepository, app.TokenRepository, app.Mailer, app.AuditLog)
+}
+
+// updateUser applies a partial update to a user. Besides editing their details
+// it can change the status of their account, e.g. to suspend them, and force
+// them to reset their password before they can sign in again, which also emails
+// them a password reset token and signs them out everywhere. A status change
+// takes effect on their very next request, as AuthenticationMiddleware checks
+// the status of the account.
+func updateUser(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := readUser(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			FirstName          *string `json:"firstName"`
+			LastName           *string `json:"lastName"`
+			Email              *string `json:"email"`
+			Status             *string `json:"status"`
+			StatusReason       string  `json:"statusReason"`
+			ForcePasswordReset *bool   `json:"forcePasswordReset"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		// Record which fields were sent, but not their values, in the audit log
+		fields := []string{}
+		previousStatus := user.Status
+
+		if input.FirstName != nil {
+			user.FirstName = strings.TrimSpace(*input.FirstName)
+			fields = append(fields, "firstName")
+		}
+		if input.LastName != nil {
+			user.LastName = strings.TrimSpace(*input.LastName)
+			fields = append(fields, "lastName")
+		}
+		if input.Email != nil {
+			user.Email = strings.TrimSpace(*input.Email)
+			fields = append(fields, "email")
+		}
+		if input.ForcePasswordReset != nil {
+			user.PasswordResetRequired = *input.ForcePasswordReset
+			fields = append(fields, "forcePasswordReset")
+		}
+
+		v := validator.New()
+		if input.Status != nil && *input.Status != user.Status {
+			input.StatusReason = strings.TrimSpace(input.StatusReason)
+			v.Check(len(input.StatusReason) <= 500, "statusReason", "must not be more than 500 characters long")
+			switch err := user.SetStatus(*input.Status, input.StatusReason); {
+			case !domain.ValidStatus(*input.Status):
+				v.AddError("status", "invalid status")
+			case err != nil:
+				v.AddError("status", err.Error())
+			}
+		}
+		v.Check(user.FirstName != "", "firstName", "first name is required")
+		v.Check(len([]rune(user.FirstName)) <= 100, "firstName", "first name must not be more than 100 characters")
+		v.Check(user.LastName != "", "lastName", "last name is required")
+		v.Check(len([]rune(user.LastName)) <= 100, "lastName", "last name must not be more than 100 characters")
+		v.Check(v.Matches(user.Email, validator.EmailRX), "email", "invalid email")
+
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = userRepo.Update(user)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrDuplicateEmail):
+				v.AddError("email", err.Error())
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			case errors.Is(err, repositories.ErrEditConflict):
+				helpers.UnprocessableErrResponse(w, r, err)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		if len(fields) > 0 {
+			auditLog.Record(auditEvent(r, domain.AuditUserUpdated).SetTarget(user).With("fields", fields))
+		}
+		if user.Status != previousStatus {
+			auditLog.Record(auditEvent(r, domain.AuditUserStatusChanged).
+				SetTarget(user).
+				With("from", previousStatus).
+				With("to", user.Status).
+				With("reason", user.StatusReason))
+		}
+
+		if input.ForcePasswordReset != nil && *input.ForcePasswordReset {
+			// Sign them out everywhere, otherwise they could carry on with the
+			// password that is being reset until their token expires.
+			err = userRepo.RevokeSessions(user.ID.String())
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+				return
+			}
+
+			token, err := tokenRepo.New(user.ID.String(), passwordResetTokenTTL, domain.TokenScopePasswordReset)
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+				return
+			}
+			sendPasswordResetEmail(mailer, user.Email, token)
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, user.ToAdminResponse(), nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func DeleteUser(app *application.App) http.HandlerFunc {
+	return deleteUser(app.UserRepository, app.AuditLog)
+}
+
+// deleteUser permanently deletes a user's account, along with everything that
+// belongs to it.
+func deleteUser(userRepo repositories.UserRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := readUser(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		err := userRepo.Delete(user.ID.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		auditLog.Record(auditEvent(r, domain.AuditUserDeleted).SetTarget(user).With("email", user.Email))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// readUsersCursor decodes the cursor of a page of users sorted by sort. Cursors
+// are only ever made by List, so one that doesn't hold a user id and a value of
+// the sort column has been tampered with.
+func readUsersCursor(cursor, sort string) (*repositories.Cursor, error) {
+	after, err := repositories.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(after.ID); err != nil {
+		return nil, repositories.ErrInvalidCursor
+	}
+	if strings.TrimPrefix(sort, "-") == "created_at" {
+		if _, err := time.Parse(time.RFC3339Nano, after.Value); err != nil {
+			return nil, repositories.ErrInvalidCursor
+		}
+	}
+	return after, nil
+}
+
+// readUser returns the user in the id route parameter, writing a not found
+// response if there isn't one.
+func readUser(w http.ResponseWriter, r *http.Request, userRepo repositories.UserRepositoryInterface) (*domain.User, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.NotFoundErrResponse(w, r)
+		return nil, false
+	}
+
+	user, err := userRepo.GetById(id.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrRecordNotFound):
+			helpers.NotFoundErrResponse(w, r)
+		default:
+			helpers.ServerErrReponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
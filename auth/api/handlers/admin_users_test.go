@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/repositories"
+)
+
+func TestListUsersInvalidCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"Not base64", "created_at", "not a cursor!"},
+		{"Not JSON", "created_at", "bm90IGpzb24"},
+		{"Invalid id", "created_at", (&repositories.Cursor{ID: "1", Value: "2021-01-01T00:00:00Z"}).Encode()},
+		{"Invalid time", "-created_at", (&repositories.Cursor{ID: uuid.NewString(), Value: "yesterday"}).Encode()},
+		{"Invalid id sorting by email", "email", (&repositories.Cursor{ID: "1", Value: "jane@email.com"}).Encode()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs := url.Values{"sort": {tt.sort}, "cursor": {tt.cursor}}
+			r := httptest.NewRequest(http.MethodGet, "/?"+qs.Encode(), nil)
+			rr := httptest.NewRecorder()
+
+			// The cursor is refused before the repository is used
+			listUsers(nil).ServeHTTP(rr, r)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("want status %d; got %d: %s", http.StatusBadRequest, rr.Code, rr.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+)
+
+// auditEvent returns an audit event for the action, recording who made the
+// request and where from. The actor is the signed in user, or the admin
+// impersonating them. Handlers for requests authenticated by an emailed token
+// set the actor to the token's user themselves.
+func auditEvent(r *http.Request, action string) *domain.AuditEvent {
+	event := &domain.AuditEvent{
+		Action:    action,
+		IP:        helpers.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: helpers.RequestID(r),
+	}
+
+	if claims, ok := identity.GetClaimsFromContext(r.Context()); ok {
+		event.ActorID, event.ActorEmail = claims.UserId.String(), claims.Email
+		if claims.Impersonating() {
+			event.ActorID, event.ActorEmail = claims.Act.UserId.String(), claims.Act.Email
+			event.With("impersonating", claims.UserId.String())
+		}
+	}
+
+	return event
+}
+
+// userAuditEvent returns an audit event for the action done by the user to
+// their own account.
+func userAuditEvent(r *http.Request, action string, user *domain.User) *domain.AuditEvent {
+	event := auditEvent(r, action).SetTarget(user)
+	if event.ActorID == "" {
+		event.ActorID, event.ActorEmail = user.ID.String(), user.Email
+	}
+	return event
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/device"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ipfilter"
+	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
+	"github.com/todo-app/pkg/logger"
+)
+
+/** Workflow for confirming a risky sign in:
+
+1. A sign in with the right password is scored on how unlike the user's previous sign ins it is,
+   e.g. from a new country or further away than they could have travelled since the last one.
+
+2. If the score is too high, the POST /v1/signin endpoint responds 202 Accepted instead of signing
+   them in, and we email the user a token to confirm it was them.
+
+3. The user submits the token to the POST /v1/signin/confirm endpoint, which signs them in as
+   POST /v1/signin would have.
+
+4. We delete all their confirm sign in tokens.
+
+*/
+
+// sendConfirmLoginEmail emails the user the token to confirm a challenged sign
+// in, in a background go routine.
+func sendConfirmLoginEmail(r *http.Request, mailer mailer.Mailer, challenge *identity.ChallengeError) {
+	d := device.Identify(r.UserAgent(), helpers.ClientIP(r))
+	location := "an unknown location"
+	if challenge.Location != nil {
+		location = challenge.Location.String()
+	}
+
+	go func() {
+		// Handle any errors from this goroutine as it wont be caught from the
+		// panic recovery middleware
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error.Println(fmt.Errorf("%s", err))
+			}
+		}()
+
+		data := map[string]interface{}{
+			"device":            d.Description(),
+			"ip":                d.IP,
+			"location":          location,
+			"signedInAt":        time.Now().UTC().Format("2006-01-02 15:04 MST"),
+			"confirmLoginToken": challenge.Token.Plaintext,
+		}
+
+		err := mailer.Send(challenge.User.Email, "confirm_sign_in.tmpl", data)
+		if err != nil {
+			logger.Error.Println(err)
+		}
+	}()
+}
+
+func ConfirmLogin(app *application.App) http.HandlerFunc {
+	return confirmLogin(app.IdentityService, app.RoleRepository, app.OrganizationRepository, app.DeviceRepository, app.TokenRepository, app.Mailer, app.AuditLog)
+}
+
+func confirmLogin(service services.IdentityServiceInterface, roleRepo repositories.RoleRepositoryInterface, orgRepo repositories.OrganizationRepositoryInterface, deviceRepo repositories.DeviceRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req identity.LoginConfirmationRequest
+		err := helpers.ReadJSON(w, r, &req)
+		if err != nil {
+			helpers.BadRequestErrResponse(w, r, err)
+			return
+		}
+		req.IP = helpers.ClientIP(r)
+		req.UserAgent = r.UserAgent()
+		req.RequestID = helpers.RequestID(r)
+
+		v := validator.New()
+
+		if domain.ValidateTokenPlainText(v, req.Token); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		user, err := service.HandleLoginConfirmation(&req)
+		if err != nil {
+			var lockErr *identity.LockoutError
+			switch {
+			case errors.Is(err, identity.ErrInvalidConfirmationToken):
+				v.AddError("token", err.Error())
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			case errors.As(err, &lockErr):
+				helpers.TooManyRequestsResponse(w, r, lockErr.RetryAfter())
+			case errors.Is(err, identity.ErrAccountSuspended), errors.Is(err, identity.ErrAccountOnHold), errors.Is(err, identity.ErrAccountClosed):
+				helpers.AccountUnavailableResponse(w, r, err)
+			case errors.Is(err, ipfilter.ErrNotAllowed):
+				helpers.IPNotAllowedResponse(w, r, err)
+			case errors.Is(err, identity.ErrPasswordResetRequired):
+				helpers.BadRequestErrResponseWithMsg(w, r, errors.New("you must reset your password before you can login. Please check your email for a password reset token"))
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		// Sign them in to the organization they joined first
+		err = startSession(w, user, roleRepo, orgRepo, "")
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		// Failing to check the device shouldn't stop them signing in
+		err = notifyNewDevice(r, user, deviceRepo, tokenRepo, mailer, auditLog)
+		if err != nil {
+			logger.Error.Printf("failed checking the device user %s signed in from: %v", user.ID, err)
+		}
+
+		userResponse := user.ToHTTPResponse()
+		helpers.SendJSON(w, http.StatusOK, userResponse, nil)
+	}
+}
@@ -29,7 +29,13 @@ func getCurrentUser(service services.IdentityServiceInterface) http.HandlerFunc
 			return
 		}
 
-		err = helpers.SendJSON(w, http.StatusOK, user.ToHTTPResponse(), nil)
+		response := user.ToHTTPResponse()
+		if claims.Impersonating() {
+			response.Impersonating = true
+			response.ImpersonatedBy = claims.Act.Email
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
 
 		if err != nil {
 			helpers.ServerErrReponse(w, r, err)
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
+)
+
+func DeleteAccount(app *application.App) http.HandlerFunc {
+	return deleteAccount(app.IdentityService, app.AuditLog)
+}
+
+// deleteAccount permanently erases the logged in user's account. Because this
+// can't be undone, the user has to re-authenticate by supplying their current
+// password even though they already hold a valid session. All of the user's
+// tokens are removed by the database along with the user record.
+func deleteAccount(service services.IdentityServiceInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		var input struct {
+			Password string `json:"password"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		v.Check(input.Password != "", "password", "must be provided")
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = service.HandleDeleteAccount(claims.UserId.String(), input.Password)
+		if err != nil {
+			switch {
+			case errors.Is(err, identity.ErrInvalidCredentials):
+				helpers.InvalidCredentialsResponse(w, r, err)
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		event := auditEvent(r, domain.AuditUserDeleted)
+		event.TargetType, event.TargetID = domain.AuditTargetUser, claims.UserId.String()
+		auditLog.Record(event)
+
+		// The account no longer exists, so make sure the client drops its session.
+		identity.ClearCookie(w)
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "your account and all associated data has been deleted",
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/todo-app/internal/application"
+)
+
+// enumerationGuard keeps handlers that take an email address from revealing
+// whether it's registered. When enabled, those handlers give every outcome the
+// same response, and hold it back until minResponseTime has passed so that the
+// extra work done for a registered address (token generation, queueing an email)
+// doesn't show in the response time either.
+type enumerationGuard struct {
+	enabled         bool
+	minResponseTime time.Duration
+}
+
+func newEnumerationGuard(app *application.App) enumerationGuard {
+	return enumerationGuard{
+		enabled:         app.Confg.EnumerationSafe.Enabled,
+		minResponseTime: app.Confg.EnumerationSafe.MinResponseTime,
+	}
+}
+
+// wait blocks until minResponseTime has passed since start, if the guard is enabled.
+func (g enumerationGuard) wait(start time.Time) {
+	if g.enabled {
+		time.Sleep(time.Until(start.Add(g.minResponseTime)))
+	}
+}
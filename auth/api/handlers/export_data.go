@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
+	"github.com/todo-app/pkg/logger"
+)
+
+/** Workflow for exporting a user's data (subject-access request):
+
+1. The logged in user sends a GET /v1/user/me/export request. Adding ?format=zip returns
+   the export as a zip archive instead of JSON, and ?async=true always builds it in the background.
+
+2. We count the records every export source holds for the user. Small accounts get
+   their export straight away in the response.
+
+3. Large accounts (more records than the configured threshold) get a 202 Accepted response
+   and the export is built in a background goroutine. The zipped archive is stored in the
+   data_exports table, and the user is emailed a single-use download token.
+
+4. The user downloads the archive with GET /v1/user/me/export/download?token=..., which
+   requires both the token and an active session for the same user.
+
+*/
+
+// dataExportTTL is how long a stored export archive, and the token to download it, stays valid.
+const dataExportTTL = 72 * time.Hour
+
+func ExportData(app *application.App) http.HandlerFunc {
+	return exportData(app.ExportService, app.DataExportRepository, app.TokenRepository, app.Mailer, app.AuditLog, app.Confg.Export.AsyncThreshold)
+}
+
+func exportData(
+	exportService services.ExportServiceInterface,
+	exportRepo repositories.DataExportRepositoryInterface,
+	tokenRepo repositories.TokenRepositoryInterface,
+	mailer mailer.Mailer,
+	auditLog *audit.Log,
+	asyncThreshold int,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+		userId := claims.UserId.String()
+
+		count, err := exportService.CountRecords(userId)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		async := r.URL.Query().Get("async") == "true" || count > asyncThreshold
+		event := auditEvent(r, domain.AuditDataExportRequested).With("async", async)
+		event.TargetType, event.TargetID = domain.AuditTargetUser, userId
+		auditLog.Record(event)
+
+		if async {
+			// Build the export in the background. Handle any panics in the goroutine
+			// as they wont be caught by the panic recovery middleware.
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						logger.Error.Println(fmt.Errorf("%s", err))
+					}
+				}()
+
+				err := storeDataExport(exportService, exportRepo, tokenRepo, mailer, userId, claims.Email)
+				if err != nil {
+					logger.Error.Printf("failed generating data export for user %s: %v", userId, err)
+				}
+			}()
+
+			response := map[string]interface{}{
+				"success": true,
+				"message": "your data export is being prepared and a download link will be emailed to you",
+			}
+
+			err = helpers.SendJSON(w, http.StatusAccepted, response, nil)
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		export, err := exportService.Build(userId)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "zip" {
+			archive, err := exportService.Archive(export)
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+				return
+			}
+			sendArchive(w, archive)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, export, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+// storeDataExport builds and stores an export archive for the user, replacing any
+// previous one, and emails the user a token to download it.
+func storeDataExport(
+	exportService services.ExportServiceInterface,
+	exportRepo repositories.DataExportRepositoryInterface,
+	tokenRepo repositories.TokenRepositoryInterface,
+	mailer mailer.Mailer,
+	userId, email string,
+) error {
+	export, err := exportService.Build(userId)
+	if err != nil {
+		return err
+	}
+
+	archive, err := exportService.Archive(export)
+	if err != nil {
+		return err
+	}
+
+	// Only keep the latest export around, there's no reason to hold several
+	// copies of the same personal data.
+	if err := exportRepo.DeleteAllForUser(userId); err != nil {
+		return err
+	}
+
+	err = exportRepo.Insert(&domain.DataExport{
+		ID:      uuid.New(),
+		UserID:  userId,
+		Expiry:  time.Now().Add(dataExportTTL),
+		Archive: archive,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tokenRepo.DeleteAllForUser(domain.TokenScopeDataExport, userId); err != nil {
+		return err
+	}
+
+	token, err := tokenRepo.New(userId, dataExportTTL, domain.TokenScopeDataExport)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"exportToken": token.Plaintext,
+	}
+
+	return mailer.Send(email, "data_export.tmpl", data)
+}
+
+func DownloadDataExport(app *application.App) http.HandlerFunc {
+	return downloadDataExport(app.UserRepository, app.DataExportRepository, app.TokenRepository)
+}
+
+func downloadDataExport(userRepo repositories.UserRepositoryInterface, exportRepo repositories.DataExportRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		tokenPlaintext := r.URL.Query().Get("token")
+
+		v := validator.New()
+		if domain.ValidateTokenPlainText(v, tokenPlaintext); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		user, err := userRepo.GetForToken(domain.TokenScopeDataExport, tokenPlaintext)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				v.AddError("token", "invalid or expired export token")
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		// The token alone is not enough, it has to be used from the account it was issued to.
+		if user.ID != claims.UserId {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		export, err := exportRepo.GetLatestForUser(user.ID.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		// The token is single use, so it goes before the archive is sent
+		if err := tokenRepo.DeleteAllForUser(domain.TokenScopeDataExport, user.ID.String()); err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		sendArchive(w, export.Archive)
+	}
+}
+
+func sendArchive(w http.ResponseWriter, archive []byte) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
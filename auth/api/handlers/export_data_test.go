@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/testutil"
+)
+
+func TestDownloadDataExport(t *testing.T) {
+	testutil.SetupUserTable(db)
+	testutil.SetupLoginTables(db)
+	testutil.SetupDataExportTable(db)
+	t.Cleanup(func() {
+		testutil.TeardownDataExportTable(db, t)
+		testutil.TeardownLoginTables(db, t)
+		testutil.TeardownUserTable(db, t)
+	})
+
+	userRepo := repositories.NewUserRepository(db)
+	exportRepo := repositories.NewDataExportRepository(db)
+	tokenRepo := repositories.NewTokenRepository(db)
+
+	user := &domain.User{FirstName: "Jane", LastName: "Doe", Email: testutil.MakeRandEmail(), Password: "password", Status: domain.StatusActive}
+	user.Prepare()
+	user, err := userRepo.Create(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := []byte("PK archive")
+	err = exportRepo.Insert(&domain.DataExport{ID: uuid.New(), UserID: user.ID.String(), Expiry: time.Now().Add(time.Hour), Archive: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := tokenRepo.New(user.ID.String(), time.Hour, domain.TokenScopeDataExport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	download := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/?token="+url.QueryEscape(token.Plaintext), nil)
+		claims := identity.JWTClaims{UserId: user.ID, Email: user.Email}
+		r = r.WithContext(context.WithValue(r.Context(), identity.UserCtxKey, claims))
+
+		rr := httptest.NewRecorder()
+		downloadDataExport(userRepo, exportRepo, tokenRepo).ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := download()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d; got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	if got := rr.Body.String(); got != string(archive) {
+		t.Errorf("want archive %q; got %q", archive, got)
+	}
+
+	// The token is single use
+	if rr := download(); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want status %d downloading again; got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
+)
+
+// maxImportBatch is the most users that can be imported in a single request.
+// Larger migrations should use the cmd/userimport command instead.
+const maxImportBatch = 1000
+
+func ImportUsers(app *application.App) http.HandlerFunc {
+	return importUsers(app.IdentityService, app.AuditLog)
+}
+
+// importUsers creates users migrated from another system along with their
+// existing password hashes. Each user is imported independently, and the
+// response lists the outcome of every one of them.
+func importUsers(service services.IdentityServiceInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Users []*domain.ImportUser `json:"users"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		v.Check(len(input.Users) > 0, "users", "must contain at least one user")
+		v.Check(len(input.Users) <= maxImportBatch, "users", fmt.Sprintf("must not contain more than %d users", maxImportBatch))
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		results, err := services.ImportUsers(service, input.Users)
+		// The users imported before an error are there to stay, so they are
+		// recorded either way
+		created := 0
+		for i, result := range results {
+			if result.Created {
+				created++
+				event := auditEvent(r, domain.AuditUserImported).With("hash_format", input.Users[i].HashFormat)
+				event.TargetType, event.TargetID = domain.AuditTargetUser, result.ID.String()
+				auditLog.Record(event)
+			}
+		}
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"created": created,
+			"failed":  len(results) - created,
+			"results": results,
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
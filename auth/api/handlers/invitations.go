@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
+	"github.com/todo-app/pkg/logger"
+)
+
+/** Workflow for inviting someone to an organization:
+
+1. An owner or admin of the organization the user is signed in to invites an email
+   address with POST /v1/org/invitations, and an invitation token is emailed to it.
+
+2. The person invited submits the token to POST /v1/invitations/accept. If they already
+   have an account they join the organization with it. Otherwise they also submit their
+   name and a password, and an account is created for them. It is activated straight
+   away, as receiving the token proves they own the email address.
+
+3. The invitation and its token are deleted, so it can only be accepted once.
+
+*/
+
+// invitationTokenTTL is how long an invitation can be accepted for.
+const invitationTokenTTL = 7 * 24 * time.Hour
+
+func CreateInvitation(app *application.App) http.HandlerFunc {
+	return createInvitation(app.OrganizationRepository, app.InvitationRepository, app.TokenRepository, app.UserRepository, app.Mailer, app.AuditLog)
+}
+
+// createInvitation invites an email address to the organization. Inviting an
+// address again replaces its earlier invitation. Only owners can invite owners.
+func createInvitation(orgRepo repositories.OrganizationRepositoryInterface, invRepo repositories.InvitationRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, userRepo repositories.UserRepositoryInterface, mailer mailer.Mailer, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor, tenant, ok := activeMembership(w, r, orgRepo, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Email string `json:"email"`
+			Role  string `json:"role"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		inv := &domain.Invitation{
+			Email:     strings.TrimSpace(input.Email),
+			Role:      input.Role,
+			InvitedBy: actor.UserID.String(),
+			Expiry:    time.Now().Add(invitationTokenTTL),
+		}
+		if inv.Role == "" {
+			inv.Role = domain.OrgRoleMember
+		}
+
+		v := validator.New()
+		if domain.ValidateInvitation(v, inv); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		if inv.Role == domain.OrgRoleOwner && actor.Role != domain.OrgRoleOwner {
+			helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s can't invite owners to organization %s", actor.UserID, tenant.OrgID()))
+			return
+		}
+
+		// There's no point inviting someone who is already a member
+		user, err := userRepo.GetByEmail(inv.Email)
+		switch {
+		case err == nil:
+			_, err = orgRepo.GetMember(tenant, user.ID.String())
+			if err == nil {
+				v.AddError("email", repositories.ErrDuplicateMembership.Error())
+				helpers.FailedValidationResponse(w, r, v.Errors)
+				return
+			}
+			if !errors.Is(err, repositories.ErrRecordNotFound) {
+				helpers.ServerErrReponse(w, r, err)
+				return
+			}
+		case !errors.Is(err, repositories.ErrRecordNotFound):
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		org, err := orgRepo.Get(tenant)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = invRepo.Insert(tenant, inv)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+		inv.OrganizationID = org.ID
+		inv.OrganizationName = org.Name
+
+		token, err := tokenRepo.NewForInvitation(inv.ID, invitationTokenTTL)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		sendInvitationEmail(mailer, inv, actor, token)
+
+		event := auditEvent(r, domain.AuditInvitationCreated).
+			With("invitation_id", inv.ID).
+			With("email", inv.Email).
+			With("role", inv.Role)
+		event.TargetType, event.TargetID = domain.AuditTargetOrganization, tenant.OrgID()
+		auditLog.Record(event)
+
+		err = helpers.SendJSON(w, http.StatusCreated, inv, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func ListInvitations(app *application.App) http.HandlerFunc {
+	return listInvitations(app.OrganizationRepository, app.InvitationRepository)
+}
+
+// listInvitations lists the organization's pending invitations.
+func listInvitations(orgRepo repositories.OrganizationRepositoryInterface, invRepo repositories.InvitationRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tenant, ok := activeMembership(w, r, orgRepo, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+		if !ok {
+			return
+		}
+
+		invitations, err := invRepo.GetAllPending(tenant)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, invitations, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func RevokeInvitation(app *application.App) http.HandlerFunc {
+	return revokeInvitation(app.OrganizationRepository, app.InvitationRepository, app.AuditLog)
+}
+
+// revokeInvitation deletes an invitation, so its token can no longer be used.
+func revokeInvitation(orgRepo repositories.OrganizationRepositoryInterface, invRepo repositories.InvitationRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tenant, ok := activeMembership(w, r, orgRepo, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+		if !ok {
+			return
+		}
+
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		err = invRepo.Delete(tenant, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		event := auditEvent(r, domain.AuditInvitationRevoked).With("invitation_id", id)
+		event.TargetType, event.TargetID = domain.AuditTargetOrganization, tenant.OrgID()
+		auditLog.Record(event)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func AcceptInvitation(app *application.App) http.HandlerFunc {
+	return acceptInvitation(app.IdentityService, app.UserRepository, app.TokenRepository, app.InvitationRepository, app.PasswordPolicy, app.AuditLog)
+}
+
+func acceptInvitation(service services.IdentityServiceInterface, userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, invRepo repositories.InvitationRepositoryInterface, passwordPolicy *validator.PasswordPolicy, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			TokenPlainText string `json:"token"`
+			// Only needed if the person invited doesn't have an account yet
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+			// Also needed if their account hasn't been activated yet
+			Password string `json:"password"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if domain.ValidateTokenPlainText(v, input.TokenPlainText); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		inv, err := invRepo.GetForToken(input.TokenPlainText)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				v.AddError("token", "invalid or expired invitation token")
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		user, err := userRepo.GetByEmail(inv.Email)
+		switch {
+		case err == nil:
+			switch user.Status {
+			case domain.StatusActive:
+			case domain.StatusPending:
+				// The token proves they own the address, so there's no need for
+				// them to activate their account separately. Anyone could have
+				// registered the address before them though, so the password of
+				// the pending account is replaced with one they choose now.
+				if passwordPolicy.Validate(v, "password", input.Password, user.FirstName, user.LastName, user.Email); !v.Valid() {
+					helpers.FailedValidationResponse(w, r, v.Errors)
+					return
+				}
+				user.Password = input.Password
+				if err := user.HashPassword(); err != nil {
+					helpers.ServerErrReponse(w, r, err)
+					return
+				}
+				user.PasswordResetRequired = false
+				user.SetStatus(domain.StatusActive, "activated by accepting an invitation")
+				if err := userRepo.Update(user); err != nil {
+					helpers.ServerErrReponse(w, r, err)
+					return
+				}
+				if err := tokenRepo.DeleteAllForUser(domain.TokenScopeActivation, user.ID.String()); err != nil {
+					helpers.ServerErrReponse(w, r, err)
+					return
+				}
+			default:
+				// Suspended, locked or closed accounts can't join organizations,
+				// and the invitation is kept in case the account is restored.
+				helpers.AccountUnavailableResponse(w, r, identity.CheckStatus(user.Status))
+				return
+			}
+		case errors.Is(err, repositories.ErrRecordNotFound):
+			user = &domain.User{
+				FirstName: input.FirstName,
+				LastName:  input.LastName,
+				Email:     inv.Email,
+				Password:  input.Password,
+				Status:    domain.StatusActive,
+			}
+			user.Prepare()
+
+			v.Check(user.FirstName != "", "firstName", "first name is required")
+			v.Check(user.LastName != "", "lastName", "last name is required")
+			passwordPolicy.Validate(v, "password", user.Password, user.FirstName, user.LastName, user.Email)
+			if !v.Valid() {
+				helpers.FailedValidationResponse(w, r, v.Errors)
+				return
+			}
+
+			user, err = service.HandleRegister(user)
+			if err != nil {
+				switch {
+				case errors.Is(err, repositories.ErrDuplicateEmail):
+					helpers.BadRequestErrResponseWithMsg(w, r, err)
+				default:
+					helpers.ServerErrReponse(w, r, err)
+				}
+				return
+			}
+		default:
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = invRepo.Accept(inv, user.ID.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				v.AddError("token", "invalid or expired invitation token")
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		auditLog.Record(userAuditEvent(r, domain.AuditInvitationAccepted, user).
+			With("organization_id", inv.OrganizationID).
+			With("role", inv.Role))
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": fmt.Sprintf("you have joined %s, sign in to get started", inv.OrganizationName),
+			"user":    user.ToHTTPResponse(),
+		}
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+// sendInvitationEmail sends the invitation token to the person invited, in the
+// background.
+func sendInvitationEmail(mailer mailer.Mailer, inv *domain.Invitation, inviter *domain.Membership, token *domain.Token) {
+	go func() {
+		// Handle any errors from this goroutine as it wont be caught from the
+		// panic recovery middleware
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error.Println(fmt.Errorf("%s", err))
+			}
+		}()
+
+		data := map[string]interface{}{
+			"invitationToken":  token.Plaintext,
+			"organizationName": inv.OrganizationName,
+			"inviterName":      strings.TrimSpace(inviter.FirstName + " " + inviter.LastName),
+			"role":             inv.Role,
+			"expiry":           inv.Expiry.UTC().Format("2006-01-02 15:04 MST"),
+		}
+
+		err := mailer.Send(inv.Email, "invitation.tmpl", data)
+		if err != nil {
+			logger.Error.Println(err)
+		}
+	}()
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/hashing"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
+	"github.com/todo-app/testutil"
+)
+
+// invitationMailer hands over the token of every invitation sent.
+type invitationMailer struct {
+	tokens chan string
+}
+
+func (m *invitationMailer) Send(recipient, templateFile string, data interface{}) error {
+	m.tokens <- data.(map[string]interface{})["invitationToken"].(string)
+	return nil
+}
+
+// invitationTest holds an organization owned by owner, and the repositories
+// the invitation handlers need.
+type invitationTest struct {
+	owner     *domain.User
+	org       *domain.Organization
+	userRepo  *repositories.UserRepo
+	orgRepo   *repositories.OrganizationRepository
+	invRepo   *repositories.InvitationRepository
+	tokenRepo *repositories.TokenRepository
+	mailer    *invitationMailer
+}
+
+func setupInvitationTest(t *testing.T) *invitationTest {
+	testutil.SetupUserTable(db)
+	testutil.SetupLoginTables(db)
+	testutil.SetupOrganizationTables(db)
+	t.Cleanup(func() {
+		testutil.TeardownOrganizationTables(db, t)
+		testutil.TeardownLoginTables(db, t)
+		testutil.TeardownUserTable(db, t)
+	})
+
+	it := &invitationTest{
+		userRepo:  repositories.NewUserRepository(db),
+		orgRepo:   repositories.NewOrganizationRepository(db),
+		invRepo:   repositories.NewInvitationRepository(db),
+		tokenRepo: repositories.NewTokenRepository(db),
+		mailer:    &invitationMailer{tokens: make(chan string, 1)},
+	}
+
+	it.owner = it.createUser(t, testutil.MakeRandEmail(), domain.StatusActive)
+
+	it.org = &domain.Organization{Name: "Acme"}
+	it.org.Prepare()
+	if err := it.orgRepo.Create(it.org, it.owner.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	return it
+}
+
+func (it *invitationTest) createUser(t *testing.T, email, status string) *domain.User {
+	t.Helper()
+	user := &domain.User{FirstName: "Jane", LastName: "Doe", Email: email, Password: "password", Status: status}
+	user.Prepare()
+	user, err := it.userRepo.Create(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// ownerRequest returns a request made by the owner while signed in to the organization.
+func (it *invitationTest) ownerRequest(t *testing.T, method string, body interface{}) *http.Request {
+	t.Helper()
+	r := jsonRequest(t, method, body)
+	claims := identity.JWTClaims{UserId: it.owner.ID, Email: it.owner.Email, OrgID: it.org.ID.String()}
+	return r.WithContext(context.WithValue(r.Context(), identity.UserCtxKey, claims))
+}
+
+// invite invites email to the organization, returning the invitation and its token.
+func (it *invitationTest) invite(t *testing.T, email string) (*domain.Invitation, string) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	r := it.ownerRequest(t, http.MethodPost, map[string]string{"email": email})
+	createInvitation(it.orgRepo, it.invRepo, it.tokenRepo, it.userRepo, it.mailer, nil).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("want status %d; got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	var body struct {
+		Data domain.Invitation `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case token := <-it.mailer.tokens:
+		return &body.Data, token
+	case <-time.After(5 * time.Second):
+		t.Fatal("the invitation was never emailed")
+		return nil, ""
+	}
+}
+
+func (it *invitationTest) accept(t *testing.T, input map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	service := services.NewIdentityService(db)
+	policy := validator.NewPasswordPolicy(8, 72)
+	acceptInvitation(service, it.userRepo, it.tokenRepo, it.invRepo, policy, nil).ServeHTTP(rr, jsonRequest(t, http.MethodPost, input))
+	return rr
+}
+
+func (it *invitationTest) pending(t *testing.T) []*domain.Invitation {
+	t.Helper()
+	invitations, err := it.invRepo.GetAllPending(repositories.NewTenant(it.org.ID.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invitations
+}
+
+func jsonRequest(t *testing.T, method string, body interface{}) *http.Request {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.NewRequest(method, "/", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCreateAndListInvitations(t *testing.T) {
+	it := setupInvitationTest(t)
+
+	inv, token := it.invite(t, "invited@email.com")
+	if inv.Role != domain.OrgRoleMember {
+		t.Errorf("want role %q; got %q", domain.OrgRoleMember, inv.Role)
+	}
+	if token == "" {
+		t.Errorf("expected the invitation token to be emailed")
+	}
+
+	rr := httptest.NewRecorder()
+	listInvitations(it.orgRepo, it.invRepo).ServeHTTP(rr, it.ownerRequest(t, http.MethodGet, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d; got %d", http.StatusOK, rr.Code)
+	}
+	var body struct {
+		Data []domain.Invitation `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data) != 1 || body.Data[0].Email != "invited@email.com" {
+		t.Errorf("want the one invitation listed; got %+v", body.Data)
+	}
+
+	// Existing members can't be invited again
+	rr = httptest.NewRecorder()
+	r := it.ownerRequest(t, http.MethodPost, map[string]string{"email": it.owner.Email})
+	createInvitation(it.orgRepo, it.invRepo, it.tokenRepo, it.userRepo, it.mailer, nil).ServeHTTP(rr, r)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want status %d for a member; got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestRevokeInvitation(t *testing.T) {
+	it := setupInvitationTest(t)
+	inv, token := it.invite(t, "invited@email.com")
+
+	rr := httptest.NewRecorder()
+	r := mux.SetURLVars(it.ownerRequest(t, http.MethodDelete, nil), map[string]string{"id": strconv.FormatInt(inv.ID, 10)})
+	revokeInvitation(it.orgRepo, it.invRepo, nil).ServeHTTP(rr, r)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("want status %d; got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if got := it.pending(t); len(got) != 0 {
+		t.Errorf("expected no pending invitations; got %d", len(got))
+	}
+	if rr := it.accept(t, map[string]string{"token": token}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want status %d accepting a revoked invitation; got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	t.Run("New account", func(t *testing.T) {
+		it := setupInvitationTest(t)
+		_, token := it.invite(t, "new@email.com")
+
+		rr := it.accept(t, map[string]string{
+			"token":     token,
+			"firstName": "New",
+			"lastName":  "Member",
+			"password":  "Correct7Horse-Battery",
+		})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("want status %d; got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		user, err := it.userRepo.GetByEmail("new@email.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Status != domain.StatusActive {
+			t.Errorf("want status %q; got %q", domain.StatusActive, user.Status)
+		}
+		member, err := it.orgRepo.GetMember(repositories.NewTenant(it.org.ID.String()), user.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member.Role != domain.OrgRoleMember {
+			t.Errorf("want role %q; got %q", domain.OrgRoleMember, member.Role)
+		}
+	})
+
+	t.Run("Existing account", func(t *testing.T) {
+		it := setupInvitationTest(t)
+		user := it.createUser(t, "existing@email.com", domain.StatusActive)
+		_, token := it.invite(t, user.Email)
+
+		if rr := it.accept(t, map[string]string{"token": token}); rr.Code != http.StatusOK {
+			t.Fatalf("want status %d; got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		if _, err := it.orgRepo.GetMember(repositories.NewTenant(it.org.ID.String()), user.ID.String()); err != nil {
+			t.Errorf("expected user to have joined the organization, err: %v", err)
+		}
+	})
+
+	t.Run("Pending account", func(t *testing.T) {
+		it := setupInvitationTest(t)
+		user := it.createUser(t, "pending@email.com", domain.StatusPending)
+		_, token := it.invite(t, user.Email)
+
+		// Whoever registered the address may not be the person invited, so a
+		// new password has to be chosen
+		if rr := it.accept(t, map[string]string{"token": token}); rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("want status %d without a password; got %d: %s", http.StatusUnprocessableEntity, rr.Code, rr.Body)
+		}
+
+		password := "Correct7Horse-Battery"
+		if rr := it.accept(t, map[string]string{"token": token, "password": password}); rr.Code != http.StatusOK {
+			t.Fatalf("want status %d; got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		// Accepting proves they own the address, so their account is activated
+		user, err := it.userRepo.GetById(user.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Status != domain.StatusActive {
+			t.Errorf("want status %q; got %q", domain.StatusActive, user.Status)
+		}
+		if err := hashing.Default().Verify(user.Password, []byte(password), user.PepperVersion); err != nil {
+			t.Errorf("expected the password to be replaced, err: %v", err)
+		}
+		if _, err := it.orgRepo.GetMember(repositories.NewTenant(it.org.ID.String()), user.ID.String()); err != nil {
+			t.Errorf("expected user to have joined the organization, err: %v", err)
+		}
+	})
+
+	t.Run("Unavailable account", func(t *testing.T) {
+		it := setupInvitationTest(t)
+		user := it.createUser(t, "suspended@email.com", domain.StatusSuspended)
+		_, token := it.invite(t, user.Email)
+
+		if rr := it.accept(t, map[string]string{"token": token}); rr.Code != http.StatusForbidden {
+			t.Fatalf("want status %d; got %d: %s", http.StatusForbidden, rr.Code, rr.Body)
+		}
+
+		if _, err := it.orgRepo.GetMember(repositories.NewTenant(it.org.ID.String()), user.ID.String()); err != repositories.ErrRecordNotFound {
+			t.Errorf("want: %v; got %v", repositories.ErrRecordNotFound, err)
+		}
+		if got := it.pending(t); len(got) != 1 {
+			t.Errorf("expected the invitation to be kept; got %d pending", len(got))
+		}
+	})
+
+	t.Run("Reused token", func(t *testing.T) {
+		it := setupInvitationTest(t)
+		user := it.createUser(t, "existing@email.com", domain.StatusActive)
+		_, token := it.invite(t, user.Email)
+
+		if rr := it.accept(t, map[string]string{"token": token}); rr.Code != http.StatusOK {
+			t.Fatalf("want status %d; got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		if rr := it.accept(t, map[string]string{"token": token}); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want status %d reusing the token; got %d", http.StatusUnprocessableEntity, rr.Code)
+		}
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		it := setupInvitationTest(t)
+		user := it.createUser(t, "existing@email.com", domain.StatusActive)
+
+		inv := &domain.Invitation{Email: user.Email, Role: domain.OrgRoleMember, Expiry: time.Now().Add(-time.Hour)}
+		if err := it.invRepo.Insert(repositories.NewTenant(it.org.ID.String()), inv); err != nil {
+			t.Fatal(err)
+		}
+		token, err := it.tokenRepo.NewForInvitation(inv.ID, -time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rr := it.accept(t, map[string]string{"token": token.Plaintext}); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("want status %d; got %d", http.StatusUnprocessableEntity, rr.Code)
+		}
+		if _, err := it.orgRepo.GetMember(repositories.NewTenant(it.org.ID.String()), user.ID.String()); err != repositories.ErrRecordNotFound {
+			t.Errorf("want: %v; got %v", repositories.ErrRecordNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ipfilter"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+// IP rules allow or deny ranges of IP addresses access to the whole service,
+// managed by admins, or to an organization, managed by its owners and admins.
+// A change that would deny the user making it is refused, so that nobody locks
+// themselves out by mistake.
+
+func ListIPRules(app *application.App) http.HandlerFunc {
+	return listIPRules(app.IPRuleRepository)
+}
+
+func listIPRules(ipRuleRepo repositories.IPRuleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := ipRuleRepo.ListGlobal()
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+		sendIPRules(w, r, rules)
+	}
+}
+
+func CreateIPRule(app *application.App) http.HandlerFunc {
+	return createIPRule(app.IPRuleRepository, app.IPFilter, app.AuditLog)
+}
+
+func createIPRule(ipRuleRepo repositories.IPRuleRepositoryInterface, filter *ipfilter.Filter, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, v, ok := readIPRule(w, r)
+		if !ok {
+			return
+		}
+
+		rules, err := ipRuleRepo.ListGlobal()
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		if checkKeepsAccess(r, v, append(rules, rule)); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = ipRuleRepo.Insert(rule)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+		filter.Invalidate()
+
+		auditLog.Record(ipRuleAuditEvent(r, domain.AuditIPRuleCreated, rule))
+
+		err = helpers.SendJSON(w, http.StatusCreated, rule, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func DeleteIPRule(app *application.App) http.HandlerFunc {
+	return deleteIPRule(app.IPRuleRepository, app.IPFilter, app.AuditLog)
+}
+
+func deleteIPRule(ipRuleRepo repositories.IPRuleRepositoryInterface, filter *ipfilter.Filter, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		rules, err := ipRuleRepo.ListGlobal()
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		rule, remaining, ok := removeIPRule(w, r, rules, id)
+		if !ok {
+			return
+		}
+
+		err = ipRuleRepo.DeleteGlobal(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+		filter.Invalidate()
+
+		auditLog.Record(ipRuleAuditEvent(r, domain.AuditIPRuleDeleted, rule).With("remaining", len(remaining)))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ListOrgIPRules(app *application.App) http.HandlerFunc {
+	return listOrgIPRules(app.OrganizationRepository, app.IPRuleRepository)
+}
+
+func listOrgIPRules(orgRepo repositories.OrganizationRepositoryInterface, ipRuleRepo repositories.IPRuleRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tenant, ok := activeMembership(w, r, orgRepo, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+		if !ok {
+			return
+		}
+
+		rules, err := ipRuleRepo.List(tenant)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+		sendIPRules(w, r, rules)
+	}
+}
+
+func CreateOrgIPRule(app *application.App) http.HandlerFunc {
+	return createOrgIPRule(app.OrganizationRepository, app.IPRuleRepository, app.IPFilter, app.AuditLog)
+}
+
+func createOrgIPRule(orgRepo repositories.OrganizationRepositoryInterface, ipRuleRepo repositories.IPRuleRepositoryInterface, filter *ipfilter.Filter, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tenant, ok := activeMembership(w, r, orgRepo, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+		if !ok {
+			return
+		}
+
+		rule, v, ok := readIPRule(w, r)
+		if !ok {
+			return
+		}
+		rule.OrganizationID = tenant.OrgID()
+
+		rules, err := ipRuleRepo.List(tenant)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		if checkKeepsAccess(r, v, append(rules, rule)); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = ipRuleRepo.Insert(rule)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+		filter.Invalidate()
+
+		auditLog.Record(ipRuleAuditEvent(r, domain.AuditIPRuleCreated, rule))
+
+		err = helpers.SendJSON(w, http.StatusCreated, rule, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func DeleteOrgIPRule(app *application.App) http.HandlerFunc {
+	return deleteOrgIPRule(app.OrganizationRepository, app.IPRuleRepository, app.IPFilter, app.AuditLog)
+}
+
+func deleteOrgIPRule(orgRepo repositories.OrganizationRepositoryInterface, ipRuleRepo repositories.IPRuleRepositoryInterface, filter *ipfilter.Filter, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tenant, ok := activeMembership(w, r, orgRepo, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+		if !ok {
+			return
+		}
+
+		id, err := helpers.ReadIDParam(r, "id")
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		rules, err := ipRuleRepo.List(tenant)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		rule, remaining, ok := removeIPRule(w, r, rules, id)
+		if !ok {
+			return
+		}
+
+		err = ipRuleRepo.Delete(tenant, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+		filter.Invalidate()
+
+		auditLog.Record(ipRuleAuditEvent(r, domain.AuditIPRuleDeleted, rule).With("remaining", len(remaining)))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// readIPRule reads and validates a new rule from the request body, writing the
+// error response if it isn't valid. Single addresses are accepted as ranges of
+// one, and ranges are stored by their network address, e.g. 10.1.2.3/8 as
+// 10.0.0.0/8.
+func readIPRule(w http.ResponseWriter, r *http.Request) (*domain.IPRule, *validator.Validator, bool) {
+	var input struct {
+		CIDR        string `json:"cidr"`
+		Action      string `json:"action"`
+		Description string `json:"description"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.BadRequestErrResponseWithMsg(w, r, err)
+		return nil, nil, false
+	}
+
+	rule := &domain.IPRule{
+		Action:      input.Action,
+		Description: strings.TrimSpace(input.Description),
+	}
+	if claims, ok := identity.GetClaimsFromContext(r.Context()); ok {
+		rule.CreatedBy = claims.UserId.String()
+	}
+
+	v := validator.New()
+	if cidr := strings.TrimSpace(input.CIDR); cidr != "" {
+		network, err := ipfilter.ParseNetwork(cidr)
+		if err != nil {
+			v.AddError("cidr", "must be an IP address or CIDR range")
+		} else {
+			rule.CIDR = network.String()
+		}
+	}
+
+	if domain.ValidateIPRule(v, rule); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return nil, nil, false
+	}
+	return rule, v, true
+}
+
+// removeIPRule returns the rule with the id and the rules left without it,
+// writing the error response if there is no such rule or removing it would deny
+// the user making the request.
+func removeIPRule(w http.ResponseWriter, r *http.Request, rules []*domain.IPRule, id int64) (*domain.IPRule, []*domain.IPRule, bool) {
+	var rule *domain.IPRule
+	remaining := []*domain.IPRule{}
+	for _, existing := range rules {
+		if existing.ID == id {
+			rule = existing
+			continue
+		}
+		remaining = append(remaining, existing)
+	}
+
+	if rule == nil {
+		helpers.NotFoundErrResponse(w, r)
+		return nil, nil, false
+	}
+
+	v := validator.New()
+	if checkKeepsAccess(r, v, remaining); !v.Valid() {
+		helpers.FailedValidationResponse(w, r, v.Errors)
+		return nil, nil, false
+	}
+	return rule, remaining, true
+}
+
+// checkKeepsAccess checks that the rules would still allow the client's IP
+// address.
+func checkKeepsAccess(r *http.Request, v *validator.Validator, rules []*domain.IPRule) {
+	v.Check(ipfilter.Permits(rules, helpers.ClientIP(r)), "cidr", "the rules would deny your own IP address")
+}
+
+// ipRuleAuditEvent returns an audit event about the rule, targeting its
+// organization if it has one.
+func ipRuleAuditEvent(r *http.Request, action string, rule *domain.IPRule) *domain.AuditEvent {
+	event := auditEvent(r, action).
+		With("rule_id", rule.ID).
+		With("cidr", rule.CIDR).
+		With("rule_action", rule.Action)
+	if rule.OrganizationID != "" {
+		event.TargetType, event.TargetID = domain.AuditTargetOrganization, rule.OrganizationID
+	}
+	return event
+}
+
+// sendIPRules responds with the rules.
+func sendIPRules(w http.ResponseWriter, r *http.Request, rules []*domain.IPRule) {
+	err := helpers.SendJSON(w, http.StatusOK, map[string]interface{}{"rules": rules}, nil)
+	if err != nil {
+		helpers.ServerErrReponse(w, r, err)
+	}
+}
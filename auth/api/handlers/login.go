@@ -2,19 +2,25 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/todo-app/api/helpers"
 	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
 	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ipfilter"
+	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/repositories"
 	"github.com/todo-app/internal/services"
+	"github.com/todo-app/pkg/logger"
 )
 
 func Login(app *application.App) http.HandlerFunc {
-	return login(app.IdentityService)
+	return login(app.IdentityService, app.RoleRepository, app.OrganizationRepository, app.DeviceRepository, app.TokenRepository, app.Mailer, newEnumerationGuard(app), app.AuditLog)
 }
 
-func login(service services.IdentityServiceInterface) http.HandlerFunc {
+func login(service services.IdentityServiceInterface, roleRepo repositories.RoleRepositoryInterface, orgRepo repositories.OrganizationRepositoryInterface, deviceRepo repositories.DeviceRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, guard enumerationGuard, auditLog *audit.Log) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var loginReq identity.LoginRequest
@@ -23,27 +29,90 @@ func login(service services.IdentityServiceInterface) http.HandlerFunc {
 			helpers.BadRequestErrResponseWithMsg(w, r, err)
 			return
 		}
+		loginReq.IP = helpers.ClientIP(r)
+		loginReq.UserAgent = r.UserAgent()
+		loginReq.RequestID = helpers.RequestID(r)
 
 		user, err := service.HandleLogin(&loginReq)
 		if err != nil {
+			var lockErr *identity.LockoutError
+			var challenge *identity.ChallengeError
 			switch {
+			case errors.As(err, &challenge):
+				sendConfirmLoginEmail(r, mailer, challenge)
+				response := map[string]interface{}{
+					"confirmationRequired": true,
+					"message":              "please confirm it's you with the token we have emailed you",
+				}
+				err = helpers.SendJSON(w, http.StatusAccepted, response, nil)
+				if err != nil {
+					helpers.ServerErrReponse(w, r, err)
+				}
+			case errors.As(err, &lockErr):
+				if lockErr.UnlockToken != nil {
+					sendAccountLockedEmail(mailer, lockErr)
+				}
+				// Only registered accounts can be locked, so saying so would
+				// reveal that the email address is registered.
+				if lockErr.Account && guard.enabled {
+					helpers.InvalidCredentialsResponse(w, r, err)
+					return
+				}
+				helpers.TooManyRequestsResponse(w, r, lockErr.RetryAfter())
 			case errors.Is(err, identity.ErrInvalidCredentials):
 				helpers.InvalidCredentialsResponse(w, r, err)
 			case errors.Is(err, identity.ErrUserNotActivated):
 				helpers.BadRequestErrResponseWithMsg(w, r, errors.New("you are unable to login due to your account not being activated. Please check your email and activate your account"))
+			case errors.Is(err, identity.ErrAccountSuspended), errors.Is(err, identity.ErrAccountOnHold), errors.Is(err, identity.ErrAccountClosed):
+				helpers.AccountUnavailableResponse(w, r, err)
+			case errors.Is(err, ipfilter.ErrNotAllowed):
+				helpers.IPNotAllowedResponse(w, r, err)
+			case errors.Is(err, identity.ErrPasswordResetRequired):
+				helpers.BadRequestErrResponseWithMsg(w, r, errors.New("you must reset your password before you can login. Please check your email for a password reset token"))
 			default:
 				helpers.ServerErrReponse(w, r, err)
 			}
 			return
 		}
 
-		err = identity.SetCookie(w, user)
+		// Sign them in to the organization they joined first
+		err = startSession(w, user, roleRepo, orgRepo, "")
 		if err != nil {
 			helpers.ServerErrReponse(w, r, err)
 			return
 		}
 
+		// Failing to check the device shouldn't stop them signing in
+		err = notifyNewDevice(r, user, deviceRepo, tokenRepo, mailer, auditLog)
+		if err != nil {
+			logger.Error.Printf("failed checking the device user %s signed in from: %v", user.ID, err)
+		}
+
 		userResponse := user.ToHTTPResponse()
 		helpers.SendJSON(w, http.StatusOK, userResponse, nil)
 	}
 }
+
+// sendAccountLockedEmail lets the user know their account was locked, in the
+// background, with a token to unlock it if it was them.
+func sendAccountLockedEmail(mailer mailer.Mailer, lockErr *identity.LockoutError) {
+	go func() {
+		// Handle any errors from this goroutine as it wont be caught from the
+		// panic recovery middleware
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error.Println(fmt.Errorf("%s", err))
+			}
+		}()
+
+		data := map[string]interface{}{
+			"unlockToken": lockErr.UnlockToken.Plaintext,
+			"lockedUntil": lockErr.Until.UTC().Format("2006-01-02 15:04 MST"),
+		}
+
+		err := mailer.Send(lockErr.User.Email, "account_locked.tmpl", data)
+		if err != nil {
+			logger.Error.Println(err)
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+func ListLogins(app *application.App) http.HandlerFunc {
+	return listLogins(app.LoginEventRepository)
+}
+
+// listLogins returns the signed in user's sign in history, newest first, with
+// the browser, OS and rough location of each attempt, successful or not. It
+// pages like listAuditEvents.
+func listLogins(loginEventRepo repositories.LoginEventRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		v := validator.New()
+		limit, after := readPage(r, v)
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		sendLogins(w, r, loginEventRepo, claims.UserId.String(), limit, after)
+	}
+}
+
+func ListUserLogins(app *application.App) http.HandlerFunc {
+	return listUserLogins(app.UserRepository, app.LoginEventRepository)
+}
+
+// listUserLogins returns a user's sign in history for support, paged like
+// listLogins.
+func listUserLogins(userRepo repositories.UserRepositoryInterface, loginEventRepo repositories.LoginEventRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := readUser(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		v := validator.New()
+		limit, after := readPage(r, v)
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		sendLogins(w, r, loginEventRepo, user.ID.String(), limit, after)
+	}
+}
+
+// sendLogins responds with the page of the user's sign ins.
+func sendLogins(w http.ResponseWriter, r *http.Request, loginEventRepo repositories.LoginEventRepositoryInterface, userId string, limit int, after *repositories.Cursor) {
+	logins, next, err := loginEventRepo.ListForUser(userId, limit, after)
+	if err != nil {
+		switch {
+		case err == repositories.ErrInvalidCursor:
+			v := validator.New()
+			v.AddError("cursor", err.Error())
+			helpers.FailedValidationResponse(w, r, v.Errors)
+		default:
+			helpers.ServerErrReponse(w, r, err)
+		}
+		return
+	}
+
+	metadata := map[string]interface{}{}
+	if next != nil {
+		metadata["next_cursor"] = next.Encode()
+	}
+
+	response := map[string]interface{}{
+		"logins":   logins,
+		"metadata": metadata,
+	}
+	err = helpers.SendJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		helpers.ServerErrReponse(w, r, err)
+	}
+}
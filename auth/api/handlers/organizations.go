@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
+)
+
+// Organizations and their members. The member endpoints always act on the
+// organization the user is signed in to, which is recorded in their token and
+// changed with SwitchOrganization. Their membership is looked up again on every
+// request, as the role in the token may be out of date.
+
+func CreateOrganization(app *application.App) http.HandlerFunc {
+	return createOrganization(app.OrganizationRepository)
+}
+
+func createOrganization(orgRepo repositories.OrganizationRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		var input struct {
+			Name string `json:"name"`
+			Slug string `json:"slug"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		org := &domain.Organization{Name: input.Name, Slug: input.Slug}
+		org.Prepare()
+
+		v := validator.New()
+		if domain.ValidateOrganization(v, org); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = orgRepo.Create(org, claims.UserId.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrDuplicateSlug):
+				v.AddError("slug", err.Error())
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusCreated, org, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func ListOrganizations(app *application.App) http.HandlerFunc {
+	return listOrganizations(app.OrganizationRepository)
+}
+
+func listOrganizations(orgRepo repositories.OrganizationRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		orgs, err := orgRepo.GetForUser(claims.UserId.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, orgs, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func SwitchOrganization(app *application.App) http.HandlerFunc {
+	return switchOrganization(app.IdentityService, app.RoleRepository, app.OrganizationRepository, app.AuditLog)
+}
+
+// switchOrganization reissues the user's token with another organization they
+// are a member of as the one they are signed in to.
+func switchOrganization(service services.IdentityServiceInterface, roleRepo repositories.RoleRepositoryInterface, orgRepo repositories.OrganizationRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		var input struct {
+			OrganizationID string `json:"organizationId"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		if _, err := uuid.Parse(input.OrganizationID); err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		user, err := service.GetUserById(claims.UserId.String())
+		if err != nil {
+			helpers.NotFoundErrResponse(w, r)
+			return
+		}
+
+		err = startSession(w, user, roleRepo, orgRepo, input.OrganizationID)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		event := auditEvent(r, domain.AuditOrganizationSwitched).With("from", claims.OrgID)
+		event.TargetType, event.TargetID = domain.AuditTargetOrganization, input.OrganizationID
+		auditLog.Record(event)
+
+		err = helpers.SendJSON(w, http.StatusOK, user.ToHTTPResponse(), nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+// ----------------------- Members ----------------------- //
+
+func ListMembers(app *application.App) http.HandlerFunc {
+	return listMembers(app.OrganizationRepository)
+}
+
+func listMembers(orgRepo repositories.OrganizationRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tenant, ok := activeMembership(w, r, orgRepo)
+		if !ok {
+			return
+		}
+
+		members, err := orgRepo.ListMembers(tenant)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, members, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func UpdateMember(app *application.App) http.HandlerFunc {
+	return updateMember(app.OrganizationRepository, app.AuditLog)
+}
+
+// updateMember changes the role of a member. Only owners can change the role of
+// an owner, or make someone an owner.
+func updateMember(orgRepo repositories.OrganizationRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor, tenant, ok := activeMembership(w, r, orgRepo, domain.OrgRoleOwner, domain.OrgRoleAdmin)
+		if !ok {
+			return
+		}
+
+		member, ok := readMember(w, r, orgRepo, tenant)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Role string `json:"role"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if domain.ValidateOrgRole(v, input.Role); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		if (input.Role == domain.OrgRoleOwner || member.Role == domain.OrgRoleOwner) && actor.Role != domain.OrgRoleOwner {
+			helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s can't change owners of organization %s", actor.UserID, tenant.OrgID()))
+			return
+		}
+
+		err = orgRepo.UpdateMemberRole(tenant, member.UserID.String(), input.Role)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrLastOwner):
+				helpers.BadRequestErrResponseWithMsg(w, r, err)
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		event := auditEvent(r, domain.AuditOrganizationMemberUpdated).
+			With("organization_id", tenant.OrgID()).
+			With("from", member.Role).
+			With("to", input.Role)
+		event.TargetType, event.TargetID = domain.AuditTargetUser, member.UserID.String()
+		auditLog.Record(event)
+
+		member.Role = input.Role
+
+		err = helpers.SendJSON(w, http.StatusOK, member, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
+
+func RemoveMember(app *application.App) http.HandlerFunc {
+	return removeMember(app.OrganizationRepository, app.AuditLog)
+}
+
+// removeMember takes a user out of the organization. Any member can leave, admins
+// can remove members and other admins, and owners can remove anyone.
+func removeMember(orgRepo repositories.OrganizationRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor, tenant, ok := activeMembership(w, r, orgRepo)
+		if !ok {
+			return
+		}
+
+		member, ok := readMember(w, r, orgRepo, tenant)
+		if !ok {
+			return
+		}
+
+		leaving := member.UserID == actor.UserID
+		canRemove := actor.Role == domain.OrgRoleOwner ||
+			(actor.Role == domain.OrgRoleAdmin && member.Role != domain.OrgRoleOwner)
+		if !leaving && !canRemove {
+			helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s can't remove user %s from organization %s", actor.UserID, member.UserID, tenant.OrgID()))
+			return
+		}
+
+		err := orgRepo.RemoveMember(tenant, member.UserID.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrLastOwner):
+				helpers.BadRequestErrResponseWithMsg(w, r, err)
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		event := auditEvent(r, domain.AuditOrganizationMemberRemoved).
+			With("organization_id", tenant.OrgID()).
+			With("role", member.Role).
+			With("left", leaving)
+		event.TargetType, event.TargetID = domain.AuditTargetUser, member.UserID.String()
+		auditLog.Record(event)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ----------------------- Helpers ----------------------- //
+
+// activeMembership returns the signed in user's membership of the organization
+// in their token, and the tenant to scope queries with. If roles are given the
+// user must have one of them. Otherwise, or if they aren't signed in to an
+// organization they are still a member of, an error response is written and ok
+// is false.
+func activeMembership(w http.ResponseWriter, r *http.Request, orgRepo repositories.OrganizationRepositoryInterface, roles ...string) (member *domain.Membership, tenant repositories.Tenant, ok bool) {
+	claims, ok := identity.GetClaimsFromContext(r.Context())
+	if !ok {
+		helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+		return nil, tenant, false
+	}
+
+	if claims.OrgID == "" {
+		helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s isn't signed in to an organization", claims.UserId))
+		return nil, tenant, false
+	}
+
+	tenant = repositories.NewTenant(claims.OrgID)
+	member, err := orgRepo.GetMember(tenant, claims.UserId.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrRecordNotFound):
+			helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s is no longer a member of organization %s", claims.UserId, claims.OrgID))
+		default:
+			helpers.ServerErrReponse(w, r, err)
+		}
+		return nil, tenant, false
+	}
+
+	if len(roles) == 0 {
+		return member, tenant, true
+	}
+	for _, role := range roles {
+		if member.Role == role {
+			return member, tenant, true
+		}
+	}
+
+	helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s has role %q in organization %s", claims.UserId, member.Role, claims.OrgID))
+	return nil, tenant, false
+}
+
+// readMember returns the member of the tenant's organization in the userId route
+// parameter, writing a not found response if there isn't one.
+func readMember(w http.ResponseWriter, r *http.Request, orgRepo repositories.OrganizationRepositoryInterface, tenant repositories.Tenant) (*domain.Membership, bool) {
+	userId, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		helpers.NotFoundErrResponse(w, r)
+		return nil, false
+	}
+
+	member, err := orgRepo.GetMember(tenant, userId.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrRecordNotFound):
+			helpers.NotFoundErrResponse(w, r)
+		default:
+			helpers.ServerErrReponse(w, r, err)
+		}
+		return nil, false
+	}
+	return member, true
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/todo-app/api/helpers"
 	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
 	"github.com/todo-app/internal/domain"
 	"github.com/todo-app/internal/mailer"
 	"github.com/todo-app/internal/repositories"
@@ -37,12 +38,17 @@ of the user whose password they want to reset.
 
 */
 
+// passwordResetTokenTTL is how long a password reset token can be used for.
+const passwordResetTokenTTL = 45 * time.Minute
+
 func PasswordReset(app *application.App) http.HandlerFunc {
-	return passwordReset(app.UserRepository, app.TokenRepository, app.Mailer)
+	return passwordReset(app.UserRepository, app.TokenRepository, app.Mailer, newEnumerationGuard(app), app.AuditLog)
 }
 
-func passwordReset(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer) http.HandlerFunc {
+func passwordReset(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, guard enumerationGuard, auditLog *audit.Log) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
 		var input struct {
 			Email string `json:"email"`
 		}
@@ -60,11 +66,26 @@ func passwordReset(userRepo repositories.UserRepositoryInterface, tokenRepo repo
 			return
 		}
 
+		response := map[string]interface{}{
+			"success": true,
+			"message": "if an activated account with that email exists, an email will be sent to it containing password reset instructions",
+		}
+		sendResponse := func() {
+			guard.wait(start)
+			err := helpers.SendJSON(w, http.StatusAccepted, response, nil)
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+			}
+		}
+
 		// Try to retrieve the corresponding user record for the email address. If it can't
-		// be found, return an error message to the client.
+		// be found, return an error message to the client, unless that would reveal
+		// which addresses are registered.
 		user, err := userRepo.GetByEmail(input.Email)
 		if err != nil {
 			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound) && guard.enabled:
+				sendResponse()
 			case errors.Is(err, repositories.ErrRecordNotFound):
 				v.AddError("email", "no matching email found")
 				helpers.FailedValidationResponse(w, r, v.Errors)
@@ -74,52 +95,55 @@ func passwordReset(userRepo repositories.UserRepositoryInterface, tokenRepo repo
 			return
 		}
 
-		// Return an error message if the user hasn't activated their account.
-		if !user.Activated {
+		// Return an error message if the user hasn't activated their account, or it
+		// has been suspended or closed. Locked accounts are unlocked by a reset.
+		if user.Status != domain.StatusActive && user.Status != domain.StatusLocked {
+			if guard.enabled {
+				sendResponse()
+				return
+			}
 			v.AddError("email", "an account must be activated")
 			helpers.FailedValidationResponse(w, r, v.Errors)
 			return
 		}
 
 		// Otherwise, create a new password reset token with a 45-minute expiry time.
-		token, err := tokenRepo.New(user.ID.String(), 45*time.Minute, domain.TokenScopePasswordReset)
+		token, err := tokenRepo.New(user.ID.String(), passwordResetTokenTTL, domain.TokenScopePasswordReset)
 		if err != nil {
 			helpers.ServerErrReponse(w, r, err)
 			return
 		}
 
-		// Email the user with their password reset token. Send the email in a background
-		// go routine
-		go func() {
-			// Handle any errors from this goroutine as it wont be caught from the
-			// panic recovery middleware
-			defer func() {
-				if err := recover(); err != nil {
-					logger.Error.Println(fmt.Errorf("%s", err))
-				}
-			}()
-
-			data := map[string]interface{}{
-				"passwordResetToken": token.Plaintext,
-			}
+		// Email the user with their password reset token. We don't know who asked
+		// for it, so the event has no actor.
+		sendPasswordResetEmail(mailer, user.Email, token)
+		auditLog.Record(auditEvent(r, domain.AuditPasswordResetRequested).SetTarget(user))
 
-			mailer.Send(user.Email, "password_reset.tmpl", data)
-			if err != nil {
-				// We just want to log it instead of send an error response
-				// to the client as they might have already gotten the response below.
-				logger.Error.Println(err)
+		sendResponse()
+	}
+}
+
+// sendPasswordResetEmail emails a password reset token to the user, in a
+// background go routine.
+func sendPasswordResetEmail(mailer mailer.Mailer, email string, token *domain.Token) {
+	go func() {
+		// Handle any errors from this goroutine as it wont be caught from the
+		// panic recovery middleware
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error.Println(fmt.Errorf("%s", err))
 			}
 		}()
 
-		response := map[string]interface{}{
-			"success": true,
-			"message": "an email will be sent to you containing password reset instructions",
+		data := map[string]interface{}{
+			"passwordResetToken": token.Plaintext,
 		}
 
-		err = helpers.SendJSON(w, http.StatusAccepted, response, nil)
+		err := mailer.Send(email, "password_reset.tmpl", data)
 		if err != nil {
-			helpers.ServerErrReponse(w, r, err)
+			// We just want to log it instead of send an error response
+			// to the client as they might have already gotten the response.
+			logger.Error.Println(err)
 		}
-
-	}
+	}()
 }
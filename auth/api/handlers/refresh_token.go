@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+)
+
+func RefreshToken(app *application.App) http.HandlerFunc {
+	return refreshToken(app.UserRepository, app.RoleRepository, app.OrganizationRepository, app.AuditLog)
+}
+
+// refreshToken issues the signed in user a new token, as long as their account
+// can still be used. The new token picks up any changes to their roles and
+// organization membership since the old one was issued. They stay signed in to
+// the same organization, unless they have since left it.
+func refreshToken(userRepo repositories.UserRepositoryInterface, roleRepo repositories.RoleRepositoryInterface, orgRepo repositories.OrganizationRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		user, err := userRepo.GetById(claims.UserId.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.UnauthorizedErrResponse(w, r, err)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		if err := identity.CheckStatus(user.Status); err != nil {
+			helpers.AccountUnavailableResponse(w, r, err)
+			return
+		}
+
+		err = startSession(w, user, roleRepo, orgRepo, claims.OrgID)
+		if errors.Is(err, repositories.ErrRecordNotFound) {
+			err = startSession(w, user, roleRepo, orgRepo, "")
+		}
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		auditLog.Record(userAuditEvent(r, domain.AuditTokenRefreshed, user))
+
+		err = helpers.SendJSON(w, http.StatusOK, user.ToHTTPResponse(), nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
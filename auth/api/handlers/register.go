@@ -10,6 +10,7 @@ import (
 	"github.com/todo-app/pkg/logger"
 
 	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
 	"github.com/todo-app/internal/domain"
 	"github.com/todo-app/internal/mailer"
 	"github.com/todo-app/internal/repositories"
@@ -17,8 +18,13 @@ import (
 	"github.com/todo-app/internal/validator"
 )
 
-func register(service services.IdentityServiceInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer) http.HandlerFunc {
+// activationTokenTTL is how long a user has to activate their account using
+// the token sent in the welcome email.
+const activationTokenTTL = 3 * 24 * time.Hour
+
+func register(service services.IdentityServiceInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, passwordPolicy *validator.PasswordPolicy, guard enumerationGuard, auditLog *audit.Log) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 
 		var user domain.User
 
@@ -35,17 +41,37 @@ func register(service services.IdentityServiceInterface, tokenRepo repositories.
 		v.Check(user.FirstName != "", "firstName", "first name is required")
 		v.Check(user.LastName != "", "lastName", "last name is required")
 		v.Check(v.Matches(user.Email, validator.EmailRX), "email", "invalid email")
-		v.Check(len([]rune(user.Password)) >= 6, "password", "password must be atleast 6 characters")
+		passwordPolicy.Validate(v, "password", user.Password, user.FirstName, user.LastName, user.Email)
 
 		if !v.Valid() {
 			helpers.FailedValidationResponse(w, r, v.Errors)
 			return
 		}
 
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Please check your email to confirm your registration",
+		}
+		// Set the header as 202 Accepted to indicate that the request
+		// has been accepted for processing but may not be complete because
+		// the email could still be sending.
+		sendResponse := func() {
+			guard.wait(start)
+			err := helpers.SendJSON(w, http.StatusAccepted, response, nil)
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+			}
+		}
+
 		createdUser, err := service.HandleRegister(&user)
 
 		if err != nil {
 			switch {
+			case errors.Is(err, repositories.ErrDuplicateEmail) && guard.enabled:
+				// Rather than telling whoever is registering that the address is
+				// taken, let its owner know, and respond as if it was a success.
+				sendAccountExistsEmail(mailer, user.Email)
+				sendResponse()
 			case errors.Is(err, repositories.ErrDuplicateEmail):
 				helpers.BadRequestErrResponseWithMsg(w, r, err)
 			default:
@@ -54,9 +80,11 @@ func register(service services.IdentityServiceInterface, tokenRepo repositories.
 			return
 		}
 
+		auditLog.Record(userAuditEvent(r, domain.AuditUserRegistered, createdUser))
+
 		// After the user record has been created in the database, generate a new activation
 		// token for the user.
-		token, err := tokenRepo.New(createdUser.ID.String(), 3*24*time.Hour, domain.TokenScopeActivation)
+		token, err := tokenRepo.New(createdUser.ID.String(), activationTokenTTL, domain.TokenScopeActivation)
 		if err != nil {
 			helpers.ServerErrReponse(w, r, err)
 			return
@@ -86,22 +114,30 @@ func register(service services.IdentityServiceInterface, tokenRepo repositories.
 			}
 		}()
 
-		response := map[string]interface{}{
-			"success": true,
-			"message": "Please check your email to confirm your registration",
-		}
-		// Set the header as 202 Accepted to indicate that the request
-		// has been accepted for processing but may not be complete because
-		// the email could still be sending.
-		err = helpers.SendJSON(w, http.StatusAccepted, response, nil)
-		if err != nil {
-			helpers.ServerErrReponse(w, r, err)
-		}
-
+		sendResponse()
 	}
 
 }
 
 func Register(app *application.App) http.HandlerFunc {
-	return register(app.IdentityService, app.TokenRepository, app.Mailer)
+	return register(app.IdentityService, app.TokenRepository, app.Mailer, app.PasswordPolicy, newEnumerationGuard(app), app.AuditLog)
+}
+
+// sendAccountExistsEmail tells the owner of an email address that someone tried
+// to register a new account with it, in the background.
+func sendAccountExistsEmail(mailer mailer.Mailer, email string) {
+	go func() {
+		// Handle any errors from this goroutine as it wont be caught from the
+		// panic recovery middleware
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error.Println(fmt.Errorf("%s", err))
+			}
+		}()
+
+		err := mailer.Send(email, "account_exists.tmpl", nil)
+		if err != nil {
+			logger.Error.Println(err)
+		}
+	}()
 }
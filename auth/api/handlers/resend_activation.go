@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+	"github.com/todo-app/pkg/logger"
+)
+
+/** Workflow for resending an activation email:
+
+1. A client sends a request to the POST /v1/user/activation/resend endpoint containing
+   the email address the account was registered with.
+
+2. Whatever happens next, the client always gets the same 202 Accepted response, so the
+   endpoint can't be used to find out which email addresses are registered or activated.
+   In enumeration-safe mode the response is also held back to a minimum response time.
+
+3. If a user with that email exists and is not activated yet, we check when the current
+   activation token was issued. If it was less than activationResendCooldown ago we don't
+   send another one, which rate limits the endpoint per address.
+
+4. Otherwise we delete all existing activation tokens for the user, generate a new one and
+   send the welcome email again.
+
+*/
+
+// activationResendCooldown is the minimum time between two activation emails for the same address.
+const activationResendCooldown = 5 * time.Minute
+
+func ResendActivation(app *application.App) http.HandlerFunc {
+	return resendActivation(app.UserRepository, app.TokenRepository, app.Mailer, newEnumerationGuard(app))
+}
+
+func resendActivation(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, guard enumerationGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		var input struct {
+			Email string `json:"email"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		v.Check(v.Matches(input.Email, validator.EmailRX), "email", "invalid email")
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		// Every outcome below ends with this same response.
+		response := map[string]interface{}{
+			"success": true,
+			"message": "if an account with that email is awaiting activation, a new activation email will be sent to it",
+		}
+		sendResponse := func() {
+			guard.wait(start)
+			err := helpers.SendJSON(w, http.StatusAccepted, response, nil)
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+			}
+		}
+
+		user, err := userRepo.GetByEmail(input.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				sendResponse()
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		if user.Status != domain.StatusPending {
+			sendResponse()
+			return
+		}
+
+		tokens, err := tokenRepo.GetAllForUser(user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		// Tokens don't record when they were created, but every activation token is
+		// issued with the same ttl so we can work it out from the expiry.
+		for _, t := range tokens {
+			if t.Scope != domain.TokenScopeActivation {
+				continue
+			}
+			issuedAt := t.Expiry.Add(-activationTokenTTL)
+			if time.Since(issuedAt) < activationResendCooldown {
+				logger.Info.Printf("activation email for user %s was resent less than %s ago, skipping", user.ID, activationResendCooldown)
+				sendResponse()
+				return
+			}
+		}
+
+		// Replace any existing activation tokens so only the newest email works.
+		err = tokenRepo.DeleteAllForUser(domain.TokenScopeActivation, user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		token, err := tokenRepo.New(user.ID.String(), activationTokenTTL, domain.TokenScopeActivation)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		go func() {
+			// Handle any errors from this goroutine as it wont be caught from the
+			// panic recovery middleware
+			defer func() {
+				if err := recover(); err != nil {
+					logger.Error.Println(fmt.Errorf("%s", err))
+				}
+			}()
+
+			data := map[string]interface{}{
+				"activationToken": token.Plaintext,
+				"user":            user,
+			}
+
+			err := mailer.Send(user.Email, "user_welcome.tmpl", data)
+			if err != nil {
+				logger.Error.Println(err)
+			}
+		}()
+
+		sendResponse()
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/testutil"
+)
+
+// activationMailer hands over the token of every activation email sent.
+type activationMailer struct {
+	tokens chan string
+}
+
+func (m *activationMailer) Send(recipient, templateFile string, data interface{}) error {
+	m.tokens <- data.(map[string]interface{})["activationToken"].(string)
+	return nil
+}
+
+func TestResendActivation(t *testing.T) {
+	tests := []struct {
+		name string
+		// status of the account, or "" for an email that isn't registered
+		status string
+		// issued is how long ago the current activation token was sent, 0 for none
+		issued    time.Duration
+		wantEmail bool
+	}{
+		{name: "Unknown email", status: "", wantEmail: false},
+		{name: "Already active", status: domain.StatusActive, wantEmail: false},
+		{name: "Rate limited", status: domain.StatusPending, issued: time.Minute, wantEmail: false},
+		{name: "Resent", status: domain.StatusPending, issued: activationResendCooldown + time.Minute, wantEmail: true},
+		{name: "No current token", status: domain.StatusPending, wantEmail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.SetupUserTable(db)
+			testutil.SetupLoginTables(db)
+			t.Cleanup(func() {
+				testutil.TeardownLoginTables(db, t)
+				testutil.TeardownUserTable(db, t)
+			})
+
+			userRepo := repositories.NewUserRepository(db)
+			tokenRepo := repositories.NewTokenRepository(db)
+			mailer := &activationMailer{tokens: make(chan string, 1)}
+
+			email := testutil.MakeRandEmail()
+			var oldToken *domain.Token
+			if tt.status != "" {
+				user := &domain.User{FirstName: "Jane", LastName: "Doe", Email: email, Password: "password", Status: tt.status}
+				user.Prepare()
+				user, err := userRepo.Create(user)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.issued > 0 {
+					// The handler works out when a token was issued from its expiry
+					oldToken, err = tokenRepo.New(user.ID.String(), activationTokenTTL-tt.issued, domain.TokenScopeActivation)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			rr := httptest.NewRecorder()
+			r := jsonRequest(t, http.MethodPost, map[string]string{"email": email})
+			resendActivation(userRepo, tokenRepo, mailer, enumerationGuard{}).ServeHTTP(rr, r)
+
+			// The response is the same whatever happened
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("want status %d; got %d: %s", http.StatusAccepted, rr.Code, rr.Body)
+			}
+
+			if !tt.wantEmail {
+				// The email is only ever sent after the handler has decided to
+				select {
+				case <-mailer.tokens:
+					t.Fatal("expected no activation email to be sent")
+				default:
+				}
+				if oldToken != nil {
+					if _, err := userRepo.GetForToken(domain.TokenScopeActivation, oldToken.Plaintext); err != nil {
+						t.Errorf("expected the current token to still work, err: %v", err)
+					}
+				}
+				return
+			}
+
+			var token string
+			select {
+			case token = <-mailer.tokens:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the activation email was never sent")
+			}
+
+			user, err := userRepo.GetForToken(domain.TokenScopeActivation, token)
+			if err != nil {
+				t.Fatalf("expected the emailed token to activate the account, err: %v", err)
+			}
+			if user.Email != email {
+				t.Errorf("want the token for %q; got %q", email, user.Email)
+			}
+			if oldToken != nil {
+				if _, err := userRepo.GetForToken(domain.TokenScopeActivation, oldToken.Plaintext); err != repositories.ErrRecordNotFound {
+					t.Errorf("old token: want %v; got %v", repositories.ErrRecordNotFound, err)
+				}
+			}
+		})
+	}
+}
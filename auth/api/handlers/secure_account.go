@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/device"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+	"github.com/todo-app/pkg/logger"
+)
+
+/** Workflow for a sign in from a new device:
+
+1. When a user signs in from a device or network they haven't signed in from before, we email them
+   what it was and a token to secure their account in case it wasn't them. Their very first sign in
+   isn't reported, as there is nothing to compare it to.
+
+2. If it wasn't them, they submit the token to the POST /v1/user/secure endpoint.
+
+3. Their account is locked until they reset their password, every token issued to them so far is
+   revoked, which signs out whoever else has them, and we email them a password reset token.
+
+4. We delete all their secure account tokens.
+
+*/
+
+// secureAccountTokenTTL is how long after a sign in it can be reported.
+const secureAccountTokenTTL = 7 * 24 * time.Hour
+
+// notifyNewDevice remembers the device the user signed in from, and emails them
+// if they haven't signed in from it before.
+func notifyNewDevice(r *http.Request, user *domain.User, deviceRepo repositories.DeviceRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, auditLog *audit.Log) error {
+	d := device.Identify(r.UserAgent(), helpers.ClientIP(r))
+	d.UserID = user.ID.String()
+
+	isNew, err := deviceRepo.Touch(d)
+	if err != nil || !isNew {
+		return err
+	}
+
+	devices, err := deviceRepo.GetAllForUser(user.ID.String())
+	if err != nil || len(devices) < 2 {
+		return err
+	}
+
+	token, err := tokenRepo.New(user.ID.String(), secureAccountTokenTTL, domain.TokenScopeSecureAccount)
+	if err != nil {
+		return err
+	}
+
+	auditLog.Record(userAuditEvent(r, domain.AuditLoginNewDevice, user).
+		With("device", d.Description()).
+		With("network", d.Network))
+
+	sendNewSignInEmail(mailer, user.Email, d, token)
+	return nil
+}
+
+// sendNewSignInEmail tells the user about a sign in from a new device, in a
+// background go routine.
+func sendNewSignInEmail(mailer mailer.Mailer, email string, d *domain.Device, token *domain.Token) {
+	go func() {
+		// Handle any errors from this goroutine as it wont be caught from the
+		// panic recovery middleware
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error.Println(fmt.Errorf("%s", err))
+			}
+		}()
+
+		data := map[string]interface{}{
+			"device":             d.Description(),
+			"network":            d.Network,
+			"ip":                 d.IP,
+			"signedInAt":         d.LastSeenAt.UTC().Format("2006-01-02 15:04 MST"),
+			"secureAccountToken": token.Plaintext,
+		}
+
+		err := mailer.Send(email, "new_sign_in.tmpl", data)
+		if err != nil {
+			logger.Error.Println(err)
+		}
+	}()
+}
+
+func SecureAccount(app *application.App) http.HandlerFunc {
+	return secureAccount(app.UserRepository, app.TokenRepository, app.Mailer, app.AuditLog)
+}
+
+func secureAccount(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, mailer mailer.Mailer, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			TokenPlainText string `json:"token"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		if domain.ValidateTokenPlainText(v, input.TokenPlainText); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		user, err := userRepo.GetForToken(domain.TokenScopeSecureAccount, input.TokenPlainText)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				v.AddError("token", "invalid or expired token")
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		// Accounts that are already locked, suspended or closed stay as they are
+		from := user.Status
+		if from == domain.StatusActive {
+			err = user.SetStatus(domain.StatusLocked, "the user reported a sign in that wasn't them")
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+				return
+			}
+
+			err = userRepo.Update(user)
+			if err != nil {
+				helpers.ServerErrReponse(w, r, err)
+				return
+			}
+		}
+
+		err = userRepo.RevokeSessions(user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = tokenRepo.DeleteAllForUser(domain.TokenScopeSecureAccount, user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		token, err := tokenRepo.New(user.ID.String(), passwordResetTokenTTL, domain.TokenScopePasswordReset)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+		sendPasswordResetEmail(mailer, user.Email, token)
+
+		auditLog.Record(userAuditEvent(r, domain.AuditAccountSecured, user))
+		if from != user.Status {
+			auditLog.Record(userAuditEvent(r, domain.AuditUserStatusChanged, user).
+				With("from", from).
+				With("to", user.Status).
+				With("reason", user.StatusReason))
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "you have been signed out everywhere, and we have emailed you a token to reset your password",
+		}
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
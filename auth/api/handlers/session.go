@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+)
+
+// startSession signs the user in by setting their auth cookie. Their token
+// carries their roles and permissions, and the organization with the given id as
+// the one they are signed in to. With an empty orgId their oldest membership is
+// used. repositories.ErrRecordNotFound is returned if they aren't a member of orgId.
+func startSession(w http.ResponseWriter, user *domain.User, roleRepo repositories.RoleRepositoryInterface, orgRepo repositories.OrganizationRepositoryInterface, orgId string) error {
+	if err := loadSession(user, roleRepo, orgRepo, orgId); err != nil {
+		return err
+	}
+	return identity.SetCookie(w, user)
+}
+
+// loadSession loads what goes in the user's token besides their account: their
+// roles and permissions, and the organization they are signed in to.
+func loadSession(user *domain.User, roleRepo repositories.RoleRepositoryInterface, orgRepo repositories.OrganizationRepositoryInterface, orgId string) error {
+	var err error
+	user.Roles, user.Permissions, err = roleRepo.GetNamesForUser(user.ID.String())
+	if err != nil {
+		return err
+	}
+
+	user.OrgID, user.OrgRole = "", ""
+	if orgId != "" {
+		member, err := orgRepo.GetMember(repositories.NewTenant(orgId), user.ID.String())
+		if err != nil {
+			return err
+		}
+		user.OrgID, user.OrgRole = member.OrganizationID.String(), member.Role
+	} else {
+		orgs, err := orgRepo.GetForUser(user.ID.String())
+		if err != nil {
+			return err
+		}
+		if len(orgs) > 0 {
+			user.OrgID, user.OrgRole = orgs[0].ID.String(), orgs[0].Role
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+/** Workflow for unlocking an account:
+
+1. After too many failed sign ins in a row an account is locked, and the user is emailed
+   an unlock token.
+
+2. The user submits the plaintext token to the POST /v1/user/unlock endpoint.
+
+3. If the token is valid and hasn't expired, the user's failed sign in count and lock
+   are cleared so they can sign in again straight away.
+
+4. We delete all unlock tokens for the user.
+
+*/
+
+func UnlockAccount(app *application.App) http.HandlerFunc {
+	return unlockAccount(app.UserRepository, app.TokenRepository, app.LoginAttemptRepository, app.AuditLog)
+}
+
+func unlockAccount(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, attemptRepo repositories.LoginAttemptRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			TokenPlainText string `json:"token"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		if domain.ValidateTokenPlainText(v, input.TokenPlainText); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		user, err := userRepo.GetForToken(domain.TokenScopeUnlock, input.TokenPlainText)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				v.AddError("token", "invalid or expired unlock token")
+				helpers.FailedValidationResponse(w, r, v.Errors)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		err = attemptRepo.ResetUser(user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		err = tokenRepo.DeleteAllForUser(domain.TokenScopeUnlock, user.ID.String())
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+			return
+		}
+
+		auditLog.Record(userAuditEvent(r, domain.AuditAccountUnlocked, user))
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "your account has been unlocked",
+		}
+		err = helpers.SendJSON(w, http.StatusOK, response, nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+func UpdateCurrentUser(app *application.App) http.HandlerFunc {
+	return updateCurrentUser(app.UserRepository, app.AuditLog)
+}
+
+// updateCurrentUser applies a partial update to the profile of the logged in user.
+// Only the fields present in the request body are changed, so a body of
+// {"firstName": "Jane"} leaves the last name untouched.
+func updateCurrentUser(userRepo repositories.UserRepositoryInterface, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		// Use pointers so that we can tell the difference between a field that
+		// was not provided (nil) and one that was provided as an empty string.
+		var input struct {
+			FirstName *string `json:"firstName"`
+			LastName  *string `json:"lastName"`
+		}
+
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.BadRequestErrResponseWithMsg(w, r, err)
+			return
+		}
+
+		user, err := userRepo.GetById(claims.UserId.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.NotFoundErrResponse(w, r)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		// Record which fields were sent, but not their values, in the audit log
+		fields := []string{}
+		if input.FirstName != nil {
+			user.FirstName = strings.TrimSpace(*input.FirstName)
+			fields = append(fields, "firstName")
+		}
+		if input.LastName != nil {
+			user.LastName = strings.TrimSpace(*input.LastName)
+			fields = append(fields, "lastName")
+		}
+
+		v := validator.New()
+		v.Check(user.FirstName != "", "firstName", "first name is required")
+		v.Check(len([]rune(user.FirstName)) <= 100, "firstName", "first name must not be more than 100 characters")
+		v.Check(user.LastName != "", "lastName", "last name is required")
+		v.Check(len([]rune(user.LastName)) <= 100, "lastName", "last name must not be more than 100 characters")
+
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = userRepo.Update(user)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrEditConflict):
+				helpers.UnprocessableErrResponse(w, r, err)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+
+		if len(fields) > 0 {
+			auditLog.Record(userAuditEvent(r, domain.AuditUserUpdated, user).With("fields", fields))
+		}
+
+		err = helpers.SendJSON(w, http.StatusOK, user.ToHTTPResponse(), nil)
+		if err != nil {
+			helpers.ServerErrReponse(w, r, err)
+		}
+	}
+}
@@ -6,17 +6,18 @@ import (
 
 	"github.com/todo-app/api/helpers"
 	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/audit"
 	"github.com/todo-app/internal/domain"
 	"github.com/todo-app/internal/repositories"
 	"github.com/todo-app/internal/validator"
 )
 
 func UpdateUserPasswordHandler(app *application.App) http.HandlerFunc {
-	return updateUserPasswordHandler(app.UserRepository, app.TokenRepository)
+	return updateUserPasswordHandler(app.UserRepository, app.TokenRepository, app.PasswordPolicy, app.AuditLog)
 }
 
 // Verify the password reset token and set a new password for the user.
-func updateUserPasswordHandler(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface) http.HandlerFunc {
+func updateUserPasswordHandler(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, passwordPolicy *validator.PasswordPolicy, auditLog *audit.Log) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var input struct {
 			Password       string `json:"password"`
@@ -31,7 +32,7 @@ func updateUserPasswordHandler(userRepo repositories.UserRepositoryInterface, to
 		v := validator.New()
 
 		domain.ValidateTokenPlainText(v, input.TokenPlaintext)
-		v.Check(len([]rune(input.Password)) >= 6, "password", "password must be atleast 6 characters")
+		v.Check(input.Password != "", "password", "must be provided")
 
 		if !v.Valid() {
 			helpers.FailedValidationResponse(w, r, v.Errors)
@@ -52,9 +53,24 @@ func updateUserPasswordHandler(userRepo repositories.UserRepositoryInterface, to
 			return
 		}
 
+		// Now that we know who the password belongs to, check it against the password
+		// policy, including how similar it is to the user's name and email.
+		if passwordPolicy.Validate(v, "password", input.Password, user.FirstName, user.LastName, user.Email); !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
 		// Set the new password for the user and hash it
 		user.Password = input.Password
 		user.HashPassword()
+		user.PasswordResetRequired = false
+		// Resetting the password is how users regain access to an account locked
+		// because it may have been compromised.
+		event := userAuditEvent(r, domain.AuditPasswordResetCompleted, user)
+		if user.Status == domain.StatusLocked {
+			user.SetStatus(domain.StatusActive, "unlocked by a password reset")
+			event.With("unlocked", true)
+		}
 		// Save the updated user record in our database, checking for any edit conflicts as
 		// normal.
 		err = userRepo.Update(user)
@@ -68,6 +84,8 @@ func updateUserPasswordHandler(userRepo repositories.UserRepositoryInterface, to
 			return
 		}
 
+		auditLog.Record(event)
+
 		// If everything was successful, delete all password reset tokens for the user
 		err = tokenRepo.DeleteAllForUser(domain.TokenScopePasswordReset, user.ID.String())
 		if err != nil {
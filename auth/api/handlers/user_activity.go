@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+func ListActivity(app *application.App) http.HandlerFunc {
+	return listActivity(app.AuditRepository)
+}
+
+// listActivity returns the audit events by or about the signed in user, newest
+// first, so they can check for activity on their account they don't recognise.
+// It pages like listAuditEvents.
+func listActivity(auditRepo repositories.AuditRepositoryInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.ServerErrReponse(w, r, errors.New("failed getting user claims context from request"))
+			return
+		}
+
+		v := validator.New()
+		filter := repositories.AuditFilter{UserID: claims.UserId.String()}
+		readAuditPage(r, v, &filter)
+
+		if !v.Valid() {
+			helpers.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		sendAuditEvents(w, r, auditRepo, filter)
+	}
+}
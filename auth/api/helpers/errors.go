@@ -2,7 +2,10 @@ package helpers
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/todo-app/pkg/logger"
 )
@@ -67,6 +70,28 @@ func UnauthorizedErrResponse(w http.ResponseWriter, r *http.Request, err error)
 	errResponse(w, r, http.StatusUnauthorized, unauthorizedMsg)
 }
 
+// ForbiddenErrResponse writes a Status Code of 403 - StatusForbidden, for authenticated
+// users without permission to access the resource.
+func ForbiddenErrResponse(w http.ResponseWriter, r *http.Request, err error) {
+	logger.Error.Printf("FORBIDDEN - %v", err)
+	errResponse(w, r, http.StatusForbidden, "you do not have permission to access this resource")
+}
+
+// AccountUnavailableResponse writes a Status Code of 403 - StatusForbidden, for users
+// whose account can't be used because of its status, e.g. because it was suspended.
+// The error says why, and is included in the response.
+func AccountUnavailableResponse(w http.ResponseWriter, r *http.Request, err error) {
+	logger.Error.Printf("ACCOUNT UNAVAILABLE - %v", err)
+	errResponse(w, r, http.StatusForbidden, err.Error())
+}
+
+// IPNotAllowedResponse writes a Status Code of 403 - StatusForbidden, for clients
+// whose IP address isn't allowed access by the IP rules.
+func IPNotAllowedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	logger.Error.Printf("IP NOT ALLOWED - %s: %v", ClientIP(r), err)
+	errResponse(w, r, http.StatusForbidden, err.Error())
+}
+
 func InvalidCredentialsResponse(w http.ResponseWriter, r *http.Request, err error) {
 	logger.Error.Println(err)
 	errResponse(w, r, http.StatusUnauthorized, "invalid credentials")
@@ -79,6 +104,13 @@ func MethodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	errResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
+// TooManyRequestsResponse writes a Status Code of 429 - StatusTooManyRequests, and
+// tells the client how many seconds to wait before trying again in the Retry-After header.
+func TooManyRequestsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	errResponse(w, r, http.StatusTooManyRequests, "too many requests, please try again later")
+}
+
 func FailedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	errResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+var clientIPCtxKey = &requestContextKey{"client_ip"}
+
+// WithClientIP returns a copy of the request carrying the client's IP address,
+// see ClientIP.
+func WithClientIP(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPCtxKey, ip))
+}
+
+// ClientIP returns the IP address of the client that made the request, as
+// resolved by the ClientIP middleware from the headers of trusted proxies.
+// Requests it hasn't seen fall back to the address of the peer.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPCtxKey).(string); ok {
+		return ip
+	}
+	return PeerIP(r)
+}
+
+// PeerIP returns the IP address of whoever connected to the service, which is a
+// proxy rather than the client when there is one in front of it.
+func PeerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/todo-app/internal/validator"
+)
+
+// ReadIDParam reads a positive integer id from the named route parameter.
+func ReadIDParam(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid " + name + " parameter")
+	}
+	return id, nil
+}
+
+// ReadUUIDParam reads a uuid, such as a user id, from the named route parameter.
+func ReadUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(r)[name])
+	if err != nil {
+		return uuid.Nil, errors.New("invalid " + name + " parameter")
+	}
+	return id, nil
+}
+
+// ReadQueryString returns the value of a query string parameter, or
+// defaultValue if it isn't set.
+func ReadQueryString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
+
+// ReadQueryInt returns the value of a query string parameter as an integer, or
+// defaultValue if it isn't set. If it isn't an integer an error is added to v.
+func ReadQueryInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// ReadQueryBool returns the value of a query string parameter as a boolean, or
+// nil if it isn't set. If it isn't a boolean an error is added to v.
+func ReadQueryBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return nil
+	}
+	return &b
+}
+
+// ReadQueryTime returns the value of a query string parameter as an RFC 3339
+// time, or the zero time if it isn't set. If it isn't a valid time an error is
+// added to v.
+func ReadQueryTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 time, e.g. 2006-01-02T15:04:05Z")
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,24 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+)
+
+type requestContextKey struct {
+	name string
+}
+
+var requestIDCtxKey = &requestContextKey{"request_id"}
+
+// WithRequestID returns a copy of the request carrying its id, see RequestID.
+func WithRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDCtxKey, id))
+}
+
+// RequestID returns the id given to the request by the RequestID middleware,
+// or an empty string if it hasn't been given one.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDCtxKey).(string)
+	return id
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/ipfilter"
+)
+
+// ClientIP resolves the IP address of the client that made the request and
+// stores it in the request context for helpers.ClientIP, so that logging, rate
+// limiting, IP rules and the audit log all see the same address. Behind the
+// trusted proxies it is read from the header they record it in, one of
+// Forwarded, X-Forwarded-For or X-Real-IP. Any other of them, and all of them
+// from anywhere else, are ignored as the client could have made them up.
+func ClientIP(proxies ipfilter.List, header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, helpers.WithClientIP(r, resolveClientIP(r, proxies, header)))
+		})
+	}
+}
+
+// resolveClientIP walks back through the addresses the proxies recorded, from
+// the one that connected to us, until it finds one that isn't a trusted proxy.
+// Addresses further back were recorded by proxies we don't trust, and could be
+// forged. If a proxy recorded something that isn't an address, e.g. "unknown",
+// the last trusted proxy is the best we know.
+func resolveClientIP(r *http.Request, proxies ipfilter.List, header string) string {
+	ip := helpers.PeerIP(r)
+	if !isTrusted(ip, proxies) {
+		return ip
+	}
+
+	var hops []string
+	if header == "Forwarded" {
+		hops = forwardedFor(r.Header)
+	} else {
+		hops = splitList(r.Header.Values(header))
+	}
+
+	for i := len(hops) - 1; i >= 0 && isTrusted(ip, proxies); i-- {
+		hop := parseHop(hops[i])
+		if hop == "" {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+func isTrusted(ip string, proxies ipfilter.List) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && proxies.Contains(parsed)
+}
+
+// forwardedFor returns the for parameters of the Forwarded header (RFC 7239),
+// one per proxy, or nil if there is no header.
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	for _, element := range splitList(header.Values("Forwarded")) {
+		hop := ""
+		for _, pair := range strings.Split(element, ";") {
+			name, value := pair, ""
+			if i := strings.IndexByte(pair, '='); i >= 0 {
+				name, value = pair[:i], pair[i+1:]
+			}
+			if strings.EqualFold(strings.TrimSpace(name), "for") {
+				hop = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// splitList splits comma separated header values into their trimmed elements,
+// returning nil if there aren't any.
+func splitList(values []string) []string {
+	var elements []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			if element = strings.TrimSpace(element); element != "" {
+				elements = append(elements, element)
+			}
+		}
+	}
+	return elements
+}
+
+// parseHop returns the IP address recorded for a hop, without the port the
+// Forwarded header may include, e.g. "192.0.2.1:4711" or "[2001:db8::1]:4711".
+// It returns an empty string for anything else.
+func parseHop(hop string) string {
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+
+	ip := net.ParseIP(hop)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ipfilter"
+)
+
+// IPFilter refuses requests from IP addresses the rules of the whole service
+// don't allow, before they reach any handler.
+func IPFilter(filter *ipfilter.Filter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !checkIP(w, r, filter) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RestrictOrganizationIP refuses requests from IP addresses the rules of the
+// organization the user is signed in to don't allow, so that a session started
+// on the organization's network can't be used from outside it. It must be
+// applied inside AuthenticationMiddleware.
+func RestrictOrganizationIP(filter *ipfilter.Filter) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := identity.GetClaimsFromContext(r.Context())
+			if !ok {
+				helpers.UnauthorizedErrResponse(w, r, errors.New("no user claims in request context"))
+				return
+			}
+
+			if claims.OrgID != "" && !checkIP(w, r, filter, claims.OrgID) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkIP checks the client's IP address against the rules, writing the error
+// response if it isn't allowed.
+func checkIP(w http.ResponseWriter, r *http.Request, filter *ipfilter.Filter, orgIds ...string) bool {
+	err := filter.Check(helpers.ClientIP(r), orgIds...)
+	if err != nil {
+		switch {
+		case errors.Is(err, ipfilter.ErrNotAllowed):
+			helpers.IPNotAllowedResponse(w, r, err)
+		default:
+			helpers.ServerErrReponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
@@ -2,11 +2,18 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"time"
 
 	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/domain"
 	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
 	"github.com/todo-app/pkg/logger"
 )
 
@@ -21,7 +28,7 @@ func SecureHeaders(next http.Handler) http.Handler {
 
 func RequestLog(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Info.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		logger.Info.Printf("%s - %s %s %s %s", helpers.ClientIP(r), helpers.RequestID(r), r.Proto, r.Method, r.URL.RequestURI())
 
 		next.ServeHTTP(w, r)
 	})
@@ -47,10 +54,32 @@ func PanicRecovery(next http.Handler) http.Handler {
 	})
 }
 
-// AuthenticationMiddleware purposefully returns a http.HandlerFunc rather
-// than an http.handler so that it can be applied to individual routes and
-// not used on every single route.
-func AuthenticationMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// AccountStatuses looks up the current status of a user's account and when they
+// last revoked their sessions, see repositories.UserRepositoryInterface.
+type AccountStatuses interface {
+	GetSessionState(userId string) (*domain.SessionState, error)
+}
+
+// ImpersonationSessions looks up impersonation sessions, see
+// repositories.ImpersonationRepositoryInterface.
+type ImpersonationSessions interface {
+	Get(id int64) (*domain.ImpersonationSession, error)
+}
+
+// AuthenticationMiddleware returns a middleware that purposefully returns a
+// http.HandlerFunc rather than an http.handler so that it can be applied to
+// individual routes and not used on every single route. Besides checking the
+// user's token it looks up the status of their account, so a suspended or
+// closed account, or a revoked token, is refused straight away rather than once
+// the token expires. The same goes for an impersonation token whose session has
+// been stopped.
+func AuthenticationMiddleware(accounts AccountStatuses, sessions ImpersonationSessions) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return authenticate(accounts, sessions, next)
+	}
+}
+
+func authenticate(accounts AccountStatuses, sessions ImpersonationSessions, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.Info.Println("Hello from auth middleware")
 
@@ -67,12 +96,48 @@ func AuthenticationMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Make sure that the user is activated - if not throw an error
-		if !claims.Activated {
-			helpers.UnauthorizedErrResponse(w, r, err)
+		// Make sure that the account can still be used - if not throw an error
+		state, err := accounts.GetSessionState(claims.UserId.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrRecordNotFound):
+				helpers.UnauthorizedErrResponse(w, r, err)
+			default:
+				helpers.ServerErrReponse(w, r, err)
+			}
+			return
+		}
+		if state.Revoked(time.Unix(claims.IssuedAt, 0)) {
+			helpers.UnauthorizedErrResponse(w, r, identity.ErrSessionRevoked)
+			return
+		}
+		if err := identity.CheckStatus(state.Status); err != nil {
+			switch {
+			case errors.Is(err, identity.ErrUserNotActivated):
+				helpers.UnauthorizedErrResponse(w, r, err)
+			default:
+				helpers.AccountUnavailableResponse(w, r, err)
+			}
 			return
 		}
 
+		if claims.Impersonating() {
+			session, err := sessions.Get(claims.Act.SessionID)
+			if err != nil {
+				switch {
+				case errors.Is(err, repositories.ErrRecordNotFound):
+					helpers.UnauthorizedErrResponse(w, r, err)
+				default:
+					helpers.ServerErrReponse(w, r, err)
+				}
+				return
+			}
+			if session.EndedAt != nil {
+				helpers.UnauthorizedErrResponse(w, r, identity.ErrImpersonationEnded)
+				return
+			}
+		}
+
 		// place the user claims (id, email) in the context
 		ctx := context.WithValue(r.Context(), identity.UserCtxKey, claims)
 
@@ -81,3 +146,74 @@ func AuthenticationMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequirePermission only lets requests through from users whose token grants
+// every one of the permissions. It reads the claims placed in the context by
+// AuthenticationMiddleware, so it must be applied inside it, e.g.
+//
+//	Chain(handler, AuthenticationMiddleware, RequirePermission(domain.PermissionRolesRead))
+func RequirePermission(permissions ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := identity.GetClaimsFromContext(r.Context())
+			if !ok {
+				helpers.UnauthorizedErrResponse(w, r, errors.New("no user claims in request context"))
+				return
+			}
+
+			for _, p := range permissions {
+				if !claims.HasPermission(p) {
+					helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s is missing permission %q", claims.UserId, p))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DenyImpersonation refuses requests made while an admin is impersonating the
+// user. It guards operations only the user themselves should be able to do, such
+// as changing their credentials or deleting their account, and must be applied
+// inside AuthenticationMiddleware.
+func DenyImpersonation(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := identity.GetClaimsFromContext(r.Context())
+		if !ok {
+			helpers.UnauthorizedErrResponse(w, r, errors.New("no user claims in request context"))
+			return
+		}
+
+		if claims.Impersonating() {
+			helpers.ForbiddenErrResponse(w, r, fmt.Errorf("user %s can't do this while impersonating user %s", claims.Act.UserId, claims.UserId))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDRX matches the request ids accepted from the X-Request-ID header.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives every request an id, so its log lines and audit events can be
+// tied together. An id in the X-Request-ID header, e.g. set by a load balancer,
+// is kept, otherwise a random one is generated. Either way it is returned in the
+// X-Request-ID response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				helpers.ServerErrReponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, helpers.WithRequestID(r, id))
+	})
+}
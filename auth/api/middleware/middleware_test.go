@@ -1,10 +1,23 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ipfilter"
+	"github.com/todo-app/internal/ratelimit"
+	"github.com/todo-app/internal/repositories"
 )
 
 func TestSecureHeaders(t *testing.T) {
@@ -88,3 +101,557 @@ func TestPanicRecovery(t *testing.T) {
 		t.Errorf("wanted %d; got %d", 500, rs.StatusCode)
 	}
 }
+
+func TestRateLimit(t *testing.T) {
+	limiter, err := ratelimit.NewTokenBucket(ratelimit.NewMemoryStore(), ratelimit.Rate{Limit: 2, Period: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		// The handler must still be able to read the body used for the key
+		var input struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+			t.Errorf("expected handler to read the request body, got %q, %v", input.Email, err)
+		}
+		w.Write([]byte("OK"))
+	}
+	handler := RateLimit(limiter, "test", KeyByJSONField("email"))(next)
+
+	send := func(email string) *http.Response {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "`+email+`"}`))
+		handler.ServeHTTP(rr, r)
+		return rr.Result()
+	}
+
+	for i := 0; i < 2; i++ {
+		rs := send("someone@example.com")
+		if rs.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: want %d; got %d", i+1, http.StatusOK, rs.StatusCode)
+		}
+		if got := rs.Header.Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("want RateLimit-Limit %q; got %q", "2", got)
+		}
+		if got, want := rs.Header.Get("RateLimit-Remaining"), strconv.Itoa(1-i); got != want {
+			t.Errorf("want RateLimit-Remaining %q; got %q", want, got)
+		}
+	}
+
+	// The key is case insensitive
+	rs := send("SomeOne@example.com")
+	if rs.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("want %d; got %d", http.StatusTooManyRequests, rs.StatusCode)
+	}
+	if got := rs.Header.Get("Retry-After"); got != "30" {
+		t.Errorf("want Retry-After %q; got %q", "30", got)
+	}
+
+	if rs := send("other@example.com"); rs.StatusCode != http.StatusOK {
+		t.Errorf("expected another email to have its own limit, got %d", rs.StatusCode)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {}
+	handler := RateLimit(nil, "test", KeyByIP)(next)
+
+	for i := 0; i < 100; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, rr.Code)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+	handler := RequirePermission("roles:read", "roles:write")(next)
+
+	tests := []struct {
+		name       string
+		claims     *identity.JWTClaims
+		wantStatus int
+	}{
+		{
+			name:       "No claims",
+			claims:     nil,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Missing one permission",
+			claims:     &identity.JWTClaims{Permissions: []string{"roles:read"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "All permissions",
+			claims:     &identity.JWTClaims{Permissions: []string{"users:read", "roles:read", "roles:write"}},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), identity.UserCtxKey, *tt.claims))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d; got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+	handler := DenyImpersonation(next)
+
+	tests := []struct {
+		name       string
+		claims     *identity.JWTClaims
+		wantStatus int
+	}{
+		{
+			name:       "No claims",
+			claims:     nil,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Impersonating",
+			claims:     &identity.JWTClaims{Act: &identity.ActorClaim{Email: "admin@example.com", SessionID: 1}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Signed in as themselves",
+			claims:     &identity.JWTClaims{},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/", nil)
+			if tt.claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), identity.UserCtxKey, *tt.claims))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d; got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var got string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = helpers.RequestID(r)
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{name: "No header", header: "", wantSame: false},
+		{name: "Valid header", header: "abc-123.DEF_4", wantSame: true},
+		{name: "Invalid header", header: "abc 123\n", wantSame: false},
+		{name: "Too long header", header: strings.Repeat("a", 65), wantSame: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if got == "" {
+				t.Fatal("want a request id in the request context")
+			}
+			if header := rr.Header().Get("X-Request-ID"); header != got {
+				t.Errorf("want response header %q; got %q", got, header)
+			}
+			if (got == tt.header) != tt.wantSame {
+				t.Errorf("want the id kept %v; got %q", tt.wantSame, got)
+			}
+		})
+	}
+}
+
+type fakeAccounts map[string]*domain.SessionState
+
+func (f fakeAccounts) GetSessionState(userId string) (*domain.SessionState, error) {
+	state, ok := f[userId]
+	if !ok {
+		return nil, repositories.ErrRecordNotFound
+	}
+	return state, nil
+}
+
+type fakeSessions map[int64]*domain.ImpersonationSession
+
+func (f fakeSessions) Get(id int64) (*domain.ImpersonationSession, error) {
+	session, ok := f[id]
+	if !ok {
+		return nil, repositories.ErrRecordNotFound
+	}
+	return session, nil
+}
+
+func TestAuthenticationMiddleware(t *testing.T) {
+	user := &domain.User{ID: uuid.New(), Email: "jane@example.com", Status: domain.StatusActive}
+
+	// Sign the user in, and keep the cookie they were given
+	rr := httptest.NewRecorder()
+	if err := identity.SetCookie(rr, user); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+
+	tests := []struct {
+		name       string
+		state      *domain.SessionState
+		wantStatus int
+	}{
+		{
+			name:       "Active",
+			state:      &domain.SessionState{Status: domain.StatusActive},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Sessions revoked before sign in",
+			state:      &domain.SessionState{Status: domain.StatusActive, SessionsRevokedAt: time.Now().Add(-time.Hour)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Sessions revoked since sign in",
+			state:      &domain.SessionState{Status: domain.StatusActive, SessionsRevokedAt: time.Now().Add(time.Hour)},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Locked",
+			state:      &domain.SessionState{Status: domain.StatusLocked},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Deleted",
+			state:      nil,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := fakeAccounts{}
+			if tt.state != nil {
+				accounts[user.ID.String()] = tt.state
+			}
+			handler := AuthenticationMiddleware(accounts, fakeSessions{})(next)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, c := range cookies {
+				r.AddCookie(c)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d; got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestAuthenticationMiddlewareImpersonation(t *testing.T) {
+	admin := &domain.User{ID: uuid.New(), Email: "admin@example.com", Status: domain.StatusActive}
+	user := &domain.User{ID: uuid.New(), Email: "jane@example.com", Status: domain.StatusActive}
+	accounts := fakeAccounts{
+		admin.ID.String(): {Status: domain.StatusActive},
+		user.ID.String():  {Status: domain.StatusActive},
+	}
+
+	// Sign the admin in, then have them impersonate the user
+	rr := httptest.NewRecorder()
+	if err := identity.SetCookie(rr, admin); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	rr = httptest.NewRecorder()
+	actor := identity.ActorClaim{UserId: admin.ID, Email: admin.Email, SessionID: 1}
+	if err := identity.SetImpersonationCookie(rr, r, user, actor, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+
+	ended := time.Now()
+	tests := []struct {
+		name       string
+		session    *domain.ImpersonationSession
+		wantStatus int
+	}{
+		{
+			name:       "Session in progress",
+			session:    &domain.ImpersonationSession{ID: 1},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Session ended",
+			session:    &domain.ImpersonationSession{ID: 1, EndedAt: &ended},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "No session",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := fakeSessions{}
+			if tt.session != nil {
+				sessions[tt.session.ID] = tt.session
+			}
+			handler := AuthenticationMiddleware(accounts, sessions)(next)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, c := range cookies {
+				r.AddCookie(c)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d; got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+type fakeIPRules []*domain.IPRule
+
+func (rules fakeIPRules) GetAll() ([]*domain.IPRule, error) {
+	return rules, nil
+}
+
+func TestIPFilter(t *testing.T) {
+	proxies, err := ipfilter.ParseList("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := ipfilter.New(fakeIPRules{
+		{CIDR: "203.0.113.0/24", Action: domain.IPRuleAllow},
+		{CIDR: "10.0.0.0/8", Action: domain.IPRuleAllow},
+	}, time.Minute)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := ClientIP(proxies, "X-Forwarded-For")(IPFilter(filter)(next))
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor string
+		wantStatus    int
+	}{
+		{"Allowed client", "203.0.113.5:4321", "", http.StatusOK},
+		{"Denied client", "192.0.2.1:4321", "", http.StatusForbidden},
+		{"Allowed client behind a trusted proxy", "10.0.0.2:4321", "203.0.113.5", http.StatusOK},
+		{"Denied client behind a trusted proxy", "10.0.0.2:4321", "192.0.2.1", http.StatusForbidden},
+		{"Forged hop before the last proxy", "10.0.0.2:4321", "203.0.113.5, 192.0.2.1, 10.0.0.3", http.StatusForbidden},
+		{"Header from an untrusted client", "192.0.2.1:4321", "203.0.113.5", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xForwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.xForwardedFor)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d; got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRestrictOrganizationIP(t *testing.T) {
+	filter := ipfilter.New(fakeIPRules{
+		{OrganizationID: "acme", CIDR: "203.0.113.0/24", Action: domain.IPRuleAllow},
+	}, time.Minute)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+	handler := RestrictOrganizationIP(filter)(next)
+
+	tests := []struct {
+		name       string
+		orgId      string
+		remoteAddr string
+		wantStatus int
+	}{
+		{"Inside the org's network", "acme", "203.0.113.5:4321", http.StatusOK},
+		{"Outside the org's network", "acme", "192.0.2.1:4321", http.StatusForbidden},
+		{"Org without rules", "globex", "192.0.2.1:4321", http.StatusOK},
+		{"Not signed in to an org", "", "192.0.2.1:4321", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r = r.WithContext(context.WithValue(r.Context(), identity.UserCtxKey, identity.JWTClaims{OrgID: tt.orgId}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("want %d; got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ipfilter.ParseList("10.0.0.0/8, 2001:db8:ffff::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "No proxy",
+			header:     "X-Forwarded-For",
+			remoteAddr: "203.0.113.5:4321",
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "Headers from an untrusted peer are ignored",
+			header:     "X-Forwarded-For",
+			remoteAddr: "203.0.113.5:4321",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1", "X-Real-IP": "192.0.2.1", "Forwarded": "for=192.0.2.1"},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "X-Forwarded-For through two proxies",
+			header:     "X-Forwarded-For",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.99, 203.0.113.5, 10.0.0.3"},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "Every hop is a trusted proxy",
+			header:     "X-Forwarded-For",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.4, 10.0.0.3"},
+			want:       "10.0.0.4",
+		},
+		{
+			name:       "Garbage in X-Forwarded-For",
+			header:     "X-Forwarded-For",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.5, unknown"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "Forwarded with ports and IPv6",
+			header:     "Forwarded",
+			remoteAddr: "[2001:db8:ffff::1]:4321",
+			headers:    map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.3:80;by=10.0.0.2`},
+			want:       "2001:db8:cafe::17",
+		},
+		{
+			name:       "Forwarded",
+			header:     "Forwarded",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"Forwarded": "For=203.0.113.5", "X-Forwarded-For": "192.0.2.1"},
+			want:       "203.0.113.5",
+		},
+		{
+			// The proxy appends to X-Forwarded-For, and passes the client's
+			// Forwarded and X-Real-IP through untouched
+			name:       "Forged Forwarded behind an X-Forwarded-For proxy",
+			header:     "X-Forwarded-For",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"Forwarded": "for=192.0.2.1", "X-Real-IP": "192.0.2.1", "X-Forwarded-For": "203.0.113.5"},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "Obfuscated Forwarded identifier",
+			header:     "Forwarded",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"Forwarded": "for=_hidden, for=10.0.0.3"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "X-Real-IP",
+			header:     "X-Real-IP",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.5"},
+			want:       "203.0.113.5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			var got string
+			handler := ClientIP(proxies, tt.header)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = helpers.ClientIP(r)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/todo-app/api/helpers"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ratelimit"
+	"github.com/todo-app/pkg/logger"
+)
+
+// maxKeyBodyBytes is the most of a request body KeyByJSONField reads.
+const maxKeyBodyBytes = 1 << 20
+
+// KeyFunc returns the key a request is rate limited by. An empty key skips
+// limiting for the request.
+type KeyFunc func(r *http.Request) (string, error)
+
+// KeyByIP limits requests per client IP address.
+func KeyByIP(r *http.Request) (string, error) {
+	return "ip:" + helpers.ClientIP(r), nil
+}
+
+// KeyByUser limits requests per signed in user, and must be used inside
+// AuthenticationMiddleware. Requests without a user are limited by IP address.
+func KeyByUser(r *http.Request) (string, error) {
+	claims, ok := identity.GetClaimsFromContext(r.Context())
+	if !ok {
+		return KeyByIP(r)
+	}
+	return "user:" + claims.UserId.String(), nil
+}
+
+// KeyByJSONField limits requests by the value of a top level field of the JSON
+// request body, e.g. the email address a password reset is requested for. The
+// value is lowercased, and the body is restored so the handler can still read it.
+// Requests without the field aren't limited by this key.
+func KeyByJSONField(field string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBodyBytes))
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			// Leave rejecting a malformed body to the handler
+			return "", nil
+		}
+
+		value, ok := fields[field].(string)
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return "", nil
+		}
+		return field + ":" + value, nil
+	}
+}
+
+// RateLimit limits requests to a route with the limiter, keyed by key. name
+// separates the counters of different routes using the same key. Every limited
+// response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers, and requests over the limit get a 429 with a Retry-After header.
+//
+// A nil limiter disables limiting, and so does any error from the limiter's
+// store: an outage of the store shouldn't take the routes it protects down too.
+// Like AuthenticationMiddleware it wraps individual routes.
+func RateLimit(limiter ratelimit.Limiter, name string, key KeyFunc) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if limiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k, err := key(r)
+			if err != nil {
+				helpers.BadRequestErrResponse(w, r, err)
+				return
+			}
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := limiter.Allow(r.Context(), name+":"+k)
+			if err != nil {
+				logger.Error.Printf("rate limiter %s failed, letting request through: %v", name, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				logger.Info.Printf("rate limit %s exceeded for %s", name, k)
+				helpers.TooManyRequestsResponse(w, r, res.RetryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Chain applies route middlewares to a handler, the first one outermost.
+func Chain(h http.HandlerFunc, middlewares ...func(http.HandlerFunc) http.HandlerFunc) http.HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
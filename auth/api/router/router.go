@@ -8,6 +8,7 @@ import (
 	"github.com/todo-app/api/helpers"
 	"github.com/todo-app/api/middleware"
 	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/domain"
 )
 
 func Get(app *application.App) *mux.Router {
@@ -17,21 +18,118 @@ func Get(app *application.App) *mux.Router {
 	r.NotFoundHandler = http.HandlerFunc(helpers.NotFoundErrResponse)
 	r.MethodNotAllowedHandler = http.HandlerFunc(helpers.MethodNotAllowedResponse)
 
+	limits := app.RateLimiters
+	authenticate := middleware.AuthenticationMiddleware(app.UserRepository, app.ImpersonationRepository)
+	auth := func(h http.HandlerFunc) http.HandlerFunc {
+		return middleware.Chain(h, authenticate, middleware.RestrictOrganizationIP(app.IPFilter))
+	}
+
 	r.HandleFunc("/v1/health", handlers.HealthCheck(app)).Methods(http.MethodGet)
-	r.HandleFunc("/v1/register", handlers.Register(app)).Methods(http.MethodPost)
-	r.HandleFunc("/v1/signin", handlers.Login(app)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/register", middleware.Chain(handlers.Register(app),
+		middleware.RateLimit(limits.Register, "register", middleware.KeyByIP),
+	)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/signin", middleware.Chain(handlers.Login(app),
+		middleware.RateLimit(limits.Signin, "signin", middleware.KeyByIP),
+	)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/signin/confirm", middleware.Chain(handlers.ConfirmLogin(app),
+		middleware.RateLimit(limits.Signin, "signin", middleware.KeyByIP),
+	)).Methods(http.MethodPost)
 
 	r.HandleFunc("/v1/user/password", handlers.UpdateUserPasswordHandler(app)).Methods(http.MethodPut)
 	r.HandleFunc("/v1/user/activate", handlers.ActivateUser(app)).Methods(http.MethodPut)
-	r.HandleFunc("/v1/user/password-reset", handlers.PasswordReset(app)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/user/activation/resend", middleware.Chain(handlers.ResendActivation(app),
+		middleware.RateLimit(limits.ActivationResend, "activation-resend", middleware.KeyByJSONField("email")),
+	)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/user/password-reset", middleware.Chain(handlers.PasswordReset(app),
+		middleware.RateLimit(limits.PasswordResetIP, "password-reset", middleware.KeyByIP),
+		middleware.RateLimit(limits.PasswordReset, "password-reset", middleware.KeyByJSONField("email")),
+	)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/user/unlock", handlers.UnlockAccount(app)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/user/secure", handlers.SecureAccount(app)).Methods(http.MethodPost)
+
+	r.HandleFunc("/v1/token/refresh", middleware.Chain(handlers.RefreshToken(app),
+		auth,
+		middleware.DenyImpersonation,
+	)).Methods(http.MethodPost)
+
+	r.HandleFunc("/v1/user/me", auth(handlers.GetCurrentUser(app))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/user/me", auth(handlers.UpdateCurrentUser(app))).Methods(http.MethodPatch)
+	r.HandleFunc("/v1/user/me", middleware.Chain(handlers.DeleteAccount(app),
+		auth,
+		middleware.DenyImpersonation,
+	)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/user/me/export", middleware.Chain(handlers.ExportData(app),
+		auth,
+		middleware.DenyImpersonation,
+		middleware.RateLimit(limits.Export, "export", middleware.KeyByUser),
+	)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/user/me/activity", auth(handlers.ListActivity(app))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/user/me/logins", auth(handlers.ListLogins(app))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/user/me/export/download", middleware.Chain(handlers.DownloadDataExport(app),
+		auth,
+		middleware.DenyImpersonation,
+	)).Methods(http.MethodGet)
+
+	// Organizations. The member routes act on the organization the user is signed in to.
+	r.HandleFunc("/v1/orgs", auth(handlers.ListOrganizations(app))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/orgs", auth(handlers.CreateOrganization(app))).Methods(http.MethodPost)
+	// Switching reissues the token, which would turn an impersonation into a session of the user's own.
+	// Changes to who is in the organization, and where from, would outlast the impersonation.
+	ownUser := func(h http.HandlerFunc) http.HandlerFunc {
+		return middleware.Chain(h, auth, middleware.DenyImpersonation)
+	}
+	r.HandleFunc("/v1/orgs/switch", ownUser(handlers.SwitchOrganization(app))).Methods(http.MethodPost)
+	r.HandleFunc("/v1/org/members", auth(handlers.ListMembers(app))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/org/members/{userId}", ownUser(handlers.UpdateMember(app))).Methods(http.MethodPatch)
+	r.HandleFunc("/v1/org/members/{userId}", ownUser(handlers.RemoveMember(app))).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/org/invitations", auth(handlers.ListInvitations(app))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/org/invitations", ownUser(handlers.CreateInvitation(app))).Methods(http.MethodPost)
+	r.HandleFunc("/v1/org/invitations/{id}", ownUser(handlers.RevokeInvitation(app))).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/org/ip-rules", auth(handlers.ListOrgIPRules(app))).Methods(http.MethodGet)
+	r.HandleFunc("/v1/org/ip-rules", ownUser(handlers.CreateOrgIPRule(app))).Methods(http.MethodPost)
+	r.HandleFunc("/v1/org/ip-rules/{id}", ownUser(handlers.DeleteOrgIPRule(app))).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/invitations/accept", handlers.AcceptInvitation(app)).Methods(http.MethodPost)
+
+	// Stopping impersonation isn't authenticated, so that it still works once the token expires.
+	r.HandleFunc("/v1/impersonation/stop", handlers.StopImpersonation(app)).Methods(http.MethodPost)
 
-	r.HandleFunc("/v1/user/me", middleware.AuthenticationMiddleware(handlers.GetCurrentUser(app))).Methods(http.MethodGet)
+	// The admin API. Every route needs a signed in user with the given permission.
+	admin := func(h http.HandlerFunc, permission string) http.HandlerFunc {
+		return middleware.Chain(h, auth, middleware.RequirePermission(permission))
+	}
+	r.HandleFunc("/v1/admin/users", admin(handlers.ListUsers(app), domain.PermissionUsersRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/users/import", admin(handlers.ImportUsers(app), domain.PermissionUsersImport)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/admin/users/{id}", admin(handlers.GetUser(app), domain.PermissionUsersRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/users/{id}", admin(handlers.UpdateUser(app), domain.PermissionUsersWrite)).Methods(http.MethodPatch)
+	r.HandleFunc("/v1/admin/users/{id}", admin(handlers.DeleteUser(app), domain.PermissionUsersWrite)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/admin/users/{id}/logins", admin(handlers.ListUserLogins(app), domain.PermissionUsersRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/users/{id}/impersonate", admin(handlers.ImpersonateUser(app), domain.PermissionUsersImpersonate)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/admin/impersonations", admin(handlers.ListImpersonations(app), domain.PermissionUsersRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/users/{userId}/roles", admin(handlers.ListUserRoles(app), domain.PermissionRolesRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/users/{userId}/roles/{roleId}", admin(handlers.AssignUserRole(app), domain.PermissionRolesWrite)).Methods(http.MethodPut)
+	r.HandleFunc("/v1/admin/users/{userId}/roles/{roleId}", admin(handlers.RemoveUserRole(app), domain.PermissionRolesWrite)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/admin/audit", admin(handlers.ListAuditEvents(app), domain.PermissionAuditRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/ip-rules", admin(handlers.ListIPRules(app), domain.PermissionIPRulesRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/ip-rules", admin(handlers.CreateIPRule(app), domain.PermissionIPRulesWrite)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/admin/ip-rules/{id}", admin(handlers.DeleteIPRule(app), domain.PermissionIPRulesWrite)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/admin/roles", admin(handlers.ListRoles(app), domain.PermissionRolesRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/roles", admin(handlers.CreateRole(app), domain.PermissionRolesWrite)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/admin/roles/{id}", admin(handlers.GetRole(app), domain.PermissionRolesRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/roles/{id}", admin(handlers.UpdateRole(app), domain.PermissionRolesWrite)).Methods(http.MethodPatch)
+	r.HandleFunc("/v1/admin/roles/{id}", admin(handlers.DeleteRole(app), domain.PermissionRolesWrite)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/admin/roles/{id}/permissions", admin(handlers.SetRolePermissions(app), domain.PermissionRolesWrite)).Methods(http.MethodPut)
+	r.HandleFunc("/v1/admin/permissions", admin(handlers.ListPermissions(app), domain.PermissionRolesRead)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/permissions", admin(handlers.CreatePermission(app), domain.PermissionRolesWrite)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/admin/permissions/{id}", admin(handlers.DeletePermission(app), domain.PermissionRolesWrite)).Methods(http.MethodDelete)
 	http.Handle("/", r)
 
 	// Standard Middlewares applied on every request
+	r.Use(middleware.RequestID)
+	r.Use(middleware.ClientIP(app.TrustedProxies, app.ClientIPHeader))
 	r.Use(middleware.SecureHeaders)
 	r.Use(middleware.RequestLog)
 	r.Use(middleware.PanicRecovery)
+	r.Use(middleware.IPFilter(app.IPFilter))
 
 	return r
 }
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/pkg/config"
+)
+
+// activeAccounts reports every account as active, so requests can be
+// authenticated without a database.
+type activeAccounts struct {
+	repositories.UserRepositoryInterface
+}
+
+func (activeAccounts) GetSessionState(userId string) (*domain.SessionState, error) {
+	return &domain.SessionState{Status: domain.StatusActive}, nil
+}
+
+// impersonationInProgress reports every impersonation session as still going.
+type impersonationInProgress struct {
+	repositories.ImpersonationRepositoryInterface
+}
+
+func (impersonationInProgress) Get(id int64) (*domain.ImpersonationSession, error) {
+	return &domain.ImpersonationSession{ID: id}, nil
+}
+
+func TestOrganizationChangesWhileImpersonating(t *testing.T) {
+	app := &application.App{
+		Confg:                   &config.Confg{},
+		UserRepository:          activeAccounts{},
+		ImpersonationRepository: impersonationInProgress{},
+		RateLimiters:            &application.RateLimiters{},
+	}
+	r := Get(app)
+
+	admin := &domain.User{ID: uuid.New(), Email: "admin@email.com", Status: domain.StatusActive}
+	target := &domain.User{ID: uuid.New(), Email: "target@email.com", Status: domain.StatusActive, OrgID: uuid.NewString()}
+
+	rr := httptest.NewRecorder()
+	if err := identity.SetCookie(rr, admin); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/admin/users/"+target.ID.String()+"/impersonate", nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	rr = httptest.NewRecorder()
+	actor := identity.ActorClaim{UserId: admin.ID, Email: admin.Email, SessionID: 1}
+	if err := identity.SetImpersonationCookie(rr, req, target, actor, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/v1/orgs/switch", `{"organizationId": "` + uuid.NewString() + `"}`},
+		{http.MethodPatch, "/v1/org/members/" + admin.ID.String(), `{"role": "owner"}`},
+		{http.MethodDelete, "/v1/org/members/" + admin.ID.String(), ""},
+		{http.MethodPost, "/v1/org/invitations", `{"email": "admin@email.com", "role": "owner"}`},
+		{http.MethodDelete, "/v1/org/invitations/1", ""},
+		{http.MethodPost, "/v1/org/ip-rules", `{"cidr": "0.0.0.0/0", "action": "allow"}`},
+		{http.MethodDelete, "/v1/org/ip-rules/1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("want status %d; got %d", http.StatusForbidden, rr.Code)
+			}
+			// The impersonation token must not be swapped for one of the user's own
+			if cookies := rr.Result().Cookies(); len(cookies) != 0 {
+				t.Errorf("expected no new session cookie; got %v", cookies)
+			}
+		})
+	}
+}
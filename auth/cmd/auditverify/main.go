@@ -0,0 +1,76 @@
+// Command auditverify checks the audit log hasn't been tampered with. It walks
+// the hash chain of audit events from the first to the last, and reports every
+// event that was modified, removed or inserted behind the service's back, and
+// every signed checkpoint that doesn't match the log. It exits with status 1 if
+// it finds any.
+//
+// -key takes the public keys checkpoints may have been signed with, separated by
+// commas, so checkpoints signed before the key was rotated still verify.
+//
+// Usage:
+//
+//	go run cmd/auditverify/main.go -key audit.pub
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/todo-app/internal"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/pkg/config"
+)
+
+func main() {
+	godotenv.Load()
+
+	// Register our own flags before config.Get() parses the command line
+	keyFiles := flag.String("key", "", "Comma separated PEM encoded ed25519 public keys checkpoints are signed with")
+	cfg := config.Get()
+
+	if *keyFiles == "" {
+		log.Println("-key is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var keys []ed25519.PublicKey
+	for _, path := range strings.Split(*keyFiles, ",") {
+		key, err := audit.LoadVerifyingKey(strings.TrimSpace(path))
+		if err != nil {
+			log.Fatalf("failed loading key: %s", err)
+		}
+		keys = append(keys, key)
+	}
+
+	db, err := internal.GetDataStore(cfg.GetDBConnStr())
+	if err != nil {
+		log.Fatalf("failed connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	report, err := audit.Verify(repositories.NewAuditRepository(db.Client), keys...)
+	if err != nil {
+		log.Fatalf("failed verifying audit log: %s", err)
+	}
+
+	log.Printf("checked %d events up to event %d, %d recorded before the log was chained, against %d checkpoints",
+		report.Events, report.LastEventID, report.Unchained, report.Checkpoints)
+
+	if report.OK() {
+		log.Println("no sign of tampering found")
+		return
+	}
+
+	for _, problem := range report.Problems {
+		log.Println(problem)
+	}
+	log.Printf("found %d problems", len(report.Problems))
+	db.Close()
+	os.Exit(1)
+}
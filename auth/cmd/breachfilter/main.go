@@ -0,0 +1,151 @@
+// Command breachfilter compiles a corpus of breached password hashes into the
+// bloom filter file the API loads with the -password-breach-filter flag.
+//
+// The input is either a single file with one hex SHA-1 digest per line (such as
+// the ordered-by-hash Pwned Passwords download), or a directory of range files
+// named after a 5 character hash prefix, each holding the remaining 35 characters
+// per line (the layout produced by the Pwned Passwords downloader). Lines may end
+// with ":<count>".
+//
+// Usage:
+//
+//	go run cmd/breachfilter/main.go -in pwnedpasswords/ -out breached.filter -fp 0.001
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/todo-app/internal/breach"
+)
+
+func main() {
+	in := flag.String("in", "", "Corpus file or directory of range files")
+	out := flag.String("out", "breached.filter", "Path to write the filter to")
+	falsePositiveRate := flag.Float64("fp", 0.001, "Acceptable false positive rate of the filter")
+	minCount := flag.Int("min-count", 1, "Skip passwords seen in fewer breaches than this")
+	flag.Parse()
+
+	if *in == "" {
+		log.Println("-in is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := corpusFiles(*in)
+	if err != nil {
+		log.Fatalf("failed reading corpus: %s", err)
+	}
+
+	// The filter has to be sized up front, so do a first pass to count how many
+	// hashes will go in to it.
+	var total uint64
+	err = walkCorpus(files, *minCount, func(digest [20]byte) {
+		total++
+	})
+	if err != nil {
+		log.Fatalf("failed counting corpus: %s", err)
+	}
+	log.Printf("building filter for %d hashes from %d files", total, len(files))
+
+	filter, err := breach.New(total, *falsePositiveRate)
+	if err != nil {
+		log.Fatalf("failed creating filter: %s", err)
+	}
+	err = walkCorpus(files, *minCount, filter.AddDigest)
+	if err != nil {
+		log.Fatalf("failed building filter: %s", err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("failed creating output file: %s", err)
+	}
+	defer f.Close()
+
+	size, err := filter.WriteTo(f)
+	if err != nil {
+		log.Fatalf("failed writing filter: %s", err)
+	}
+
+	log.Printf("wrote %s (%d bytes)", *out, size)
+}
+
+// corpusFile is a file of the corpus along with the hash prefix its lines are missing.
+type corpusFile struct {
+	path   string
+	prefix string
+}
+
+func corpusFiles(path string) ([]corpusFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []corpusFile{{path: path}}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []corpusFile{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// Range files are named after their prefix, optionally with an extension
+		name := entry.Name()
+		prefix := strings.TrimSuffix(name, filepath.Ext(name))
+		if len(prefix) != 5 {
+			return nil, fmt.Errorf("range file %q is not named after a 5 character hash prefix", name)
+		}
+		files = append(files, corpusFile{path: filepath.Join(path, name), prefix: strings.ToUpper(prefix)})
+	}
+	return files, nil
+}
+
+func walkCorpus(files []corpusFile, minCount int, fn func(digest [20]byte)) error {
+	for _, file := range files {
+		if err := walkFile(file, minCount, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkFile(file corpusFile, minCount int, fn func(digest [20]byte)) error {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		digest, count, err := breach.ParseHashLine(file.prefix, line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", file.path, lineNumber, err)
+		}
+		if count < minCount {
+			continue
+		}
+		fn(digest)
+	}
+	return scanner.Err()
+}
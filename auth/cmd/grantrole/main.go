@@ -0,0 +1,67 @@
+// Command grantrole gives a role to a user straight in the database. Roles are
+// normally managed through the admin API, which needs a user with the roles:write
+// permission, so this is how the first admin is created.
+//
+// Usage:
+//
+//	go run cmd/grantrole/main.go -email jane@example.com -role admin
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/todo-app/internal"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/pkg/config"
+)
+
+func main() {
+	godotenv.Load()
+
+	// Register our own flags before config.Get() parses the command line
+	email := flag.String("email", "", "Email address of the user to give the role to")
+	roleName := flag.String("role", "admin", "Name of the role to give")
+	cfg := config.Get()
+
+	if *email == "" {
+		log.Println("-email is required")
+		return
+	}
+
+	db, err := internal.GetDataStore(cfg.GetDBConnStr())
+	if err != nil {
+		log.Fatalf("failed connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	app, err := application.BootstrapApp(db, cfg)
+	if err != nil {
+		log.Fatalf("failed bootstrapping app: %s", err)
+	}
+
+	user, err := app.UserRepository.GetByEmail(*email)
+	if err != nil {
+		log.Fatalf("failed finding user %s: %s", *email, err)
+	}
+
+	roles, err := app.RoleRepository.GetAll()
+	if err != nil {
+		log.Fatalf("failed listing roles: %s", err)
+	}
+
+	for _, role := range roles {
+		if role.Name != *roleName {
+			continue
+		}
+
+		if err := app.RoleRepository.AssignToUser(user.ID.String(), role.ID); err != nil {
+			log.Fatalf("failed giving role %s to %s: %s", role.Name, user.Email, err)
+		}
+		log.Printf("gave role %s to %s, it applies from their next sign in", role.Name, user.Email)
+		return
+	}
+
+	log.Fatalf("no role named %s", *roleName)
+}
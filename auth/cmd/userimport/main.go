@@ -0,0 +1,118 @@
+// Command userimport bulk imports users migrated from another system, along with
+// their existing password hashes, straight into the database.
+//
+// The input file has one JSON user per line (JSON lines), in the same shape the
+// POST /v1/admin/users/import endpoint accepts:
+//
+//	{"email": "jane@example.com", "firstName": "Jane", "lastName": "Doe", "hashFormat": "django", "passwordHash": "pbkdf2_sha256$...", "activated": true}
+//
+// Firebase exports need the project's hash parameters, passed with the
+// -firebase-* flags (or FIREBASE_* environment variables). The import stops
+// at the first user whose hashes can't be verified with the configuration.
+//
+// Usage:
+//
+//	go run cmd/userimport/main.go -file users.jsonl
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/todo-app/internal"
+	"github.com/todo-app/internal/application"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/hashing"
+	"github.com/todo-app/internal/services"
+	"github.com/todo-app/pkg/config"
+)
+
+// batchSize is the number of users read into memory before they are imported.
+const batchSize = 500
+
+func main() {
+	godotenv.Load()
+
+	// Register our own flag before config.Get() parses the command line
+	file := flag.String("file", "", "JSON lines file of users to import")
+	cfg := config.Get()
+
+	if *file == "" {
+		log.Println("-file is required")
+		return
+	}
+
+	db, err := internal.GetDataStore(cfg.GetDBConnStr())
+	if err != nil {
+		log.Fatalf("failed connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	app, err := application.BootstrapApp(db, cfg)
+	if err != nil {
+		log.Fatalf("failed bootstrapping app: %s", err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("failed opening %s: %s", *file, err)
+	}
+	defer f.Close()
+
+	var created, failed, lineNumber int
+	batch := make([]*domain.ImportUser, 0, batchSize)
+
+	flush := func() {
+		results, err := services.ImportUsers(app.IdentityService, batch)
+		for _, result := range results {
+			if result.Created {
+				created++
+				continue
+			}
+			failed++
+			log.Printf("failed importing %s: %v", result.Email, result.Errors)
+		}
+		if err != nil {
+			log.Fatalf("aborting import after %d created, %d failed: %s", created, failed, err)
+		}
+		batch = batch[:0]
+	}
+
+	scanner := bufio.NewScanner(f)
+	// Allow for long lines, some exported hashes and names can be large
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var user domain.ImportUser
+		if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+			failed++
+			log.Printf("line %d: invalid JSON: %s", lineNumber, err)
+			continue
+		}
+
+		if !hashing.Default().CanImport(user.HashFormat) {
+			flush()
+			log.Fatalf("line %d: no password hasher is configured for %q hashes, aborting after %d created, %d failed",
+				lineNumber, user.HashFormat, created, failed)
+		}
+
+		batch = append(batch, &user)
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("failed reading %s: %s", *file, err)
+	}
+	flush()
+
+	log.Printf("import finished: %d created, %d failed", created, failed)
+}
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_pepper_version integer NOT NULL DEFAULT 0;
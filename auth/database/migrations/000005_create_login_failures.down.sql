@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS ip_login_failures;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS failed_login_attempts,
+    DROP COLUMN IF EXISTS last_failed_login_at,
+    DROP COLUMN IF EXISTS locked_until;
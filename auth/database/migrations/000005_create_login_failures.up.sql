@@ -0,0 +1,11 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS failed_login_attempts integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_failed_login_at timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS locked_until timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS ip_login_failures (
+    ip text NOT NULL PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    last_failed_at timestamp(0) with time zone NOT NULL,
+    locked_until timestamp(0) with time zone
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key text NOT NULL PRIMARY KEY,
+    value double precision NOT NULL,
+    prev double precision NOT NULL,
+    stamp timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_expires_at_idx ON rate_limits (expires_at);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id text NOT NULL PRIMARY KEY,
+    name text NOT NULL,
+    slug citext UNIQUE NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS memberships (
+    organization_id text NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS memberships_user_id_idx ON memberships (user_id);
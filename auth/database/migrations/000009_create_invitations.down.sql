@@ -0,0 +1,6 @@
+DELETE FROM tokens WHERE user_id IS NULL;
+ALTER TABLE tokens DROP CONSTRAINT IF EXISTS tokens_owner_check;
+ALTER TABLE tokens DROP COLUMN IF EXISTS invitation_id;
+ALTER TABLE tokens ALTER COLUMN user_id SET NOT NULL;
+
+DROP TABLE IF EXISTS invitations;
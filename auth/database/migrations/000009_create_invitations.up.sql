@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial PRIMARY KEY,
+    organization_id text NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    email citext NOT NULL,
+    role text NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    invited_by text REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp(0) with time zone NOT NULL,
+    UNIQUE (organization_id, email)
+);
+
+-- Invitation tokens belong to an invitation rather than a user, as the person
+-- invited may not have an account yet.
+ALTER TABLE tokens ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS invitation_id bigint REFERENCES invitations ON DELETE CASCADE;
+ALTER TABLE tokens ADD CONSTRAINT tokens_owner_check CHECK (user_id IS NOT NULL OR invitation_id IS NOT NULL);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_email_id_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_reset_required;
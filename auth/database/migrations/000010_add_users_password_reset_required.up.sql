@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required bool NOT NULL DEFAULT false;
+
+-- For listing users page by page in creation or email order
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS users_email_id_idx ON users (email, id);
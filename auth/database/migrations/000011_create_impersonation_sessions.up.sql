@@ -0,0 +1,26 @@
+-- Every time an admin signs in as another user. The emails are kept so the
+-- record stays meaningful after either account is deleted.
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id bigserial PRIMARY KEY,
+    actor_id text REFERENCES users ON DELETE SET NULL,
+    actor_email citext NOT NULL,
+    target_id text REFERENCES users ON DELETE SET NULL,
+    target_email citext NOT NULL,
+    reason text NOT NULL,
+    ip text NOT NULL DEFAULT '',
+    started_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) with time zone NOT NULL,
+    ended_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS impersonation_sessions_started_at_idx ON impersonation_sessions (started_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Sign in as another user to see the app as they do')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name IN ('admin', 'support') AND permissions.name = 'users:impersonate'
+ON CONFLICT DO NOTHING;
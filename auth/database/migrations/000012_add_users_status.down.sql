@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS users_status_idx;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS activated bool NOT NULL DEFAULT false;
+
+-- Only active accounts can still be used once the status is gone
+UPDATE users SET activated = (status = 'active');
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS status_changed_at,
+    DROP COLUMN IF EXISTS status_reason,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,13 @@
+-- Replace the activated flag with the status of the account in its lifecycle
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'active', 'suspended', 'locked', 'deactivated', 'deleted')),
+    ADD COLUMN IF NOT EXISTS status_reason text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status_changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+UPDATE users SET status = 'active' WHERE activated;
+
+ALTER TABLE users DROP COLUMN IF EXISTS activated;
+
+-- For listing the users in a status
+CREATE INDEX IF NOT EXISTS users_status_idx ON users (status);
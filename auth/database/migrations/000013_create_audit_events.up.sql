@@ -0,0 +1,47 @@
+-- The security audit log. Rows are never updated or deleted, which the
+-- triggers below enforce. actor_id and target_id aren't foreign keys so that
+-- events outlive the accounts they are about.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    occurred_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    action text NOT NULL,
+    actor_id text NOT NULL DEFAULT '',
+    actor_email citext NOT NULL DEFAULT '',
+    target_type text NOT NULL DEFAULT '',
+    target_id text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    request_id text NOT NULL DEFAULT '',
+    metadata jsonb NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_id_idx ON audit_events (target_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_change ON audit_events;
+CREATE TRIGGER audit_events_no_change
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_events_append_only();
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'Search the security audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name IN ('admin', 'support') AND permissions.name = 'audit:read'
+ON CONFLICT DO NOTHING;
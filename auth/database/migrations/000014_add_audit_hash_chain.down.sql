@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS hash,
+    DROP COLUMN IF EXISTS prev_hash;
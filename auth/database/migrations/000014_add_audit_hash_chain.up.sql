@@ -0,0 +1,35 @@
+-- Every audit event stores the hash of the event before it and its own hash over
+-- both, so editing or removing an event breaks the chain. Events recorded before
+-- the chain was added have no hashes.
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS prev_hash bytea,
+    ADD COLUMN IF NOT EXISTS hash bytea;
+
+-- Checkpoints sign the hash of the latest event with the service's ed25519 key,
+-- so the chain can't be rewritten from scratch without the key either.
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id bigserial PRIMARY KEY,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    event_id bigint NOT NULL,
+    event_hash bytea NOT NULL,
+    key_id text NOT NULL,
+    signature bytea NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_checkpoints_event_id_idx ON audit_checkpoints (event_id);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_checkpoints_no_change ON audit_checkpoints;
+CREATE TRIGGER audit_checkpoints_no_change
+    BEFORE UPDATE OR DELETE ON audit_checkpoints
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_checkpoints_no_truncate ON audit_checkpoints;
+CREATE TRIGGER audit_checkpoints_no_truncate
+    BEFORE TRUNCATE ON audit_checkpoints
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_events_append_only();
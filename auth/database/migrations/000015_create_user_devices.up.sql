@@ -0,0 +1,17 @@
+-- The devices and networks each user has signed in from, so that a sign in from
+-- one they haven't used before can be flagged to them.
+CREATE TABLE IF NOT EXISTS user_devices (
+    id bigserial PRIMARY KEY,
+    user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+    fingerprint bytea NOT NULL,
+    browser text NOT NULL,
+    os text NOT NULL,
+    network text NOT NULL,
+    ip text NOT NULL,
+    first_seen_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    last_seen_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, fingerprint)
+);
+
+-- Tokens issued before this time are no longer accepted for the user.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sessions_revoked_at timestamp with time zone;
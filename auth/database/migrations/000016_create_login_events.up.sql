@@ -0,0 +1,21 @@
+-- Every sign in attempt, for the sign in history users and support can see.
+-- Attempts on email addresses that aren't registered have no user_id.
+CREATE TABLE IF NOT EXISTS login_events (
+    id bigserial PRIMARY KEY,
+    user_id text REFERENCES users ON DELETE CASCADE,
+    email citext NOT NULL,
+    succeeded boolean NOT NULL,
+    failure_reason text NOT NULL DEFAULT '',
+    ip text NOT NULL,
+    user_agent text NOT NULL,
+    browser text NOT NULL,
+    os text NOT NULL,
+    city text NOT NULL DEFAULT '',
+    country text NOT NULL DEFAULT '',
+    country_code text NOT NULL DEFAULT '',
+    latitude double precision,
+    longitude double precision,
+    occurred_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_id_idx ON login_events (user_id, id);
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name IN ('ip_rules:read', 'ip_rules:write');
+
+DROP TABLE IF EXISTS ip_rules;
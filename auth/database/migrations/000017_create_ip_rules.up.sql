@@ -0,0 +1,25 @@
+-- Ranges of IP addresses allowed or denied access to the whole service, or to an
+-- organization when organization_id is set.
+CREATE TABLE IF NOT EXISTS ip_rules (
+    id bigserial PRIMARY KEY,
+    organization_id text REFERENCES organizations ON DELETE CASCADE,
+    cidr cidr NOT NULL,
+    action text NOT NULL CHECK (action IN ('allow', 'deny')),
+    description text NOT NULL DEFAULT '',
+    created_by text REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ip_rules_organization_id_idx ON ip_rules (organization_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('ip_rules:read', 'View the IP addresses allowed and denied access'),
+    ('ip_rules:write', 'Change the IP addresses allowed and denied access')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name = 'admin' AND permissions.name IN ('ip_rules:read', 'ip_rules:write'))
+   OR (roles.name = 'support' AND permissions.name = 'ip_rules:read')
+ON CONFLICT DO NOTHING;
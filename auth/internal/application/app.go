@@ -1,30 +1,175 @@
 package application
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/todo-app/internal"
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/breach"
+	"github.com/todo-app/internal/geoip"
+	"github.com/todo-app/internal/hashing"
+	"github.com/todo-app/internal/ipfilter"
 	"github.com/todo-app/internal/mailer"
+	"github.com/todo-app/internal/ratelimit"
 	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/risk"
 	"github.com/todo-app/internal/services"
+	"github.com/todo-app/internal/validator"
 	"github.com/todo-app/pkg/config"
 )
 
+// ipRulesCacheTTL is how long IP rules are cached for. Changes made through the
+// API apply straight away, but changes made directly in the database can take
+// this long.
+const ipRulesCacheTTL = 30 * time.Second
+
 type App struct {
-	dataStore       *internal.DataStore
-	Confg           *config.Confg
-	Mailer          mailer.Mailer
-	UserRepository  repositories.UserRepositoryInterface
-	TokenRepository repositories.TokenRepositoryInterface
-	IdentityService services.IdentityServiceInterface
+	dataStore               *internal.DataStore
+	Confg                   *config.Confg
+	Mailer                  mailer.Mailer
+	UserRepository          repositories.UserRepositoryInterface
+	TokenRepository         repositories.TokenRepositoryInterface
+	LoginAttemptRepository  repositories.LoginAttemptRepositoryInterface
+	DataExportRepository    repositories.DataExportRepositoryInterface
+	RoleRepository          repositories.RoleRepositoryInterface
+	OrganizationRepository  repositories.OrganizationRepositoryInterface
+	InvitationRepository    repositories.InvitationRepositoryInterface
+	ImpersonationRepository repositories.ImpersonationRepositoryInterface
+	AuditRepository         repositories.AuditRepositoryInterface
+	DeviceRepository        repositories.DeviceRepositoryInterface
+	LoginEventRepository    repositories.LoginEventRepositoryInterface
+	IPRuleRepository        repositories.IPRuleRepositoryInterface
+	IPFilter                *ipfilter.Filter
+	TrustedProxies          ipfilter.List
+	ClientIPHeader          string
+	AuditLog                *audit.Log
+	AuditCheckpointer       *audit.Checkpointer
+	IdentityService         services.IdentityServiceInterface
+	ExportService           services.ExportServiceInterface
+	PasswordPolicy          *validator.PasswordPolicy
+	RateLimiters            *RateLimiters
+}
+
+// RateLimiters are the limiters of the rate limited routes. A nil limiter means
+// the route isn't limited.
+type RateLimiters struct {
+	Signin           ratelimit.Limiter
+	Register         ratelimit.Limiter
+	PasswordReset    ratelimit.Limiter
+	PasswordResetIP  ratelimit.Limiter
+	ActivationResend ratelimit.Limiter
+	Export           ratelimit.Limiter
 }
 
 func BootstrapApp(db *internal.DataStore, cfg *config.Confg) (*App, error) {
+	userRepo := repositories.NewUserRepository(db.Client)
+	tokenRepo := repositories.NewTokenRepository(db.Client)
+	orgRepo := repositories.NewOrganizationRepository(db.Client)
+	auditRepo := repositories.NewAuditRepository(db.Client)
+	impersonationRepo := repositories.NewImpersonationRepository(db.Client)
+	deviceRepo := repositories.NewDeviceRepository(db.Client)
+	loginEventRepo := repositories.NewLoginEventRepository(db.Client)
+
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordHasher, err := newPasswordHasher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hashing.SetDefault(passwordHasher)
+
+	rateLimiters, err := newRateLimiters(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+
+	auditSinks, err := newAuditSinks(cfg)
+	if err != nil {
+		return nil, err
+	}
+	auditLog := audit.New(auditRepo, auditSinks...)
+
+	auditCheckpointer, err := newAuditCheckpointer(cfg, auditRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	geoIP, err := newGeoIP(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	riskEngine, err := newRiskEngine(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := ipfilter.ParseList(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	clientIPHeader, err := newClientIPHeader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ipRuleRepo := repositories.NewIPRuleRepository(db.Client)
+	ipFilter := ipfilter.New(ipRuleRepo, ipRulesCacheTTL)
+
+	identityService := services.NewIdentityService(db.Client)
+	identityService.SetLockoutPolicy(services.LockoutPolicy{
+		AccountThreshold: cfg.Lockout.AccountThreshold,
+		IPThreshold:      cfg.Lockout.IPThreshold,
+		BaseDuration:     cfg.Lockout.BaseDuration,
+		MaxDuration:      cfg.Lockout.MaxDuration,
+		Window:           cfg.Lockout.Window,
+		UnlockTokenTTL:   services.DefaultLockoutPolicy.UnlockTokenTTL,
+	})
+	identityService.SetEnumerationSafe(cfg.EnumerationSafe.Enabled)
+	identityService.SetAuditLog(auditLog)
+	identityService.SetGeoIP(geoIP)
+	identityService.SetIPFilter(ipFilter)
+	identityService.SetRiskPolicy(services.RiskPolicy{
+		Engine:          riskEngine,
+		Threshold:       cfg.Risk.Threshold,
+		ConfirmationTTL: services.DefaultRiskPolicy.ConfirmationTTL,
+	})
 
 	return &App{
-		dataStore:       db,
-		Confg:           cfg,
-		UserRepository:  repositories.NewUserRepository(db.Client),
-		TokenRepository: repositories.NewTokenRepository(db.Client),
-		IdentityService: services.NewIdentityService(db.Client),
+		dataStore:               db,
+		Confg:                   cfg,
+		UserRepository:          userRepo,
+		TokenRepository:         tokenRepo,
+		LoginAttemptRepository:  repositories.NewLoginAttemptRepository(db.Client),
+		DataExportRepository:    repositories.NewDataExportRepository(db.Client),
+		RoleRepository:          repositories.NewRoleRepository(db.Client),
+		OrganizationRepository:  orgRepo,
+		InvitationRepository:    repositories.NewInvitationRepository(db.Client),
+		ImpersonationRepository: impersonationRepo,
+		AuditRepository:         auditRepo,
+		DeviceRepository:        deviceRepo,
+		LoginEventRepository:    loginEventRepo,
+		IPRuleRepository:        ipRuleRepo,
+		IPFilter:                ipFilter,
+		TrustedProxies:          trustedProxies,
+		ClientIPHeader:          clientIPHeader,
+		AuditLog:                auditLog,
+		AuditCheckpointer:       auditCheckpointer,
+		IdentityService:         identityService,
+		ExportService: services.NewExportService(
+			services.NewUserExportSource(userRepo),
+			services.NewTokenExportSource(tokenRepo),
+			services.NewOrganizationExportSource(orgRepo),
+			services.NewImpersonationExportSource(impersonationRepo),
+			services.NewAuditExportSource(auditRepo),
+			services.NewDeviceExportSource(deviceRepo),
+			services.NewLoginEventExportSource(loginEventRepo),
+		),
+		PasswordPolicy: passwordPolicy,
+		RateLimiters:   rateLimiters,
 		Mailer: mailer.New(
 			cfg.Smtp.Host,
 			cfg.Smtp.Port,
@@ -35,6 +180,250 @@ func BootstrapApp(db *internal.DataStore, cfg *config.Confg) (*App, error) {
 	}, nil
 }
 
+func newPasswordPolicy(cfg *config.Confg) (*validator.PasswordPolicy, error) {
+	policy := validator.NewPasswordPolicy(cfg.PasswordPolicy.MinLength, cfg.PasswordPolicy.MaxLength)
+	policy.RequireUpper = cfg.PasswordPolicy.RequireUpper
+	policy.RequireLower = cfg.PasswordPolicy.RequireLower
+	policy.RequireDigit = cfg.PasswordPolicy.RequireDigit
+	policy.RequireSymbol = cfg.PasswordPolicy.RequireSymbol
+	policy.MinStrength = cfg.PasswordPolicy.MinStrength
+	// bcrypt ignores everything past its byte limit, so longer passwords are refused
+	if cfg.PasswordHashing.Algorithm == "bcrypt" {
+		policy.MaxBytes = hashing.BcryptMaxPasswordLength
+	}
+
+	if cfg.PasswordPolicy.BlocklistFile != "" {
+		if err := policy.LoadBlocklist(cfg.PasswordPolicy.BlocklistFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.PasswordPolicy.BreachFilter != "" {
+		filter, err := breach.Load(cfg.PasswordPolicy.BreachFilter)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = filter
+	}
+
+	return policy, nil
+}
+
+// newPasswordHasher hashes new passwords with the configured algorithm, while
+// still being able to verify (and upgrade) hashes made by all the others.
+func newPasswordHasher(cfg *config.Confg) (*hashing.Manager, error) {
+	argon2id := hashing.NewArgon2id(hashing.Argon2idParams{
+		Memory:      uint32(cfg.PasswordHashing.Argon2Memory),
+		Iterations:  uint32(cfg.PasswordHashing.Argon2Iterations),
+		Parallelism: uint8(cfg.PasswordHashing.Argon2Parallelism),
+		SaltLength:  hashing.DefaultArgon2idParams.SaltLength,
+		KeyLength:   hashing.DefaultArgon2idParams.KeyLength,
+	})
+	scrypt := hashing.NewScrypt(hashing.ScryptParams{
+		LogN:       uint8(cfg.PasswordHashing.ScryptLogN),
+		R:          cfg.PasswordHashing.ScryptR,
+		P:          cfg.PasswordHashing.ScryptP,
+		SaltLength: hashing.DefaultScryptParams.SaltLength,
+		KeyLength:  hashing.DefaultScryptParams.KeyLength,
+	})
+	bcrypt := hashing.NewBcrypt(cfg.PasswordHashing.BcryptCost)
+
+	var manager *hashing.Manager
+	switch cfg.PasswordHashing.Algorithm {
+	case argon2id.ID():
+		manager = hashing.NewManager(argon2id, scrypt, bcrypt)
+	case scrypt.ID():
+		manager = hashing.NewManager(scrypt, argon2id, bcrypt)
+	case bcrypt.ID():
+		manager = hashing.NewManager(bcrypt, argon2id, scrypt)
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", cfg.PasswordHashing.Algorithm)
+	}
+
+	// Hashes imported from other systems can be verified, and are upgraded to the
+	// current algorithm the first time the user signs in.
+	manager.Register(hashing.NewPBKDF2SHA256())
+	manager.Register(hashing.NewMD5Crypt())
+	if cfg.PasswordHashing.FirebaseSignerKey != "" {
+		firebase, err := hashing.NewFirebaseScrypt(hashing.FirebaseScryptParams{
+			SignerKey:     cfg.PasswordHashing.FirebaseSignerKey,
+			SaltSeparator: cfg.PasswordHashing.FirebaseSaltSeparator,
+			Rounds:        cfg.PasswordHashing.FirebaseRounds,
+			MemCost:       cfg.PasswordHashing.FirebaseMemCost,
+		})
+		if err != nil {
+			return nil, err
+		}
+		manager.Register(firebase)
+	}
+
+	var peppers *hashing.Peppers
+	var err error
+	switch {
+	case cfg.PasswordHashing.PepperFile != "":
+		peppers, err = hashing.LoadPeppers(cfg.PasswordHashing.PepperFile)
+	case cfg.PasswordHashing.Peppers != "":
+		peppers, err = hashing.ParsePeppers(cfg.PasswordHashing.Peppers)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading password peppers: %w", err)
+	}
+	manager.SetPeppers(peppers)
+
+	return manager, nil
+}
+
+// newRateLimiters sets up the limiters of the rate limited routes. Bursts of
+// requests from an IP address are fine, so those use token buckets, while limits
+// on emails sent to an address use sliding windows so they can't be doubled up
+// around a window boundary.
+func newRateLimiters(cfg *config.Confg, db *internal.DataStore) (*RateLimiters, error) {
+	var store ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "postgres":
+		store = ratelimit.NewPostgresStore(db.Client)
+	default:
+		return nil, fmt.Errorf("unsupported rate limit store %q", cfg.RateLimit.Store)
+	}
+
+	type newLimiterFunc func(ratelimit.Store, ratelimit.Rate) (ratelimit.Limiter, error)
+	tokenBucket := func(s ratelimit.Store, r ratelimit.Rate) (ratelimit.Limiter, error) {
+		return ratelimit.NewTokenBucket(s, r)
+	}
+	slidingWindow := func(s ratelimit.Store, r ratelimit.Rate) (ratelimit.Limiter, error) {
+		return ratelimit.NewSlidingWindow(s, r)
+	}
+
+	limiters := &RateLimiters{}
+	for _, l := range []struct {
+		dst  *ratelimit.Limiter
+		rate string
+		new  newLimiterFunc
+	}{
+		{&limiters.Signin, cfg.RateLimit.Signin, tokenBucket},
+		{&limiters.Register, cfg.RateLimit.Register, tokenBucket},
+		{&limiters.PasswordReset, cfg.RateLimit.PasswordReset, slidingWindow},
+		{&limiters.PasswordResetIP, cfg.RateLimit.PasswordResetIP, tokenBucket},
+		{&limiters.ActivationResend, cfg.RateLimit.ActivationResend, slidingWindow},
+		{&limiters.Export, cfg.RateLimit.Export, tokenBucket},
+	} {
+		rate, err := ratelimit.ParseRate(l.rate)
+		if err != nil {
+			return nil, err
+		}
+		if rate.Disabled() {
+			continue
+		}
+
+		limiter, err := l.new(store, rate)
+		if err != nil {
+			return nil, err
+		}
+		*l.dst = limiter
+	}
+
+	return limiters, nil
+}
+
+// newAuditSinks sets up the sinks audit events are sent to, on top of the
+// database.
+func newAuditSinks(cfg *config.Confg) ([]audit.Sink, error) {
+	var sinks []audit.Sink
+
+	if cfg.Audit.Syslog != "" {
+		format, err := audit.NewFormatter(cfg.Audit.SyslogFormat, cfg.GetVersion())
+		if err != nil {
+			return nil, err
+		}
+		sink, err := audit.NewSyslogSink(cfg.Audit.Syslog, format)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.Audit.File != "" {
+		format, err := audit.NewFormatter(cfg.Audit.FileFormat, cfg.GetVersion())
+		if err != nil {
+			return nil, err
+		}
+		maxSize := int64(cfg.Audit.FileMaxSize) * 1024 * 1024
+		sink, err := audit.NewFileSink(cfg.Audit.File, format, maxSize, cfg.Audit.FileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// newAuditCheckpointer returns nil, making no checkpoints, when there is no key
+// to sign them with.
+func newAuditCheckpointer(cfg *config.Confg, repo repositories.AuditRepositoryInterface) (*audit.Checkpointer, error) {
+	if cfg.Audit.SigningKeyFile == "" {
+		return nil, nil
+	}
+
+	key, err := audit.LoadSigningKey(cfg.Audit.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return audit.NewCheckpointer(repo, key, cfg.Audit.CheckpointInterval), nil
+}
+
+// newGeoIP returns nil, locating no sign ins, when there is no GeoIP database.
+func newGeoIP(cfg *config.Confg) (*geoip.Reader, error) {
+	if cfg.GeoIP.Database == "" {
+		return nil, nil
+	}
+	return geoip.Open(cfg.GeoIP.Database)
+}
+
+// newRiskEngine returns an engine with the risk rules that have a score. Rules
+// that need locations never score without a GeoIP database.
+func newRiskEngine(cfg *config.Confg) (*risk.Engine, error) {
+	var rules []risk.Rule
+	if cfg.Risk.NewCountryScore > 0 {
+		rules = append(rules, &risk.NewCountry{Score: cfg.Risk.NewCountryScore})
+	}
+	if cfg.Risk.ImpossibleTravelScore > 0 {
+		rules = append(rules, &risk.ImpossibleTravel{
+			Score:       cfg.Risk.ImpossibleTravelScore,
+			MaxSpeed:    cfg.Risk.ImpossibleTravelSpeed,
+			MinDistance: 200,
+		})
+	}
+	if cfg.Risk.IPList != "" && cfg.Risk.IPListScore > 0 {
+		list, err := risk.LoadIPList(cfg.Risk.IPList, cfg.Risk.IPListScore)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, list)
+	}
+	if cfg.Risk.UnusualHourScore > 0 {
+		rules = append(rules, &risk.UnusualHour{Score: cfg.Risk.UnusualHourScore, MinHistory: 10})
+	}
+	return risk.NewEngine(rules...), nil
+}
+
+// newClientIPHeader returns the name of the header the trusted proxies record
+// the client's address in.
+func newClientIPHeader(cfg *config.Confg) (string, error) {
+	switch cfg.ClientIPHeader {
+	case "forwarded":
+		return "Forwarded", nil
+	case "x-forwarded-for":
+		return "X-Forwarded-For", nil
+	case "x-real-ip":
+		return "X-Real-IP", nil
+	default:
+		return "", fmt.Errorf("unsupported client IP header %q", cfg.ClientIPHeader)
+	}
+}
+
 func (a *App) CloseDBConn() error {
 	return a.dataStore.Close()
 }
@@ -0,0 +1,74 @@
+// Package audit records security relevant events, such as sign ins, password
+// resets and changes made by admins, in the append-only audit log.
+package audit
+
+import (
+	"sync/atomic"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/pkg/logger"
+)
+
+// Log writes events to the audit log, and sends a copy to each of its sinks. A
+// nil *Log records nothing, which is convenient in tests.
+type Log struct {
+	repo   repositories.AuditRepositoryInterface
+	queues []*sinkQueue
+}
+
+func New(repo repositories.AuditRepositoryInterface, sinks ...Sink) *Log {
+	l := &Log{repo: repo}
+	for _, sink := range sinks {
+		l.queues = append(l.queues, newSinkQueue(sink, sinkQueueSize))
+	}
+	return l
+}
+
+// Record appends the event to the audit log, then queues it for the sinks, even
+// if it couldn't be stored. Only storing it is waited for, the sinks are sent it
+// in the background. A failure is logged rather than returned, as it shouldn't
+// fail the request the event is about.
+func (l *Log) Record(event *domain.AuditEvent) {
+	if l == nil {
+		return
+	}
+
+	if err := l.repo.Insert(event); err != nil {
+		logger.Error.Printf("failed recording audit event %s for actor %q and target %q: %v", event.Action, event.ActorID, event.TargetID, err)
+	}
+
+	for _, q := range l.queues {
+		q.send(event)
+	}
+}
+
+// Dropped returns how many events weren't sent to a sink, because its queue was
+// full or it was failing when the log was closed. An event dropped by two sinks
+// counts twice.
+func (l *Log) Dropped() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	var dropped uint64
+	for _, q := range l.queues {
+		dropped += atomic.LoadUint64(&q.dropped)
+	}
+	return dropped
+}
+
+// Close sends the events still queued, then closes the sinks.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, q := range l.queues {
+		if err := q.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
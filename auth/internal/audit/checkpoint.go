@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/pkg/logger"
+)
+
+// Checkpointer periodically signs the hash of the latest event in the audit log.
+// Someone with write access to the database could otherwise delete an event and
+// recompute the hashes of every event after it; they can't sign the new hashes
+// without the key.
+//
+// A nil *Checkpointer makes no checkpoints, which is what happens when no
+// signing key is configured.
+type Checkpointer struct {
+	repo     repositories.AuditRepositoryInterface
+	key      ed25519.PrivateKey
+	keyID    string
+	interval time.Duration
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func NewCheckpointer(repo repositories.AuditRepositoryInterface, key ed25519.PrivateKey, interval time.Duration) *Checkpointer {
+	return &Checkpointer{
+		repo:     repo,
+		key:      key,
+		keyID:    KeyID(key.Public().(ed25519.PublicKey)),
+		interval: interval,
+	}
+}
+
+// Checkpoint signs the latest event of the audit log. It returns nil if there is
+// nothing new to sign since the last checkpoint.
+func (c *Checkpointer) Checkpoint() (*domain.AuditCheckpoint, error) {
+	event, err := c.repo.Latest()
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	if len(event.Hash) == 0 {
+		return nil, nil
+	}
+
+	last, err := c.repo.LatestCheckpoint()
+	switch {
+	case err == nil && last.EventID >= event.ID:
+		return nil, nil
+	case err != nil && !errors.Is(err, repositories.ErrRecordNotFound):
+		return nil, err
+	}
+
+	checkpoint := &domain.AuditCheckpoint{
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		EventID:   event.ID,
+		EventHash: event.Hash,
+		KeyID:     c.keyID,
+	}
+	checkpoint.Signature = ed25519.Sign(c.key, checkpoint.SignedMessage())
+
+	if err := c.repo.InsertCheckpoint(checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// Start makes a checkpoint every interval, in the background, until Stop is
+// called.
+func (c *Checkpointer) Start() {
+	if c == nil {
+		return
+	}
+
+	c.stop = make(chan struct{})
+	c.done.Add(1)
+	go func() {
+		defer c.done.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.checkpoint()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops making checkpoints, after a final one covering the events recorded
+// since the last.
+func (c *Checkpointer) Stop() {
+	if c == nil || c.stop == nil {
+		return
+	}
+
+	close(c.stop)
+	c.done.Wait()
+	c.checkpoint()
+}
+
+func (c *Checkpointer) checkpoint() {
+	checkpoint, err := c.Checkpoint()
+	if err != nil {
+		logger.Error.Printf("failed making audit log checkpoint: %v", err)
+		return
+	}
+	if checkpoint != nil {
+		logger.Info.Printf("signed audit log checkpoint %d up to event %d", checkpoint.ID, checkpoint.EventID)
+	}
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// FileSink appends events to a file, one per line. Once the file would grow
+// past its maximum size it is rotated: path becomes path.1, path.1 becomes
+// path.2 and so on, and the oldest beyond the number of backups kept is removed.
+type FileSink struct {
+	path       string
+	format     Formatter
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink opens the file at path to append events to. A maxSize of 0 never
+// rotates it.
+func NewFileSink(path string, format Formatter, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{
+		path:       path,
+		format:     format,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Write(event *domain.AuditEvent) error {
+	line, err := s.format(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) open() error {
+	// Events include email addresses and IP addresses, so keep them private
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	if s.maxBackups < 1 {
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+		return s.open()
+	}
+
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(s.backup(i), s.backup(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.backup(1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) backup(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
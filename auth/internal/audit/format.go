@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// Identify the service in the events sent to sinks.
+const (
+	vendor  = "todo-app"
+	appName = "authservice"
+)
+
+// Formatter encodes an event for a sink.
+type Formatter func(event *domain.AuditEvent) ([]byte, error)
+
+// NewFormatter returns the formatter with the given name, either "json" or
+// "cef". version is the version of the service reported in CEF.
+func NewFormatter(name, version string) (Formatter, error) {
+	switch name {
+	case "json":
+		return FormatJSON, nil
+	case "cef":
+		return func(event *domain.AuditEvent) ([]byte, error) {
+			return FormatCEF(event, version)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported audit event format %q", name)
+	}
+}
+
+// FormatJSON encodes the event as the admin audit API returns it.
+func FormatJSON(event *domain.AuditEvent) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// FormatCEF encodes the event in ArcSight's Common Event Format:
+//
+//	CEF:0|todo-app|authservice|<version>|<action>|<action>|<severity>|<extensions>
+func FormatCEF(event *domain.AuditEvent, version string) ([]byte, error) {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeader(vendor), cefHeader(appName), cefHeader(version),
+		cefHeader(event.Action), cefHeader(event.Action), severity(event.Action))
+
+	var extensions []string
+	add := func(key, value string) {
+		if value != "" {
+			extensions = append(extensions, key+"="+cefExtension(value))
+		}
+	}
+	// CEF has no fields of its own for these, so they go in labelled custom ones
+	addCustom := func(key, label, value string) {
+		if value != "" {
+			add(key+"Label", label)
+			add(key, value)
+		}
+	}
+
+	add("rt", strconv.FormatInt(event.OccurredAt.UnixNano()/1e6, 10))
+	add("externalId", strconv.FormatInt(event.ID, 10))
+	add("suid", event.ActorID)
+	add("suser", event.ActorEmail)
+	addCustom("cs1", "targetType", event.TargetType)
+	add("duid", event.TargetID)
+	add("src", event.IP)
+	add("requestClientApplication", event.UserAgent)
+	addCustom("cs2", "requestId", event.RequestID)
+	addCustom("cs3", "metadata", string(metadata))
+	addCustom("cs4", "hash", hex.EncodeToString(event.Hash))
+	b.WriteString(strings.Join(extensions, " "))
+
+	return []byte(b.String()), nil
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+func cefHeader(s string) string {
+	return cefHeaderEscaper.Replace(s)
+}
+
+func cefExtension(s string) string {
+	return cefExtensionEscaper.Replace(s)
+}
+
+// severity rates how important an action is to a security team, from 0 to 10
+// as in CEF.
+func severity(action string) int {
+	switch action {
+	case domain.AuditAccountLocked, domain.AuditAccountSecured:
+		return 7
+	case domain.AuditImpersonationStarted:
+		return 6
+	case domain.AuditLoginFailed, domain.AuditLoginNewDevice, domain.AuditUserStatusChanged, domain.AuditUserDeleted,
+		domain.AuditRoleAssigned, domain.AuditRoleRemoved, domain.AuditIPRuleCreated, domain.AuditIPRuleDeleted,
+		domain.AuditOrganizationMemberUpdated, domain.AuditOrganizationMemberRemoved:
+		return 5
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// LoadSigningKey reads the ed25519 key checkpoints are signed with from a PEM
+// encoded PKCS #8 file, such as one made with
+//
+//	openssl genpkey -algorithm ed25519 -out audit.key
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing audit signing key %s: %w", path, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("audit signing key %s is not an ed25519 key", path)
+	}
+	return privateKey, nil
+}
+
+// LoadVerifyingKey reads the ed25519 key checkpoints are verified with from a
+// PEM encoded public key file, such as one made with
+//
+//	openssl pkey -in audit.key -pubout -out audit.pub
+//
+// The private key file is accepted too.
+func LoadVerifyingKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "PRIVATE KEY" {
+		privateKey, err := LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return privateKey.Public().(ed25519.PublicKey), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing audit verifying key %s: %w", path, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("audit verifying key %s is not an ed25519 key", path)
+	}
+	return publicKey, nil
+}
+
+// KeyID identifies a public key in the checkpoints it signed, so the key that
+// verifies them can be found once the signing key has been rotated.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data found in " + path)
+	}
+	return block, nil
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/pkg/logger"
+)
+
+const (
+	// sinkQueueSize is how many events wait for a sink before they are dropped.
+	sinkQueueSize = 1024
+	// A sink that fails is left alone for a while before the next event is sent,
+	// doubling each time it fails again.
+	minSinkBackoff = time.Second
+	maxSinkBackoff = time.Minute
+)
+
+// sinkQueue sends events to a sink from a goroutine of its own, so a slow or
+// unreachable sink, such as a syslog server that is down, doesn't hold up the
+// requests the events are about. Events are dropped when the queue is full.
+type sinkQueue struct {
+	sink    Sink
+	events  chan *domain.AuditEvent
+	closing chan struct{}
+	done    chan struct{}
+	dropped uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newSinkQueue(sink Sink, size int) *sinkQueue {
+	q := &sinkQueue{
+		sink:    sink,
+		events:  make(chan *domain.AuditEvent, size),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// send queues the event without waiting, dropping it if the queue is full.
+func (q *sinkQueue) send(event *domain.AuditEvent) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		q.drop(event, "the audit log is closed")
+		return
+	}
+
+	select {
+	case q.events <- event:
+	default:
+		q.drop(event, "its queue is full")
+	}
+}
+
+func (q *sinkQueue) drop(event *domain.AuditEvent, reason string) {
+	// Only log every power of two drops, a sink that is down would flood the log
+	n := atomic.AddUint64(&q.dropped, 1)
+	if n&(n-1) == 0 {
+		logger.Error.Printf("dropped audit event %s for %T as %s, %d dropped so far", event.Action, q.sink, reason, n)
+	}
+}
+
+func (q *sinkQueue) run() {
+	defer close(q.done)
+
+	var backoff time.Duration
+	for event := range q.events {
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-q.closing:
+				// Don't hold up shutting down for a sink that is failing
+				q.drop(event, "it is failing")
+				continue
+			}
+		}
+
+		if err := q.sink.Write(event); err != nil {
+			logger.Error.Printf("failed sending audit event %s to %T: %v", event.Action, q.sink, err)
+			backoff *= 2
+			if backoff < minSinkBackoff {
+				backoff = minSinkBackoff
+			}
+			if backoff > maxSinkBackoff {
+				backoff = maxSinkBackoff
+			}
+			continue
+		}
+		backoff = 0
+	}
+}
+
+// close sends the events still queued, then closes the sink.
+func (q *sinkQueue) close() error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.closing)
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	<-q.done
+	return q.sink.Close()
+}
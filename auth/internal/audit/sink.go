@@ -0,0 +1,12 @@
+package audit
+
+import (
+	"github.com/todo-app/internal/domain"
+)
+
+// Sink receives a copy of every event recorded in the audit log, e.g. to pass it
+// on to a SIEM.
+type Sink interface {
+	Write(event *domain.AuditEvent) error
+	Close() error
+}
@@ -0,0 +1,329 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+)
+
+func testEvent() *domain.AuditEvent {
+	return (&domain.AuditEvent{
+		ID:         42,
+		OccurredAt: time.Date(2021, 6, 1, 12, 30, 0, 123456000, time.UTC),
+		Action:     domain.AuditLoginFailed,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   "7b6c5a52-7c4e-4d8f-9d4b-1f0e3c2a1b00",
+		IP:         "203.0.113.7",
+		UserAgent:  "curl/7.68.0",
+		RequestID:  "abc123",
+	}).With("reason", "wrong password")
+}
+
+// rfc5424 matches the header of the syslog messages sent for testEvent.
+var rfc5424 = regexp.MustCompile(`^<85>1 2021-06-01T12:30:00\.123456Z \S+ authservice \d+ login\.failed - `)
+
+func TestFormatCEF(t *testing.T) {
+	event := testEvent().With("note", "a=b|c\\d\ne")
+	event.ActorEmail = "jane@example.com"
+
+	got, err := FormatCEF(event, "1.0|beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `CEF:0|todo-app|authservice|1.0\|beta|login.failed|login.failed|5|` +
+		`rt=1622550600123 externalId=42 suser=jane@example.com cs1Label=targetType cs1=user ` +
+		`duid=7b6c5a52-7c4e-4d8f-9d4b-1f0e3c2a1b00 src=203.0.113.7 requestClientApplication=curl/7.68.0 ` +
+		`cs2Label=requestId cs2=abc123 cs3Label=metadata cs3={"note":"a\=b|c\\\\d\\ne","reason":"wrong password"}`
+	if string(got) != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogSink("udp://"+conn.LocalAddr().String(), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertSyslogMessage(t, string(buf[:n]))
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sink, err := NewSyslogSink("tcp://"+ln.Addr().String(), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		readFramed(conn, messages)
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(testEvent()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-messages:
+			assertSyslogMessage(t, msg)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for message %d", i+1)
+		}
+	}
+}
+
+func TestSyslogSinkUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogSink("unix://"+path, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertSyslogMessage(t, string(buf[:n]))
+}
+
+func TestNewSyslogSinkInvalid(t *testing.T) {
+	for _, target := range []string{"", "localhost:514", "http://localhost:514", "udp://", "unix://"} {
+		if _, err := NewSyslogSink(target, FormatJSON); err == nil {
+			t.Errorf("want an error for %q", target)
+		}
+	}
+}
+
+// readFramed reads octet counted messages from r until it is closed.
+func readFramed(r net.Conn, messages chan<- string) {
+	br := bufio.NewReader(r)
+	for {
+		length, err := br.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(br, msg); err != nil {
+			return
+		}
+		messages <- string(msg)
+	}
+}
+
+func assertSyslogMessage(t *testing.T, msg string) {
+	t.Helper()
+
+	if !rfc5424.MatchString(msg) {
+		t.Fatalf("want an RFC 5424 message; got %q", msg)
+	}
+
+	var event domain.AuditEvent
+	if err := json.Unmarshal([]byte(rfc5424.ReplaceAllString(msg, "")), &event); err != nil {
+		t.Fatalf("want a JSON event; got %q: %v", msg, err)
+	}
+	if event.ID != 42 || event.Action != domain.AuditLoginFailed {
+		t.Errorf("want event 42 %s; got %d %s", domain.AuditLoginFailed, event.ID, event.Action)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	line, err := FormatJSON(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineSize := int64(len(line) + 1)
+
+	// Room for two events per file, and two backups
+	path := filepath.Join(dir, "audit.jsonl")
+	sink, err := NewFileSink(path, FormatJSON, 2*lineSize, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(testEvent()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, wantLines := range map[string]int{
+		path:        1,
+		path + ".1": 2,
+		path + ".2": 2,
+	} {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(b), "\n"); got != wantLines {
+			t.Errorf("want %d events in %s; got %d", wantLines, filepath.Base(file), got)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("want only 2 backups kept; got err %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("want mode 0600; got %v", info.Mode().Perm())
+	}
+}
+
+func TestLogSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	sink, err := NewFileSink(path, FormatJSON, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &memoryRepository{}
+	log := New(repo, sink)
+	log.Record(&domain.AuditEvent{Action: domain.AuditLoginSucceeded})
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event domain.AuditEvent
+	if err := json.Unmarshal(b, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sinks get the event as stored, with its id and hash
+	if len(repo.events) != 1 || event.ID != repo.events[0].ID || string(event.Hash) != string(repo.events[0].Hash) {
+		t.Errorf("want the stored event; got %+v", event)
+	}
+}
+
+// blockingSink doesn't return from Write until it is released, like a syslog
+// server that has stopped answering.
+type blockingSink struct {
+	release chan struct{}
+	written int32
+}
+
+func (s *blockingSink) Write(event *domain.AuditEvent) error {
+	<-s.release
+	atomic.AddInt32(&s.written, 1)
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestLogBlockingSink(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	log := New(&memoryRepository{}, sink)
+
+	// One event is taken by the sink, a queue full more are waiting, and the
+	// rest are dropped
+	const events = sinkQueueSize + 10
+	start := time.Now()
+	for i := 0; i < events; i++ {
+		log.Record(&domain.AuditEvent{Action: domain.AuditLoginSucceeded})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want Record not to wait for the sink; took %v", elapsed)
+	}
+	if dropped := log.Dropped(); dropped == 0 {
+		t.Errorf("want events dropped once the queue is full")
+	}
+
+	// Closing sends whatever is still queued
+	close(sink.release)
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if written, dropped := uint64(atomic.LoadInt32(&sink.written)), log.Dropped(); written+dropped != events {
+		t.Errorf("want every event written or dropped; got %d written and %d dropped of %d", written, dropped, events)
+	}
+}
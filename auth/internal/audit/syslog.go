@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+)
+
+const (
+	// The authpriv facility, as events include email addresses
+	syslogFacility = 10
+	syslogTimeout  = 2 * time.Second
+)
+
+// SyslogSink sends events to a syslog server as RFC 5424 messages. Messages
+// sent over a stream are framed by octet counting (RFC 6587).
+type SyslogSink struct {
+	network  string
+	addr     string
+	format   Formatter
+	hostname string
+	pid      int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool
+}
+
+// NewSyslogSink returns a sink sending events to the syslog server at target,
+// which is one of udp://host:port, tcp://host:port or unix:///path/to/socket.
+// It connects on the first event, so the server doesn't have to be up yet.
+func NewSyslogSink(target string, format Formatter) (*SyslogSink, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %w", target, err)
+	}
+
+	s := &SyslogSink{network: u.Scheme, format: format, pid: os.Getpid()}
+	switch u.Scheme {
+	case "udp", "tcp":
+		s.addr = u.Host
+	case "unix":
+		s.addr = u.Path
+	default:
+		return nil, fmt.Errorf("invalid syslog address %q, must be udp://, tcp:// or unix://", target)
+	}
+	if s.addr == "" {
+		return nil, fmt.Errorf("invalid syslog address %q, it has no host or path", target)
+	}
+
+	s.hostname, _ = os.Hostname()
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+	return s, nil
+}
+
+// Write sends the event, reconnecting once if the connection was lost.
+func (s *SyslogSink) Write(event *domain.AuditEvent) error {
+	msg, err := s.format(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		err = s.write(s.message(event, msg))
+		if err == nil || attempt == 1 {
+			return err
+		}
+		s.close()
+	}
+}
+
+func (s *SyslogSink) write(message []byte) error {
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+
+	if s.stream {
+		message = append([]byte(fmt.Sprintf("%d ", len(message))), message...)
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err := s.conn.Write(message)
+	return err
+}
+
+func (s *SyslogSink) dial() error {
+	var err error
+	switch s.network {
+	case "unix":
+		// Local syslog daemons usually listen on a datagram socket, but not always
+		s.conn, err = net.DialTimeout("unixgram", s.addr, syslogTimeout)
+		s.stream = false
+		if err != nil {
+			s.conn, err = net.DialTimeout("unix", s.addr, syslogTimeout)
+			s.stream = true
+		}
+	default:
+		s.conn, err = net.DialTimeout(s.network, s.addr, syslogTimeout)
+		s.stream = s.network == "tcp"
+	}
+	if err != nil {
+		s.conn = nil
+	}
+	return err
+}
+
+// message returns the syslog message of the event:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+//
+// The event's action is the MSGID, and its formatted content the MSG.
+func (s *SyslogSink) message(event *domain.AuditEvent, msg []byte) []byte {
+	occurredAt := event.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+
+	msgID := event.Action
+	if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ",
+		syslogFacility*8+syslogSeverity(event.Action),
+		occurredAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, appName, s.pid, msgID)
+	return append([]byte(header), msg...)
+}
+
+// syslogSeverity maps the CEF severity of an action to a syslog severity.
+func syslogSeverity(action string) int {
+	switch sev := severity(action); {
+	case sev >= 7:
+		return 4 // warning
+	case sev >= 5:
+		return 5 // notice
+	default:
+		return 6 // informational
+	}
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.close()
+}
+
+func (s *SyslogSink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
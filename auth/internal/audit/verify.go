@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+)
+
+// verifyBatchSize is how many events Verify reads at a time.
+const verifyBatchSize = 500
+
+// Problem is evidence found by Verify that the audit log was tampered with.
+type Problem struct {
+	EventID int64
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("event %d: %s", p.EventID, p.Message)
+}
+
+// Report is the outcome of verifying the audit log.
+type Report struct {
+	// Events is how many events were checked.
+	Events int
+	// Unchained is how many events were recorded before the log was chained,
+	// and so can't be verified.
+	Unchained int
+	// Checkpoints is how many checkpoints have a valid signature.
+	Checkpoints int
+	// LastEventID is the id of the last event in the log.
+	LastEventID int64
+	Problems    []Problem
+}
+
+// OK reports whether no sign of tampering was found.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) addProblem(eventID int64, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{EventID: eventID, Message: fmt.Sprintf(format, args...)})
+}
+
+// Verify walks the audit log from the first event to the last, and reports the
+// events whose contents no longer match their hash, the breaks in the chain left
+// by events being removed or inserted, and the signed checkpoints that don't
+// match the log. keys are the public keys checkpoints may have been signed with.
+//
+// Events removed from the end of the log since the last checkpoint can't be
+// detected, so checkpoints should be made often.
+func Verify(repo repositories.AuditRepositoryInterface, keys ...ed25519.PublicKey) (*Report, error) {
+	report := &Report{}
+
+	checkpoints, err := verifiedCheckpoints(repo, keys, report)
+	if err != nil {
+		return nil, err
+	}
+
+	var prevHash []byte
+	var prevID int64
+	chained := false
+	for {
+		events, err := repo.ListChain(report.LastEventID, verifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range events {
+			report.Events++
+			report.LastEventID = e.ID
+
+			switch {
+			case len(e.Hash) == 0 && !chained:
+				report.Unchained++
+			case len(e.Hash) == 0:
+				report.addProblem(e.ID, "has no hash, so it wasn't recorded by the service")
+			default:
+				chained = true
+				verifyEvent(e, prevID, prevHash, report)
+			}
+
+			for _, c := range checkpoints[e.ID] {
+				if !bytes.Equal(c.EventHash, e.Hash) {
+					report.addProblem(e.ID, "doesn't match the hash signed by checkpoint %d", c.ID)
+				}
+			}
+			delete(checkpoints, e.ID)
+
+			prevHash, prevID = e.Hash, e.ID
+		}
+
+		if len(events) < verifyBatchSize {
+			break
+		}
+	}
+
+	// Whatever is left was signed but is no longer in the log
+	missing := make([]int64, 0, len(checkpoints))
+	for id := range checkpoints {
+		missing = append(missing, id)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	for _, id := range missing {
+		report.addProblem(id, "was signed by checkpoint %d but is missing from the log", checkpoints[id][0].ID)
+	}
+
+	return report, nil
+}
+
+// verifyEvent checks the event is what was hashed when it was recorded, and that
+// it follows the event before it.
+func verifyEvent(e *domain.AuditEvent, prevID int64, prevHash []byte, report *Report) {
+	if !bytes.Equal(e.PrevHash, prevHash) {
+		switch {
+		case prevID == 0:
+			report.addProblem(e.ID, "follows an event that is missing from the log")
+		default:
+			report.addProblem(e.ID, "doesn't follow event %d, so an event between them was removed or event %d was modified", prevID, prevID)
+		}
+	}
+
+	hash, err := e.ChainHash(e.PrevHash)
+	if err != nil {
+		report.addProblem(e.ID, "can't be hashed: %v", err)
+		return
+	}
+	if !bytes.Equal(hash, e.Hash) {
+		report.addProblem(e.ID, "was modified, its contents don't match its hash")
+	}
+}
+
+// verifiedCheckpoints returns the checkpoints with a valid signature by the id of
+// the event they signed, and reports the rest.
+func verifiedCheckpoints(repo repositories.AuditRepositoryInterface, keys []ed25519.PublicKey, report *Report) (map[int64][]*domain.AuditCheckpoint, error) {
+	keysByID := make(map[string]ed25519.PublicKey, len(keys))
+	for _, key := range keys {
+		keysByID[KeyID(key)] = key
+	}
+
+	checkpoints, err := repo.ListCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	verified := make(map[int64][]*domain.AuditCheckpoint)
+	for _, c := range checkpoints {
+		key, ok := keysByID[c.KeyID]
+		switch {
+		case !ok:
+			report.addProblem(c.EventID, "checkpoint %d is signed by unknown key %s", c.ID, c.KeyID)
+		case !ed25519.Verify(key, c.SignedMessage(), c.Signature):
+			report.addProblem(c.EventID, "checkpoint %d has an invalid signature", c.ID)
+		default:
+			report.Checkpoints++
+			verified[c.EventID] = append(verified[c.EventID], c)
+		}
+	}
+	return verified, nil
+}
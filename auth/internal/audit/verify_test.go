@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+)
+
+// memoryRepository chains events like AuditRepository, and round trips their
+// metadata through JSON like the jsonb column does.
+type memoryRepository struct {
+	events      []*domain.AuditEvent
+	checkpoints []*domain.AuditCheckpoint
+}
+
+func (m *memoryRepository) Insert(event *domain.AuditEvent) error {
+	var prevHash []byte
+	if len(m.events) > 0 {
+		prevHash = m.events[len(m.events)-1].Hash
+	}
+
+	event.ID = int64(len(m.events) + 1)
+	event.OccurredAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.PrevHash = prevHash
+
+	var err error
+	event.Hash, err = event.ChainHash(prevHash)
+	if err != nil {
+		return err
+	}
+
+	stored := *event
+	b, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	stored.Metadata = nil
+	if err := json.Unmarshal(b, &stored.Metadata); err != nil {
+		return err
+	}
+	m.events = append(m.events, &stored)
+	return nil
+}
+
+func (m *memoryRepository) List(filter repositories.AuditFilter) ([]*domain.AuditEvent, *repositories.Cursor, error) {
+	return nil, nil, nil
+}
+
+func (m *memoryRepository) Latest() (*domain.AuditEvent, error) {
+	if len(m.events) == 0 {
+		return nil, repositories.ErrRecordNotFound
+	}
+	return m.events[len(m.events)-1], nil
+}
+
+func (m *memoryRepository) ListChain(afterID int64, limit int) ([]*domain.AuditEvent, error) {
+	events := []*domain.AuditEvent{}
+	for _, e := range m.events {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryRepository) InsertCheckpoint(checkpoint *domain.AuditCheckpoint) error {
+	checkpoint.ID = int64(len(m.checkpoints) + 1)
+	m.checkpoints = append(m.checkpoints, checkpoint)
+	return nil
+}
+
+func (m *memoryRepository) LatestCheckpoint() (*domain.AuditCheckpoint, error) {
+	if len(m.checkpoints) == 0 {
+		return nil, repositories.ErrRecordNotFound
+	}
+	return m.checkpoints[len(m.checkpoints)-1], nil
+}
+
+func (m *memoryRepository) ListCheckpoints() ([]*domain.AuditCheckpoint, error) {
+	return m.checkpoints, nil
+}
+
+func (m *memoryRepository) remove(id int64) {
+	for i, e := range m.events {
+		if e.ID == id {
+			m.events = append(m.events[:i], m.events[i+1:]...)
+			return
+		}
+	}
+}
+
+// rehash recomputes the hashes of every event, as someone without the signing
+// key covering their tracks would.
+func (m *memoryRepository) rehash() {
+	var prevHash []byte
+	for _, e := range m.events {
+		e.PrevHash = prevHash
+		e.Hash, _ = e.ChainHash(prevHash)
+		prevHash = e.Hash
+	}
+}
+
+func TestVerify(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		tamper       func(m *memoryRepository)
+		keys         []ed25519.PublicKey
+		wantProblems []string
+	}{
+		{
+			name:   "Untouched",
+			tamper: func(m *memoryRepository) {},
+			keys:   []ed25519.PublicKey{publicKey},
+		},
+		{
+			name:   "Keys rotated since the checkpoint",
+			tamper: func(m *memoryRepository) {},
+			keys:   []ed25519.PublicKey{otherKey, publicKey},
+		},
+		{
+			name: "Checkpoint claiming another key",
+			tamper: func(m *memoryRepository) {
+				m.checkpoints[0].KeyID = KeyID(otherKey)
+			},
+			keys:         []ed25519.PublicKey{otherKey, publicKey},
+			wantProblems: []string{"event 5: checkpoint 1 has an invalid signature"},
+		},
+		{
+			name:         "Checkpoint signed by an unknown key",
+			tamper:       func(m *memoryRepository) {},
+			keys:         []ed25519.PublicKey{otherKey},
+			wantProblems: []string{"event 5: checkpoint 1 is signed by unknown key " + KeyID(publicKey)},
+		},
+		{
+			name: "Modified event",
+			tamper: func(m *memoryRepository) {
+				m.events[2].ActorEmail = "someone-else@example.com"
+			},
+			keys:         []ed25519.PublicKey{publicKey},
+			wantProblems: []string{"event 3: was modified, its contents don't match its hash"},
+		},
+		{
+			name: "Modified metadata",
+			tamper: func(m *memoryRepository) {
+				m.events[1].Metadata["attempt"] = float64(1)
+			},
+			keys:         []ed25519.PublicKey{publicKey},
+			wantProblems: []string{"event 2: was modified, its contents don't match its hash"},
+		},
+		{
+			name: "Removed event",
+			tamper: func(m *memoryRepository) {
+				m.remove(2)
+			},
+			keys:         []ed25519.PublicKey{publicKey},
+			wantProblems: []string{"event 3: doesn't follow event 1, so an event between them was removed or event 1 was modified"},
+		},
+		{
+			name: "Removed first event",
+			tamper: func(m *memoryRepository) {
+				m.remove(1)
+			},
+			keys:         []ed25519.PublicKey{publicKey},
+			wantProblems: []string{"event 2: follows an event that is missing from the log"},
+		},
+		{
+			name: "Removed and rehashed",
+			tamper: func(m *memoryRepository) {
+				m.remove(2)
+				m.rehash()
+			},
+			keys:         []ed25519.PublicKey{publicKey},
+			wantProblems: []string{"event 5: doesn't match the hash signed by checkpoint 1"},
+		},
+		{
+			name: "Removed checkpointed events",
+			tamper: func(m *memoryRepository) {
+				m.remove(6)
+				m.remove(5)
+			},
+			keys:         []ed25519.PublicKey{publicKey},
+			wantProblems: []string{"event 5: was signed by checkpoint 1 but is missing from the log"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memoryRepository{}
+			log := New(repo)
+			checkpointer := NewCheckpointer(repo, privateKey, time.Hour)
+
+			for i := 0; i < 5; i++ {
+				log.Record((&domain.AuditEvent{Action: domain.AuditLoginFailed}).With("attempt", i+1))
+			}
+			if _, err := checkpointer.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			log.Record(&domain.AuditEvent{Action: domain.AuditLoginSucceeded})
+
+			tt.tamper(repo)
+
+			report, err := Verify(repo, tt.keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, p := range report.Problems {
+				got = append(got, p.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.wantProblems, "\n") {
+				t.Errorf("want problems %q; got %q", tt.wantProblems, got)
+			}
+		})
+	}
+}
+
+func TestVerifyUnchained(t *testing.T) {
+	repo := &memoryRepository{}
+	repo.events = append(repo.events, &domain.AuditEvent{ID: 1, Action: domain.AuditLoginSucceeded})
+	New(repo).Record(&domain.AuditEvent{Action: domain.AuditLoginSucceeded})
+
+	report, err := Verify(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("want no problems; got %v", report.Problems)
+	}
+	if report.Events != 2 || report.Unchained != 1 {
+		t.Errorf("want 2 events, 1 unchained; got %d events, %d unchained", report.Events, report.Unchained)
+	}
+}
+
+func TestCheckpointNothingNew(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &memoryRepository{}
+	checkpointer := NewCheckpointer(repo, privateKey, time.Hour)
+
+	checkpoint, err := checkpointer.Checkpoint()
+	if err != nil || checkpoint != nil {
+		t.Fatalf("want no checkpoint of an empty log; got %v, %v", checkpoint, err)
+	}
+
+	New(repo).Record(&domain.AuditEvent{Action: domain.AuditLoginSucceeded})
+	if checkpoint, err = checkpointer.Checkpoint(); err != nil || checkpoint == nil {
+		t.Fatalf("want a checkpoint; got %v, %v", checkpoint, err)
+	}
+	if checkpoint, err = checkpointer.Checkpoint(); err != nil || checkpoint != nil {
+		t.Fatalf("want no second checkpoint of the same event; got %v, %v", checkpoint, err)
+	}
+}
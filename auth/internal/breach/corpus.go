@@ -0,0 +1,40 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseHashLine parses a single line of a Pwned Passwords style corpus. A line is
+// either a full 40 character hex SHA-1 digest, or when reading a range file, the
+// 35 character suffix that follows the 5 character prefix the file is named after.
+// Either form may be followed by ":<count>", the number of times the password was
+// seen in breaches. When there is no count, 1 is returned.
+func ParseHashLine(prefix, line string) ([sha1.Size]byte, int, error) {
+	var digest [sha1.Size]byte
+
+	line = strings.TrimSpace(line)
+	count := 1
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		c, err := strconv.Atoi(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return digest, 0, fmt.Errorf("invalid count in %q: %w", line, err)
+		}
+		count = c
+		line = line[:i]
+	}
+
+	full := prefix + line
+	if len(full) != hex.EncodedLen(sha1.Size) {
+		return digest, 0, fmt.Errorf("invalid SHA-1 digest %q", full)
+	}
+
+	if _, err := hex.Decode(digest[:], []byte(full)); err != nil {
+		return digest, 0, fmt.Errorf("invalid SHA-1 digest %q: %w", full, err)
+	}
+
+	return digest, count, nil
+}
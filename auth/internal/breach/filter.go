@@ -0,0 +1,236 @@
+// Package breach screens passwords against a corpus of passwords known to have
+// been exposed in data breaches, such as the Pwned Passwords list, without any
+// network call.
+//
+// The corpus is far too large to hold in memory, so it is compiled ahead of time
+// (see cmd/breachfilter) into a bloom filter of the SHA-1 digests of the breached
+// passwords. A bloom filter never gives false negatives, and the false positive
+// rate is chosen when the filter is built, so at worst a tiny fraction of safe
+// passwords get rejected.
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// magic identifies a breach filter file. It is followed by a format version.
+var magic = [8]byte{'P', 'W', 'N', 'B', 'L', 'O', 'O', 'M'}
+
+const formatVersion uint32 = 1
+
+var (
+	ErrInvalidFilter     = errors.New("not a breached password filter file")
+	ErrUnsupported       = errors.New("unsupported breached password filter version")
+	ErrFalsePositiveRate = errors.New("false positive rate must be between 0 and 1")
+)
+
+// Filter is a bloom filter of SHA-1 password digests.
+type Filter struct {
+	// k is the number of bit positions set for every digest
+	k uint32
+	// m is the size of the filter in bits
+	m uint64
+	// n is the number of digests that were added to the filter
+	n    uint64
+	bits []uint64
+}
+
+// New returns an empty filter sized to hold n digests with the given false
+// positive rate, e.g. 0.001 for one in a thousand.
+func New(n uint64, falsePositiveRate float64) (*Filter, error) {
+	// Written so that NaN is refused too
+	if !(falsePositiveRate > 0 && falsePositiveRate < 1) {
+		return nil, ErrFalsePositiveRate
+	}
+	if n == 0 {
+		n = 1
+	}
+	// Optimal size and number of hash functions for a bloom filter
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+
+	// Round up to a whole number of words
+	words := (m + 63) / 64
+	return &Filter{
+		k:    k,
+		m:    words * 64,
+		bits: make([]uint64, words),
+	}, nil
+}
+
+// Len returns the number of digests added to the filter.
+func (f *Filter) Len() uint64 {
+	return f.n
+}
+
+// Add adds a password to the filter.
+func (f *Filter) Add(password string) {
+	f.AddDigest(sha1.Sum([]byte(password)))
+}
+
+// AddDigest adds the SHA-1 digest of a password to the filter. This is what the
+// Pwned Passwords corpus is distributed as.
+func (f *Filter) AddDigest(digest [sha1.Size]byte) {
+	h1, h2 := split(digest)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		pos := (h1 + i*h2) % f.m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+	f.n++
+}
+
+// Contains reports whether the password is (very probably) in the corpus.
+func (f *Filter) Contains(password string) bool {
+	return f.ContainsDigest(sha1.Sum([]byte(password)))
+}
+
+// ContainsDigest reports whether the SHA-1 digest is (very probably) in the corpus.
+func (f *Filter) ContainsDigest(digest [sha1.Size]byte) bool {
+	h1, h2 := split(digest)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		pos := (h1 + i*h2) % f.m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// split derives the two base hashes used for double hashing. SHA-1 output is
+// already uniformly distributed so we can simply slice it up. h2 is forced to be
+// odd so that it can never be zero.
+func split(digest [sha1.Size]byte) (uint64, uint64) {
+	h1 := binary.LittleEndian.Uint64(digest[0:8])
+	h2 := binary.LittleEndian.Uint64(digest[8:16]) | 1
+	return h1, h2
+}
+
+// WriteTo writes the filter in its binary file format:
+//
+//	magic (8 bytes) | version (uint32) | k (uint32) | m (uint64) | n (uint64) | bits
+//
+// All integers are little endian.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 0, 32)
+	header = append(header, magic[:]...)
+	header = appendUint32(header, formatVersion)
+	header = appendUint32(header, f.k)
+	header = appendUint64(header, f.m)
+	header = appendUint64(header, f.n)
+
+	written, err := bw.Write(header)
+	if err != nil {
+		return int64(written), err
+	}
+
+	buf := make([]byte, 8)
+	for _, word := range f.bits {
+		binary.LittleEndian.PutUint64(buf, word)
+		n, err := bw.Write(buf)
+		written += n
+		if err != nil {
+			return int64(written), err
+		}
+	}
+
+	return int64(written), bw.Flush()
+}
+
+// headerSize is the size of the header written before the bits of a filter.
+const headerSize = 32
+
+// maxPreallocWords caps how much of the filter is allocated up front when the
+// size of the input isn't known, so a corrupt header can't claim more memory
+// than the input actually holds.
+const maxPreallocWords = 1 << 20
+
+// Read parses a filter previously written with WriteTo.
+func Read(r io.Reader) (*Filter, error) {
+	return read(r, -1)
+}
+
+// Load reads a filter from the file at path.
+func Load(path string) (*Filter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return read(file, info.Size())
+}
+
+// read parses a filter from r, which holds size bytes, or -1 if that isn't known.
+func read(r io.Reader, size int64) (*Filter, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrInvalidFilter
+	}
+
+	var got [8]byte
+	copy(got[:], header[0:8])
+	if got != magic {
+		return nil, ErrInvalidFilter
+	}
+	if binary.LittleEndian.Uint32(header[8:12]) != formatVersion {
+		return nil, ErrUnsupported
+	}
+
+	f := &Filter{
+		k: binary.LittleEndian.Uint32(header[12:16]),
+		m: binary.LittleEndian.Uint64(header[16:24]),
+		n: binary.LittleEndian.Uint64(header[24:32]),
+	}
+	if f.k == 0 || f.m == 0 || f.m%64 != 0 {
+		return nil, ErrInvalidFilter
+	}
+
+	words := f.m / 64
+	prealloc := words
+	if size >= 0 {
+		// The file has to hold exactly the bits the header says it does
+		if uint64(size-headerSize) != words*8 {
+			return nil, ErrInvalidFilter
+		}
+	} else if prealloc > maxPreallocWords {
+		prealloc = maxPreallocWords
+	}
+
+	f.bits = make([]uint64, 0, prealloc)
+	buf := make([]byte, 8)
+	for i := uint64(0); i < words; i++ {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, ErrInvalidFilter
+		}
+		f.bits = append(f.bits, binary.LittleEndian.Uint64(buf))
+	}
+
+	return f, nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	return append(b, buf...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return append(b, buf...)
+}
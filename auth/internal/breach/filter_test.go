@@ -0,0 +1,143 @@
+package breach
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterRoundTrip(t *testing.T) {
+	filter, err := New(1000, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("breached-password-%d", i))
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := filter.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != 1000 {
+		t.Errorf("want %d entries; got %d", 1000, loaded.Len())
+	}
+
+	// A bloom filter must never give a false negative
+	for i := 0; i < 1000; i++ {
+		password := fmt.Sprintf("breached-password-%d", i)
+		if !loaded.Contains(password) {
+			t.Fatalf("expected %q to be in the filter", password)
+		}
+	}
+
+	// False positives are allowed, but should stay around the rate the filter was built for
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if loaded.Contains(fmt.Sprintf("safe-password-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("got %d false positives out of 10000; want no more than 50", falsePositives)
+	}
+}
+
+func TestNewInvalidFalsePositiveRate(t *testing.T) {
+	for _, rate := range []float64{0, 1, 1.5, -0.1, math.NaN(), math.Inf(1)} {
+		filter, err := New(1000, rate)
+		if err != ErrFalsePositiveRate {
+			t.Errorf("New(1000, %v): want %v; got %v", rate, ErrFalsePositiveRate, err)
+		}
+		if filter != nil {
+			t.Errorf("New(1000, %v): want no filter", rate)
+		}
+	}
+}
+
+func TestReadInvalidFilter(t *testing.T) {
+	_, err := Read(bytes.NewReader([]byte("definitely not a filter file")))
+	if err != ErrInvalidFilter {
+		t.Errorf("want: %v; got %v", ErrInvalidFilter, err)
+	}
+}
+
+func TestReadOversizedHeader(t *testing.T) {
+	filter, err := New(10, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := filter.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Claim far more bits than the file holds
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint64(data[16:24], 1<<62)
+
+	if _, err := Read(bytes.NewReader(data)); err != ErrInvalidFilter {
+		t.Errorf("Read: want %v; got %v", ErrInvalidFilter, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "filter.bin")
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != ErrInvalidFilter {
+		t.Errorf("Load: want %v; got %v", ErrInvalidFilter, err)
+	}
+}
+
+func TestParseHashLine(t *testing.T) {
+	// SHA-1 of "password"
+	want := sha1.Sum([]byte("password"))
+
+	tests := []struct {
+		name      string
+		prefix    string
+		line      string
+		wantCount int
+		wantErr   bool
+	}{
+		{name: "Full digest", line: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", wantCount: 1},
+		{name: "Full digest with count", line: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824", wantCount: 9545824},
+		{name: "Range file line", prefix: "5BAA6", line: "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3", wantCount: 3},
+		{name: "Lowercase", line: "5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8", wantCount: 1},
+		{name: "Too short", line: "5BAA61E4C9B93F", wantErr: true},
+		{name: "Bad count", line: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest, count, err := ParseHashLine(tt.prefix, tt.line)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if digest != want {
+				t.Errorf("want digest %x; got %x", want, digest)
+			}
+			if count != tt.wantCount {
+				t.Errorf("want count %d; got %d", tt.wantCount, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package device recognises the devices users sign in from. A device is
+// identified by its browser and operating system, read from its user agent, and
+// the network it is on, so a sign in from a new browser, computer or place gets
+// a new fingerprint while a browser update or a new address from the same ISP
+// doesn't.
+package device
+
+import (
+	"crypto/sha256"
+	"net"
+	"strings"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// Identify returns the device a request with the user agent came from the IP
+// address.
+func Identify(userAgent, ip string) *domain.Device {
+	d := &domain.Device{
+		Browser: Browser(userAgent),
+		OS:      OS(userAgent),
+		Network: Network(ip),
+		IP:      ip,
+	}
+
+	sum := sha256.Sum256([]byte(d.Browser + "\x00" + d.OS + "\x00" + d.Network))
+	d.Fingerprint = sum[:]
+	return d
+}
+
+// Browsers recognised in user agents, in the order they are checked. Most
+// browsers include the tokens of the ones they are based on, e.g. Edge's user
+// agent also mentions Chrome and Safari, so the more specific come first.
+var browsers = []struct {
+	token string
+	name  string
+}{
+	{"Edg/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Opera", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+// Browser returns the name of the browser with the user agent.
+func Browser(userAgent string) string {
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			return b.name
+		}
+	}
+	return "an unknown browser"
+}
+
+// Operating systems recognised in user agents, in the order they are checked.
+var systems = []struct {
+	token string
+	name  string
+}{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"iPod", "iOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+	{"FreeBSD", "FreeBSD"},
+}
+
+// OS returns the name of the operating system with the user agent.
+func OS(userAgent string) string {
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			return s.name
+		}
+	}
+	return "an unknown operating system"
+}
+
+// Network returns the network the IP address is on: its /24 for IPv4 and its
+// /48 for IPv6, which is about what one ISP customer or office is given.
+// Addresses that can't be parsed are returned unchanged.
+func Network(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		network := &net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		return network.String()
+	}
+
+	network := &net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}
+	return network.String()
+}
@@ -0,0 +1,91 @@
+package device
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		name        string
+		userAgent   string
+		ip          string
+		wantBrowser string
+		wantOS      string
+		wantNetwork string
+	}{
+		{
+			name:        "Firefox on Linux",
+			userAgent:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0",
+			ip:          "203.0.113.7",
+			wantBrowser: "Firefox",
+			wantOS:      "Linux",
+			wantNetwork: "203.0.113.0/24",
+		},
+		{
+			name:        "Edge on Windows",
+			userAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.114 Safari/537.36 Edg/91.0.864.54",
+			ip:          "198.51.100.200",
+			wantBrowser: "Edge",
+			wantOS:      "Windows",
+			wantNetwork: "198.51.100.0/24",
+		},
+		{
+			name:        "Chrome on Android",
+			userAgent:   "Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.120 Mobile Safari/537.36",
+			ip:          "2001:db8:1234:5678::1",
+			wantBrowser: "Chrome",
+			wantOS:      "Android",
+			wantNetwork: "2001:db8:1234::/48",
+		},
+		{
+			name:        "Safari on iPhone",
+			userAgent:   "Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Mobile/15E148 Safari/604.1",
+			ip:          "192.0.2.1",
+			wantBrowser: "Safari",
+			wantOS:      "iOS",
+			wantNetwork: "192.0.2.0/24",
+		},
+		{
+			name:        "Unknown",
+			userAgent:   "",
+			ip:          "not an ip",
+			wantBrowser: "an unknown browser",
+			wantOS:      "an unknown operating system",
+			wantNetwork: "not an ip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Identify(tt.userAgent, tt.ip)
+			if d.Browser != tt.wantBrowser {
+				t.Errorf("want browser %q; got %q", tt.wantBrowser, d.Browser)
+			}
+			if d.OS != tt.wantOS {
+				t.Errorf("want OS %q; got %q", tt.wantOS, d.OS)
+			}
+			if d.Network != tt.wantNetwork {
+				t.Errorf("want network %q; got %q", tt.wantNetwork, d.Network)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	firefox := "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0"
+	updated := "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:90.0) Gecko/20100101 Firefox/90.0"
+	chrome := "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.114 Safari/537.36"
+
+	a := Identify(firefox, "203.0.113.7")
+
+	if b := Identify(updated, "203.0.113.99"); !bytes.Equal(a.Fingerprint, b.Fingerprint) {
+		t.Error("want the same fingerprint after a browser update on the same network")
+	}
+	if b := Identify(chrome, "203.0.113.7"); bytes.Equal(a.Fingerprint, b.Fingerprint) {
+		t.Error("want a different fingerprint for another browser")
+	}
+	if b := Identify(firefox, "198.51.100.7"); bytes.Equal(a.Fingerprint, b.Fingerprint) {
+		t.Error("want a different fingerprint on another network")
+	}
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Actions recorded in the audit log. They are named <subject>.<what happened>.
+const (
+	AuditLoginSucceeded            = "login.succeeded"
+	AuditLoginFailed               = "login.failed"
+	AuditLoginNewDevice            = "login.new_device"
+	AuditLoginChallenged           = "login.challenged"
+	AuditLoginConfirmed            = "login.confirmed"
+	AuditTokenRefreshed            = "token.refreshed"
+	AuditUserRegistered            = "user.registered"
+	AuditUserActivated             = "user.activated"
+	AuditUserUpdated               = "user.updated"
+	AuditUserImported              = "user.imported"
+	AuditUserStatusChanged         = "user.status_changed"
+	AuditUserDeleted               = "user.deleted"
+	AuditAccountLocked             = "account.locked"
+	AuditAccountUnlocked           = "account.unlocked"
+	AuditAccountSecured            = "account.secured"
+	AuditPasswordResetRequested    = "password_reset.requested"
+	AuditPasswordResetCompleted    = "password_reset.completed"
+	AuditDataExportRequested       = "data_export.requested"
+	AuditRoleAssigned              = "role.assigned"
+	AuditRoleRemoved               = "role.removed"
+	AuditImpersonationStarted      = "impersonation.started"
+	AuditImpersonationStopped      = "impersonation.stopped"
+	AuditInvitationCreated         = "invitation.created"
+	AuditInvitationRevoked         = "invitation.revoked"
+	AuditInvitationAccepted        = "invitation.accepted"
+	AuditOrganizationSwitched      = "organization.switched"
+	AuditOrganizationMemberUpdated = "organization.member_updated"
+	AuditOrganizationMemberRemoved = "organization.member_removed"
+	AuditIPRuleCreated             = "ip_rule.created"
+	AuditIPRuleDeleted             = "ip_rule.deleted"
+)
+
+// Types of the targets of audit events.
+const (
+	AuditTargetUser         = "user"
+	AuditTargetOrganization = "organization"
+)
+
+// AuditEvent records who did what, to what, and from where. Events about a
+// sign in that failed before the user was known have no actor.
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Action     string    `json:"action"`
+	ActorID    string    `json:"actorId,omitempty"`
+	ActorEmail string    `json:"actorEmail,omitempty"`
+	TargetType string    `json:"targetType,omitempty"`
+	TargetID   string    `json:"targetId,omitempty"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	RequestID  string    `json:"requestId"`
+	// Metadata holds details specific to the action, e.g. why a sign in failed.
+	Metadata map[string]interface{} `json:"metadata"`
+	// PrevHash and Hash chain the event to the one recorded before it. Both are
+	// empty on events recorded before the log was chained.
+	PrevHash []byte `json:"prevHash,omitempty"`
+	Hash     []byte `json:"hash,omitempty"`
+}
+
+// SetTarget sets the user the event is about.
+func (e *AuditEvent) SetTarget(user *User) *AuditEvent {
+	e.TargetType = AuditTargetUser
+	e.TargetID = user.ID.String()
+	return e
+}
+
+// With adds a detail to the metadata of the event.
+func (e *AuditEvent) With(key string, value interface{}) *AuditEvent {
+	if e.Metadata == nil {
+		e.Metadata = map[string]interface{}{}
+	}
+	e.Metadata[key] = value
+	return e
+}
+
+// ChainHash returns the hash linking the event to the event before it, whose
+// hash is prev (empty for the first event of the chain). It covers everything
+// recorded about the event, so changing any of it changes the hash.
+func (e *AuditEvent) ChainHash(prev []byte) ([]byte, error) {
+	metadata, err := canonicalJSON(e.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := json.Marshal(struct {
+		ID         int64           `json:"id"`
+		OccurredAt string          `json:"occurredAt"`
+		Action     string          `json:"action"`
+		ActorID    string          `json:"actorId"`
+		ActorEmail string          `json:"actorEmail"`
+		TargetType string          `json:"targetType"`
+		TargetID   string          `json:"targetId"`
+		IP         string          `json:"ip"`
+		UserAgent  string          `json:"userAgent"`
+		RequestID  string          `json:"requestId"`
+		Metadata   json.RawMessage `json:"metadata"`
+	}{
+		ID:         e.ID,
+		OccurredAt: e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		Action:     e.Action,
+		ActorID:    e.ActorID,
+		ActorEmail: e.ActorEmail,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		RequestID:  e.RequestID,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(content)
+	return h.Sum(nil), nil
+}
+
+// canonicalJSON encodes the metadata the same way whether it is the map the
+// event was recorded with or the one read back from the database, which has
+// lost the Go types of its values (every number comes back as a float64).
+func canonicalJSON(metadata map[string]interface{}) ([]byte, error) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+// AuditCheckpoint is a signature over the hash of an event in the audit log.
+// Since every event's hash covers all the events before it, the signature vouches
+// for the whole log up to that event.
+type AuditCheckpoint struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	EventID   int64     `json:"eventId"`
+	EventHash []byte    `json:"eventHash"`
+	// KeyID identifies the public key that verifies the signature.
+	KeyID     string `json:"keyId"`
+	Signature []byte `json:"signature"`
+}
+
+// SignedMessage returns what the checkpoint's signature is over.
+func (c *AuditCheckpoint) SignedMessage() []byte {
+	return []byte(fmt.Sprintf("audit-checkpoint/v1\n%d\n%s\n%s",
+		c.EventID, hex.EncodeToString(c.EventHash), c.CreatedAt.UTC().Format(time.RFC3339Nano)))
+}
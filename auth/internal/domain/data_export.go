@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserExport is the machine readable copy of everything we hold about a user,
+// as handed out in response to a subject-access request. Each kind of data is
+// stored under its own key in Sections, e.g. "user" or "tokens".
+type UserExport struct {
+	UserID      uuid.UUID              `json:"user_id"`
+	GeneratedAt time.Time              `json:"generated_at"`
+	Sections    map[string]interface{} `json:"sections"`
+}
+
+// DataExport is a generated export archive that has been stored so that the
+// user can download it later through the link sent to them by email.
+type DataExport struct {
+	ID        uuid.UUID
+	UserID    string
+	CreatedAt time.Time
+	Expiry    time.Time
+	Archive   []byte
+}
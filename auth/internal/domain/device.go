@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// Device is a device and network a user has signed in from. Devices are told
+// apart by a fingerprint of their browser, operating system and network, see
+// the device package.
+type Device struct {
+	ID          int64     `json:"id"`
+	UserID      string    `json:"-"`
+	Fingerprint []byte    `json:"-"`
+	Browser     string    `json:"browser"`
+	OS          string    `json:"os"`
+	Network     string    `json:"network"`
+	IP          string    `json:"ip"`
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+}
+
+// Description describes the device to its user, e.g. "Firefox on Linux".
+func (d *Device) Description() string {
+	return d.Browser + " on " + d.OS
+}
+
+// SessionState is what is checked about a user's account on every request.
+type SessionState struct {
+	Status string
+	// SessionsRevokedAt is when the user last revoked their sessions, zero if
+	// they never have.
+	SessionsRevokedAt time.Time
+}
+
+// Revoked reports whether a token issued at issuedAt has since been revoked.
+// Tokens record when they were issued to the second, so a token issued in the
+// same second as its sessions were revoked is still accepted.
+func (s *SessionState) Revoked(issuedAt time.Time) bool {
+	return !s.SessionsRevokedAt.IsZero() && issuedAt.Unix() < s.SessionsRevokedAt.Unix()
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// ImpersonationSession records an admin signing in as another user, why, and
+// for how long.
+type ImpersonationSession struct {
+	ID          int64      `json:"id"`
+	ActorID     string     `json:"actorId"`
+	ActorEmail  string     `json:"actorEmail"`
+	TargetID    string     `json:"targetId"`
+	TargetEmail string     `json:"targetEmail"`
+	Reason      string     `json:"reason"`
+	IP          string     `json:"ip"`
+	StartedAt   time.Time  `json:"startedAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	EndedAt     *time.Time `json:"endedAt,omitempty"`
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"strings"
+
+	"github.com/todo-app/internal/hashing"
+	"github.com/todo-app/internal/validator"
+)
+
+// ImportUser is a user being migrated from another system, whose password has
+// already been hashed by that system. HashFormat says how to read PasswordHash,
+// see hashing.ConvertForeignHash for the accepted formats. PasswordSalt is only
+// needed for formats that export the salt separately, such as Firebase.
+type ImportUser struct {
+	Email        string `json:"email"`
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	PasswordHash string `json:"passwordHash"`
+	PasswordSalt string `json:"passwordSalt,omitempty"`
+	HashFormat   string `json:"hashFormat"`
+	Activated    bool   `json:"activated"`
+}
+
+// Prepare trims the space off the name and email fields
+func (u *ImportUser) Prepare() {
+	u.Email = strings.TrimSpace(u.Email)
+	u.FirstName = strings.TrimSpace(u.FirstName)
+	u.LastName = strings.TrimSpace(u.LastName)
+}
+
+func ValidateImportUser(v *validator.Validator, u *ImportUser) {
+	v.Check(u.FirstName != "", "firstName", "first name is required")
+	v.Check(u.LastName != "", "lastName", "last name is required")
+	v.Check(v.Matches(u.Email, validator.EmailRX), "email", "invalid email")
+	v.Check(u.PasswordHash != "", "passwordHash", "must be provided")
+	v.Check(u.HashFormat != "", "hashFormat", "must be provided")
+	v.Check(
+		v.In(u.HashFormat, hashing.FormatDjango, hashing.FormatFirebase, hashing.FormatMD5Crypt, hashing.FormatNative),
+		"hashFormat",
+		"must be one of django, firebase, md5-crypt or native",
+	)
+}
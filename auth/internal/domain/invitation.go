@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/validator"
+)
+
+// Invitation invites someone to join an organization by email. They may not
+// have an account yet, in which case accepting the invitation creates one.
+type Invitation struct {
+	ID               int64     `json:"id"`
+	OrganizationID   uuid.UUID `json:"organizationId"`
+	OrganizationName string    `json:"organizationName,omitempty"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	InvitedBy        string    `json:"invitedBy,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	Expiry           time.Time `json:"expiry"`
+}
+
+func ValidateInvitation(v *validator.Validator, inv *Invitation) {
+	v.Check(v.Matches(inv.Email, validator.EmailRX), "email", "invalid email")
+	ValidateOrgRole(v, inv.Role)
+}
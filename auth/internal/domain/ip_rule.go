@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/todo-app/internal/validator"
+)
+
+const (
+	IPRuleAllow = "allow"
+	IPRuleDeny  = "deny"
+)
+
+// IPRule allows or denies access from a range of IP addresses, either to the
+// whole service or to an organization. When any allow rules apply, only their
+// ranges have access, and deny rules take precedence over allow rules.
+type IPRule struct {
+	ID int64 `json:"id"`
+	// OrganizationID is empty for rules that apply to the whole service.
+	OrganizationID string    `json:"organizationId,omitempty"`
+	CIDR           string    `json:"cidr"`
+	Action         string    `json:"action"`
+	Description    string    `json:"description"`
+	CreatedBy      string    `json:"createdBy,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func ValidateIPRule(v *validator.Validator, rule *IPRule) {
+	v.Check(rule.CIDR != "", "cidr", "must be provided")
+	v.Check(v.In(rule.Action, IPRuleAllow, IPRuleDeny), "action", "must be allow or deny")
+	v.Check(len(rule.Description) <= 200, "description", "must not be more than 200 characters long")
+}
@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+// LoginEvent records a sign in attempt, successful or not, for the user's sign
+// in history. Attempts on an email address that isn't registered have no user.
+type LoginEvent struct {
+	ID        int64  `json:"id"`
+	UserID    string `json:"-"`
+	Email     string `json:"email"`
+	Succeeded bool   `json:"succeeded"`
+	// FailureReason says why the attempt failed, e.g. "invalid_credentials".
+	FailureReason string       `json:"failureReason,omitempty"`
+	IP            string       `json:"ip"`
+	UserAgent     string       `json:"userAgent"`
+	Browser       string       `json:"browser"`
+	OS            string       `json:"os"`
+	Location      *GeoLocation `json:"location,omitempty"`
+	OccurredAt    time.Time    `json:"occurredAt"`
+}
+
+// GeoLocation is roughly where an IP address is, as far as the GeoIP database
+// knows. Any of it may be empty.
+type GeoLocation struct {
+	City        string  `json:"city,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"countryCode,omitempty"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+}
+
+// String describes the location to a user, e.g. "Berlin, Germany".
+func (l *GeoLocation) String() string {
+	switch {
+	case l.City != "" && l.Country != "":
+		return l.City + ", " + l.Country
+	case l.Country != "":
+		return l.Country
+	default:
+		return l.City
+	}
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/validator"
+)
+
+// Roles a member can have within an organization. They are unrelated to the
+// application wide roles in role.go, which are for staff using the admin API.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var slugInvalidRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Organization is a company or team that users belong to through memberships.
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role is the role of the user the organization was loaded for, if any.
+	Role string `json:"role,omitempty"`
+}
+
+// Membership is a user's membership of an organization.
+type Membership struct {
+	OrganizationID uuid.UUID `json:"organizationId"`
+	UserID         uuid.UUID `json:"userId"`
+	Email          string    `json:"email"`
+	FirstName      string    `json:"firstName"`
+	LastName       string    `json:"lastName"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Prepare generates a unique uuid for the organization, trims its name and
+// derives its slug from the name if it doesn't have one.
+func (o *Organization) Prepare() {
+	o.ID = uuid.New()
+	o.Name = strings.TrimSpace(o.Name)
+	o.Slug = strings.TrimSpace(o.Slug)
+	if o.Slug == "" {
+		o.Slug = strings.Trim(slugInvalidRX.ReplaceAllString(strings.ToLower(o.Name), "-"), "-")
+	}
+}
+
+// ValidOrgRole reports whether role is one of the organization roles.
+func ValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+func ValidateOrganization(v *validator.Validator, org *Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 100, "name", "must not be more than 100 characters long")
+	v.Check(v.Matches(org.Slug, validator.SlugRX), "slug", "must only contain lowercase letters, digits and dashes")
+	v.Check(len(org.Slug) <= 50, "slug", "must not be more than 50 characters long")
+}
+
+func ValidateOrgRole(v *validator.Validator, role string) {
+	v.Check(ValidOrgRole(role), "role", "must be one of owner, admin or member")
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/todo-app/internal/validator"
+)
+
+// Permissions checked by the API. New permissions can also be created through the
+// admin API, but only these are enforced by routes.
+const (
+	PermissionUsersRead        = "users:read"
+	PermissionUsersWrite       = "users:write"
+	PermissionUsersImport      = "users:import"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionRolesRead        = "roles:read"
+	PermissionRolesWrite       = "roles:write"
+	PermissionAuditRead        = "audit:read"
+	PermissionIPRulesRead      = "ip_rules:read"
+	PermissionIPRulesWrite     = "ip_rules:write"
+)
+
+// Roles created by the migrations
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleUser    = "user"
+)
+
+// Role is a named set of permissions that can be given to users.
+type Role struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Permission struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ValidateRole checks the role's name and description. Names are lowercase
+// identifiers such as "support" or "billing-admin".
+func ValidateRole(v *validator.Validator, role *Role) {
+	v.Check(v.Matches(role.Name, validator.IdentifierRX), "name", "must be a lowercase identifier")
+	v.Check(len(role.Name) <= 50, "name", "must not be more than 50 characters long")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 characters long")
+}
+
+// ValidatePermission checks the permission's name and description. Names are in
+// the form "<resource>:<action>", e.g. "users:read".
+func ValidatePermission(v *validator.Validator, permission *Permission) {
+	v.Check(v.Matches(permission.Name, validator.PermissionRX), "name", "must be in the form <resource>:<action>")
+	v.Check(len(permission.Name) <= 100, "name", "must not be more than 100 characters long")
+	v.Check(len(permission.Description) <= 500, "description", "must not be more than 500 characters long")
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The statuses a user's account can be in.
+const (
+	// StatusPending accounts have been registered but not activated yet.
+	StatusPending = "pending"
+	// StatusActive accounts can be used normally.
+	StatusActive = "active"
+	// StatusSuspended accounts have been blocked by an admin, e.g. for abuse.
+	StatusSuspended = "suspended"
+	// StatusLocked accounts are blocked because they may have been compromised.
+	// Unlike the temporary lock after too many failed sign ins it lasts until
+	// the user resets their password or an admin unlocks the account.
+	StatusLocked = "locked"
+	// StatusDeactivated accounts have been closed, but can be reactivated.
+	StatusDeactivated = "deactivated"
+	// StatusDeleted accounts have been closed for good. The row is kept, e.g.
+	// for the audit trail, but can never be used again.
+	StatusDeleted = "deleted"
+)
+
+// ErrInvalidStatusTransition is returned when an account can't move from its
+// current status to the one requested.
+var ErrInvalidStatusTransition = errors.New("invalid status transition")
+
+// statusTransitions lists the statuses an account can move to from each status.
+var statusTransitions = map[string][]string{
+	StatusPending:     {StatusActive, StatusSuspended, StatusDeactivated, StatusDeleted},
+	StatusActive:      {StatusSuspended, StatusLocked, StatusDeactivated, StatusDeleted},
+	StatusSuspended:   {StatusActive, StatusDeactivated, StatusDeleted},
+	StatusLocked:      {StatusActive, StatusSuspended, StatusDeactivated, StatusDeleted},
+	StatusDeactivated: {StatusActive, StatusDeleted},
+	StatusDeleted:     {},
+}
+
+// ValidStatus reports whether status is one of the account statuses.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an account can move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetStatus moves the user's account to a new status, recording why and when.
+// ErrInvalidStatusTransition is returned if it can't move there from its
+// current status, in which case the user is left unchanged.
+func (u *User) SetStatus(status, reason string) error {
+	if !CanTransition(u.Status, status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, u.Status, status)
+	}
+	u.Status = status
+	u.StatusReason = reason
+	u.StatusChangedAt = time.Now()
+	return nil
+}
+
+// IsActive reports whether the account can be used.
+func (u *User) IsActive() bool {
+	return u.Status == StatusActive
+}
@@ -13,6 +13,11 @@ const (
 	TokenScopeActivation     = "activation"
 	TokenAuthenticationScope = "authentication"
 	TokenScopePasswordReset  = "password-reset"
+	TokenScopeDataExport     = "data-export"
+	TokenScopeUnlock         = "unlock"
+	TokenScopeInvitation     = "invitation"
+	TokenScopeSecureAccount  = "secure-account"
+	TokenScopeConfirmLogin   = "confirm-login"
 )
 
 type Token struct {
@@ -21,6 +26,15 @@ type Token struct {
 	UserID    string    `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// InvitationID is set instead of UserID for invitation tokens, as the person
+	// invited may not have an account yet.
+	InvitationID int64 `json:"-"`
+}
+
+// TokenMetadata describes a token without exposing its hash or plaintext value.
+type TokenMetadata struct {
+	Scope  string    `json:"scope"`
+	Expiry time.Time `json:"expiry"`
 }
 
 func GenerateToken(userId string, ttl time.Duration, scope string) (*Token, error) {
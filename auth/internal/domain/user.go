@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/todo-app/internal/hashing"
 )
 
 type User struct {
@@ -14,8 +14,34 @@ type User struct {
 	LastName  string    `json:"lastName"`
 	Email     string    `json:"email"`
 	Password  string    `json:"password"`
-	Activated bool      `json:"activated"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// Status is where the account is in its lifecycle, see status.go, and
+	// StatusReason and StatusChangedAt why and when it got there.
+	Status          string    `json:"status"`
+	StatusReason    string    `json:"-"`
+	StatusChangedAt time.Time `json:"-"`
+
+	// PepperVersion is the version of the server side pepper the password was
+	// hashed with, 0 if it wasn't peppered.
+	PepperVersion int `json:"-"`
+
+	// FailedLoginAttempts is the number of failed sign ins in a row, and
+	// LockedUntil the time until which the account is locked because of them.
+	FailedLoginAttempts int       `json:"-"`
+	LockedUntil         time.Time `json:"-"`
+
+	// PasswordResetRequired is set by an admin to make the user reset their
+	// password before they can sign in again.
+	PasswordResetRequired bool `json:"-"`
+
+	// Roles and Permissions are only loaded when issuing a token.
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// OrgID and OrgRole are the organization the user is signed in to and their
+	// role in it, also only loaded when issuing a token.
+	OrgID   string `json:"orgId,omitempty"`
+	OrgRole string `json:"orgRole,omitempty"`
 }
 
 type UserResponse struct {
@@ -23,20 +49,47 @@ type UserResponse struct {
 	FirstName string    `json:"firstName"`
 	LastName  string    `json:"lastName"`
 	Email     string    `json:"email"`
-	Activated bool      `json:"activated"`
+	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+	Roles     []string  `json:"roles,omitempty"`
+	OrgID     string    `json:"orgId,omitempty"`
+	OrgRole   string    `json:"orgRole,omitempty"`
+	// Impersonating is set when an admin is signed in as the user, so that the
+	// app can show a banner naming them in ImpersonatedBy.
+	Impersonating  bool   `json:"impersonating,omitempty"`
+	ImpersonatedBy string `json:"impersonatedBy,omitempty"`
+}
+
+// AdminUserResponse is how a user is shown to admins, with the state of their
+// account that is hidden from the user themselves.
+type AdminUserResponse struct {
+	*UserResponse
+	StatusReason          string     `json:"statusReason"`
+	StatusChangedAt       time.Time  `json:"statusChangedAt"`
+	PasswordResetRequired bool       `json:"passwordResetRequired"`
+	FailedLoginAttempts   int        `json:"failedLoginAttempts"`
+	LockedUntil           *time.Time `json:"lockedUntil,omitempty"`
 }
 
+// HashPassword replaces the plaintext password of the user with its hash, using
+// the application's current password hashing algorithm and pepper.
 func (u *User) HashPassword() error {
-	pass, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	pass, err := hashing.Default().Hash([]byte(u.Password))
 
 	if err != nil {
 		return err
 	}
-	u.Password = string(pass)
+	u.Password = pass
+	u.PepperVersion = hashing.Default().PepperVersion()
 	return nil
 }
 
+// IsLocked reports whether the account is temporarily locked after too many
+// failed sign in attempts.
+func (u *User) IsLocked() bool {
+	return time.Now().Before(u.LockedUntil)
+}
+
 // Prepare generates a unique uuid and trims the space off the name and email
 // fields of the user object
 func (u *User) Prepare() {
@@ -54,7 +107,26 @@ func (u *User) ToHTTPResponse() *UserResponse {
 		Email:     u.Email,
 		FirstName: u.FirstName,
 		LastName:  u.LastName,
-		Activated: u.Activated,
+		Status:    u.Status,
 		CreatedAt: u.CreatedAt,
+		Roles:     u.Roles,
+		OrgID:     u.OrgID,
+		OrgRole:   u.OrgRole,
+	}
+}
+
+// ToAdminResponse is ToHTTPResponse with the account state admins need to see.
+func (u *User) ToAdminResponse() *AdminUserResponse {
+	response := &AdminUserResponse{
+		UserResponse:          u.ToHTTPResponse(),
+		StatusReason:          u.StatusReason,
+		StatusChangedAt:       u.StatusChangedAt,
+		PasswordResetRequired: u.PasswordResetRequired,
+		FailedLoginAttempts:   u.FailedLoginAttempts,
+	}
+	if u.IsLocked() {
+		lockedUntil := u.LockedUntil
+		response.LockedUntil = &lockedUntil
 	}
+	return response
 }
@@ -0,0 +1,82 @@
+// Package geoip looks up roughly where IP addresses are in a MaxMind database
+// file, such as GeoLite2-City.mmdb, read offline from disk.
+package geoip
+
+import (
+	"io/ioutil"
+	"net"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// Reader looks up IP addresses in a MaxMind database. A nil *Reader knows no
+// locations, which is what happens when no database is configured.
+type Reader struct {
+	db *mmdb
+}
+
+// Open reads the database at path into memory.
+func Open(path string) (*Reader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New returns a reader of the database in buf.
+func New(buf []byte) (*Reader, error) {
+	db, err := parseMMDB(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Lookup returns where the IP address is, or nil if the database doesn't know.
+// Names are in English.
+func (r *Reader) Lookup(ip string) (*domain.GeoLocation, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, nil
+	}
+
+	value, err := r.db.lookup(parsed)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+
+	location := &domain.GeoLocation{
+		City:        name(record, "city"),
+		Country:     name(record, "country"),
+		CountryCode: str(field(record, "country"), "iso_code"),
+	}
+	coordinates := field(record, "location")
+	location.Latitude, _ = coordinates["latitude"].(float64)
+	location.Longitude, _ = coordinates["longitude"].(float64)
+
+	if *location == (domain.GeoLocation{}) {
+		return nil, nil
+	}
+	return location, nil
+}
+
+func field(record map[string]interface{}, key string) map[string]interface{} {
+	m, _ := record[key].(map[string]interface{})
+	return m
+}
+
+func str(record map[string]interface{}, key string) string {
+	s, _ := record[key].(string)
+	return s
+}
+
+// name returns the English name of the record's city or country.
+func name(record map[string]interface{}, key string) string {
+	return str(field(field(record, key), "names"), "en")
+}
@@ -0,0 +1,297 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// testWriter writes a MaxMind database, just enough of the format for the tests.
+type testWriter struct {
+	data    bytes.Buffer
+	strings map[string]int
+}
+
+func (w *testWriter) control(typ, size int) {
+	first := byte(typ << 5)
+	var ext []byte
+	if typ > 7 {
+		first = 0
+		ext = []byte{byte(typ - 7)}
+	}
+
+	var extra []byte
+	switch {
+	case size < 29:
+		first |= byte(size)
+	case size < 285:
+		first |= 29
+		extra = []byte{byte(size - 29)}
+	default:
+		first |= 30
+		extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	}
+
+	w.data.WriteByte(first)
+	w.data.Write(ext)
+	w.data.Write(extra)
+}
+
+func (w *testWriter) value(v interface{}) {
+	switch v := v.(type) {
+	case string:
+		// Repeated strings are written once and pointed to, like real databases do
+		if offset, ok := w.strings[v]; ok {
+			w.data.WriteByte(byte(typePointer<<5 | offset>>8))
+			w.data.WriteByte(byte(offset))
+			return
+		}
+		w.strings[v] = w.data.Len()
+		w.control(typeString, len(v))
+		w.data.WriteString(v)
+	case float64:
+		w.control(typeDouble, 8)
+		binary.Write(&w.data, binary.BigEndian, math.Float64bits(v))
+	case int:
+		w.control(typeUint32, 4)
+		binary.Write(&w.data, binary.BigEndian, uint32(v))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		w.control(typeMap, len(v))
+		for _, k := range keys {
+			w.value(k)
+			w.value(v[k])
+		}
+	default:
+		panic("unsupported type")
+	}
+}
+
+type testNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+// buildMMDB returns a database of the networks.
+func buildMMDB(t *testing.T, ipVersion, recordSize int, networks []testNetwork) []byte {
+	t.Helper()
+
+	const empty, data = -1, -2
+	type record struct{ kind, value int }
+	nodes := [][2]record{{{empty, 0}, {empty, 0}}}
+
+	w := &testWriter{strings: map[string]int{}}
+	for _, n := range networks {
+		ip, network, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+
+		addr := []byte(ip.To16())
+		if v4 := ip.To4(); v4 != nil {
+			if ipVersion == 4 {
+				addr = v4
+			} else {
+				// IPv4 networks are at ::a.b.c.d/96+n in IPv6 databases
+				addr = append(make([]byte, 12), v4...)
+				ones += 96
+			}
+		} else if ipVersion == 4 {
+			continue
+		}
+
+		offset := w.data.Len()
+		w.value(n.record)
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(addr[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = record{data, offset}
+				break
+			}
+			if nodes[node][bit].kind == empty {
+				nodes = append(nodes, [2]record{{empty, 0}, {empty, 0}})
+				nodes[node][bit] = record{0, len(nodes) - 1}
+			}
+			node = nodes[node][bit].value
+		}
+	}
+
+	var buf bytes.Buffer
+	nodeCount := len(nodes)
+	for _, n := range nodes {
+		var values [2]uint32
+		for i, r := range n {
+			switch r.kind {
+			case empty:
+				values[i] = uint32(nodeCount)
+			case data:
+				values[i] = uint32(nodeCount + 16 + r.value)
+			default:
+				values[i] = uint32(r.value)
+			}
+		}
+
+		l, r := values[0], values[1]
+		switch recordSize {
+		case 24:
+			buf.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			buf.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24)<<4 | byte(r>>24), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 32:
+			binary.Write(&buf, binary.BigEndian, l)
+			binary.Write(&buf, binary.BigEndian, r)
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(w.data.Bytes())
+
+	buf.Write(metadataMarker)
+	meta := &testWriter{strings: map[string]int{}}
+	meta.value(map[string]interface{}{
+		"node_count":                  nodeCount,
+		"record_size":                 recordSize,
+		"ip_version":                  ipVersion,
+		"database_type":               "Test-City",
+		"binary_format_major_version": 2,
+	})
+	buf.Write(meta.data.Bytes())
+
+	return buf.Bytes()
+}
+
+func city(name, country, code string, lat, long float64) map[string]interface{} {
+	return map[string]interface{}{
+		"city":     map[string]interface{}{"names": map[string]interface{}{"en": name}},
+		"country":  map[string]interface{}{"iso_code": code, "names": map[string]interface{}{"en": country}},
+		"location": map[string]interface{}{"latitude": lat, "longitude": long},
+	}
+}
+
+var testNetworks = []testNetwork{
+	{"203.0.113.0/24", city("Berlin", "Germany", "DE", 52.52, 13.405)},
+	{"203.0.114.0/25", city("Munich", "Germany", "DE", 48.137, 11.575)},
+	{"198.51.100.0/24", map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "FR", "names": map[string]interface{}{"en": "France"}},
+	}},
+	{"2001:db8::/32", city("London", "United Kingdom", "GB", 51.507, -0.128)},
+}
+
+func TestLookup(t *testing.T) {
+	berlin := &domain.GeoLocation{City: "Berlin", Country: "Germany", CountryCode: "DE", Latitude: 52.52, Longitude: 13.405}
+	munich := &domain.GeoLocation{City: "Munich", Country: "Germany", CountryCode: "DE", Latitude: 48.137, Longitude: 11.575}
+	france := &domain.GeoLocation{Country: "France", CountryCode: "FR"}
+	london := &domain.GeoLocation{City: "London", Country: "United Kingdom", CountryCode: "GB", Latitude: 51.507, Longitude: -0.128}
+
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			reader, err := New(buildMMDB(t, ipVersion, recordSize, testNetworks))
+			if err != nil {
+				t.Fatalf("IPv%d, %d bit records: %v", ipVersion, recordSize, err)
+			}
+
+			wantLondon := london
+			if ipVersion == 4 {
+				wantLondon = nil
+			}
+
+			for ip, want := range map[string]*domain.GeoLocation{
+				"203.0.113.7":   berlin,
+				"203.0.113.255": berlin,
+				"203.0.114.1":   munich,
+				"203.0.114.200": nil,
+				"198.51.100.1":  france,
+				"192.0.2.1":     nil,
+				"2001:db8::1":   wantLondon,
+				"2001:db9::1":   nil,
+				"not an ip":     nil,
+			} {
+				got, err := reader.Lookup(ip)
+				if err != nil {
+					t.Errorf("IPv%d, %d bit records, %s: %v", ipVersion, recordSize, ip, err)
+					continue
+				}
+				if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+					t.Errorf("IPv%d, %d bit records, %s: want %+v; got %+v", ipVersion, recordSize, ip, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestLookupNilReader(t *testing.T) {
+	var reader *Reader
+	location, err := reader.Lookup("203.0.113.7")
+	if location != nil || err != nil {
+		t.Errorf("want nothing; got %v, %v", location, err)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	valid := buildMMDB(t, 6, 24, testNetworks)
+
+	for name, buf := range map[string][]byte{
+		"Empty":     nil,
+		"Not MMDB":  []byte("hello world"),
+		"Truncated": valid[len(valid)/2:],
+	} {
+		if _, err := New(buf); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestDecodeInt32(t *testing.T) {
+	for _, tt := range []struct {
+		payload []byte
+		want    int64
+	}{
+		{[]byte{}, 0},
+		{[]byte{0x7f}, 127},
+		{[]byte{0xff, 0xfe}, -2},
+		{[]byte{0x80, 0x00, 0x00, 0x00}, math.MinInt32},
+	} {
+		// int32 is an extended type: 0 in the control byte, then 8 - 7
+		buf := append([]byte{byte(len(tt.payload)), 1}, tt.payload...)
+		d := decoder{buf: buf}
+		got, _, err := d.decode(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%x: want %d; got %v", tt.payload, tt.want, got)
+		}
+	}
+}
+
+func TestDecodePointerLoop(t *testing.T) {
+	for name, buf := range map[string][]byte{
+		// A pointer to itself
+		"pointer": {typePointer << 5, 0},
+		// A map of one key, whose value points back to the map
+		"map": {typeMap<<5 | 1, typeString<<5 | 1, 'a', typePointer << 5, 0},
+		// An array of one value, pointing back to the array. Arrays are an
+		// extended type, the size goes in the first byte and the type next
+		"array": {1, typeArray - 7, typePointer << 5, 0},
+		// A map claiming more entries than there are bytes left
+		"size": {typeMap<<5 | 28, typeString<<5 | 1, 'a'},
+	} {
+		d := decoder{buf: buf}
+		if _, _, err := d.decode(0); !errors.Is(err, errCorrupt) {
+			t.Errorf("%s: want %v; got %v", name, errCorrupt, err)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+)
+
+// This file reads the MaxMind DB format, as documented at
+// https://maxmind.github.io/MaxMind-DB/. A database is a binary search tree over
+// the bits of IP addresses, whose leaves point into a data section of records
+// encoded much like MessagePack, followed by a metadata record.
+
+var (
+	metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+	errCorrupt     = errors.New("corrupt MaxMind database")
+)
+
+// maxDepth is how deeply maps and arrays may nest. Real records are a few
+// levels deep, the limit only stops a corrupt database that points a map back
+// into itself from recursing forever.
+const maxDepth = 32
+
+// Types of the values in the data section.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// mmdb is a MaxMind database held in memory.
+type mmdb struct {
+	buf         []byte
+	data        []byte
+	nodeCount   uint
+	recordSize  uint
+	ipVersion   uint
+	ipv4Start   uint
+	dbType      string
+	treeSize    uint
+	nodeByteLen uint
+}
+
+func parseMMDB(buf []byte) (*mmdb, error) {
+	// The metadata is at the end of the file, after the last marker
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start == -1 {
+		return nil, errors.New("not a MaxMind database, no metadata found")
+	}
+	metaStart := start + len(metadataMarker)
+
+	d := decoder{buf: buf[metaStart:]}
+	value, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("reading MaxMind database metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errCorrupt
+	}
+
+	db := &mmdb{buf: buf}
+	db.nodeCount = uint(toUint(metadata["node_count"]))
+	db.recordSize = uint(toUint(metadata["record_size"]))
+	db.ipVersion = uint(toUint(metadata["ip_version"]))
+	db.dbType, _ = metadata["database_type"].(string)
+
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported MaxMind database record size %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported MaxMind database IP version %d", db.ipVersion)
+	}
+
+	db.nodeByteLen = db.recordSize / 4
+	db.treeSize = db.nodeCount * db.nodeByteLen
+	// The tree is followed by 16 zero bytes, then the data section
+	dataStart := db.treeSize + 16
+	if dataStart > uint(start) {
+		return nil, errCorrupt
+	}
+	db.data = buf[dataStart:start]
+
+	// IPv4 addresses are looked up in IPv6 databases as ::a.b.c.d, so skip the
+	// first 96 zero bits once rather than on every lookup
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node, err = db.record(node, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+// lookup returns the record of the network the IP address is in, or nil if it
+// isn't in the database.
+func (db *mmdb) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	bits := 128
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 32
+		node = db.ipv4Start
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < bits && node < db.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		var err error
+		node, err = db.record(node, bit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, errCorrupt
+	}
+
+	offset := node - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, errCorrupt
+	}
+	d := decoder{buf: db.data}
+	value, _, err := d.decode(offset)
+	return value, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of the node.
+func (db *mmdb) record(node, bit uint) (uint, error) {
+	off := node * db.nodeByteLen
+	if off+db.nodeByteLen > db.treeSize {
+		return 0, errCorrupt
+	}
+	b := db.buf[off : off+db.nodeByteLen]
+
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+// decoder decodes values of the data section.
+type decoder struct {
+	buf   []byte
+	depth int
+}
+
+// decode returns the value at the offset and the offset after it.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		pointer, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ, size, offset, err := d.control(pointer)
+		if err != nil {
+			return nil, 0, err
+		}
+		// A pointer can't point to another pointer, so following one is
+		// never more than a single step
+		if typ == typePointer {
+			return nil, 0, fmt.Errorf("%w: pointer to a pointer", errCorrupt)
+		}
+		value, _, err := d.value(typ, size, offset)
+		return value, next, err
+	}
+
+	return d.value(typ, size, offset)
+}
+
+// control reads the control byte(s) at the offset, and returns the type and
+// size of the value, and the offset of the value's payload.
+func (d *decoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errCorrupt
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ := int(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if typ == typePointer {
+		// Pointers use the size bits for themselves, see pointer
+		return typ, size, offset, nil
+	}
+
+	var extra uint
+	switch size {
+	case 29:
+		extra = 1
+	case 30:
+		extra = 2
+	case 31:
+		extra = 3
+	}
+	if extra > 0 {
+		if offset+extra > uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		n := uintFromBytes(d.buf[offset : offset+extra])
+		offset += extra
+		switch size {
+		case 29:
+			size = 29 + n
+		case 30:
+			size = 285 + n
+		case 31:
+			size = 65821 + n
+		}
+	}
+
+	return typ, size, offset, nil
+}
+
+// pointer returns the offset a pointer with the size bits points to, and the
+// offset after the pointer.
+func (d *decoder) pointer(size, offset uint) (uint, uint, error) {
+	n := (size >> 3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	b := d.buf[offset : offset+n]
+
+	var pointer uint
+	switch n {
+	case 1:
+		pointer = (size&0x7)<<8 | uint(b[0])
+	case 2:
+		pointer = ((size&0x7)<<16 | uintFromBytes(b)) + 2048
+	case 3:
+		pointer = ((size&0x7)<<24 | uintFromBytes(b)) + 526336
+	default:
+		pointer = uintFromBytes(b)
+	}
+	return pointer, offset + n, nil
+}
+
+func (d *decoder) value(typ int, size, offset uint) (interface{}, uint, error) {
+	// Maps, arrays and booleans have no payload of their size
+	switch typ {
+	case typeMap, typeArray:
+		// Every entry takes at least a byte, so a size bigger than what's left
+		// can only be corrupt, and would otherwise be allocated up front
+		if size > uint(len(d.buf))-offset {
+			return nil, 0, errCorrupt
+		}
+		if d.depth >= maxDepth {
+			return nil, 0, fmt.Errorf("%w: data nested more than %d deep", errCorrupt, maxDepth)
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			m[k], offset, err = d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			var err error
+			a[i], offset, err = d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		return uint64(uintFromBytes(b)), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errCorrupt
+		}
+		// Shift the sign bit of the payload to the top, and back to extend it
+		shift := 32 - 8*size
+		return int64(int32(uint32(uintFromBytes(b))<<shift) >> shift), next, nil
+	case typeUint128:
+		// Too big for any type we use, and nothing we read is one
+		return append([]byte(nil), b...), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", errCorrupt, typ)
+	}
+}
+
+func uintFromBytes(b []byte) uint {
+	var n uint
+	for _, c := range b {
+		n = n<<8 | uint(c)
+	}
+	return n
+}
+
+func toUint(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
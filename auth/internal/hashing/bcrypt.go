@@ -0,0 +1,81 @@
+package hashing
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const bcryptID = "bcrypt"
+
+// DefaultBcryptCost is the cost every password was hashed with before hashing
+// became configurable.
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+// BcryptMaxPasswordLength is the most bytes of a password bcrypt uses. Anything
+// after them is silently ignored, so longer passwords are refused instead.
+const BcryptMaxPasswordLength = 72
+
+// bcryptMaxCost is the highest cost of the bcrypt hashes verified. Each step
+// doubles the time a sign in takes, up to days at bcrypt's own limit of 31.
+const bcryptMaxCost = 16
+
+// ErrPasswordTooLong is returned when hashing a password longer than bcrypt can use.
+var ErrPasswordTooLong = errors.New("password is longer than 72 bytes")
+
+// Bcrypt hashes passwords with bcrypt. Its hashes use the modular crypt format,
+// e.g. $2a$10$<salt and hash>, rather than the PHC string format.
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	return &Bcrypt{cost: cost}
+}
+
+func (b *Bcrypt) ID() string {
+	return bcryptID
+}
+
+func (b *Bcrypt) Hash(password []byte) (string, error) {
+	if len(password) > BcryptMaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword(password, b.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *Bcrypt) Verify(encoded string, password []byte) (bool, error) {
+	if _, err := decodeBcryptCost(encoded); err != nil {
+		return false, err
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), password)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (b *Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := decodeBcryptCost(encoded)
+	if err != nil {
+		return true
+	}
+	return cost != b.cost
+}
+
+func decodeBcryptCost(encoded string) (int, error) {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil || cost > bcryptMaxCost {
+		return 0, ErrInvalidHash
+	}
+	return cost, nil
+}
@@ -0,0 +1,218 @@
+// Package hashing provides pluggable password hashing. Hashes are stored as
+// self-describing strings in the PHC string format, e.g.
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// so a stored hash always says which algorithm and parameters produced it. That
+// lets us verify hashes made by any supported algorithm, and tell when a hash was
+// made with an outdated algorithm or work factor and should be upgraded the next
+// time we see the plaintext password.
+package hashing
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrMismatchedPassword is returned when a password does not match a hash.
+	ErrMismatchedPassword = errors.New("password does not match hash")
+	// ErrUnknownAlgorithm is returned when a hash was made by an algorithm that is
+	// not registered with the Manager.
+	ErrUnknownAlgorithm = errors.New("unknown password hashing algorithm")
+	// ErrInvalidHash is returned when an encoded hash can not be parsed.
+	ErrInvalidHash = errors.New("invalid encoded password hash")
+)
+
+// Hashes are read from the database, or imported, so each algorithm limits the
+// costs of the hashes it verifies rather than letting a sign in use up whatever
+// they ask for. Salts and keys too short to protect anything are refused too,
+// an empty key would otherwise match any password.
+const (
+	minSaltLength = 8
+	minKeyLength  = 16
+)
+
+// Hasher is a single password hashing algorithm.
+type Hasher interface {
+	// ID is the algorithm identifier used in encoded hashes, e.g. "argon2id".
+	ID() string
+	// Hash returns the encoded hash of the password using the hasher's parameters.
+	Hash(password []byte) (string, error)
+	// Verify reports whether the password matches the encoded hash. The hash may
+	// have been created with different parameters than the hasher's current ones.
+	Verify(encoded string, password []byte) (bool, error)
+	// NeedsRehash reports whether the encoded hash was created with parameters
+	// other than the hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// Manager hashes new passwords with its current Hasher, and verifies passwords
+// against hashes made by any of its registered Hashers. If it has peppers, new
+// hashes are made with the current pepper and existing hashes are verified with
+// the pepper version they were made with.
+type Manager struct {
+	current Hasher
+	hashers map[string]Hasher
+	peppers *Peppers
+
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// NewManager returns a manager that hashes with current and can also verify
+// hashes made by any of the other hashers.
+func NewManager(current Hasher, others ...Hasher) *Manager {
+	m := &Manager{
+		current: current,
+		hashers: map[string]Hasher{current.ID(): current},
+	}
+	for _, h := range others {
+		if _, exists := m.hashers[h.ID()]; !exists {
+			m.hashers[h.ID()] = h
+		}
+	}
+	return m
+}
+
+// Register adds a hasher that can be used to verify existing hashes.
+func (m *Manager) Register(h Hasher) {
+	m.hashers[h.ID()] = h
+}
+
+// CanVerify reports whether one of the registered hashers can verify the
+// encoded hash.
+func (m *Manager) CanVerify(encoded string) bool {
+	_, ok := m.hashers[Identify(encoded)]
+	return ok
+}
+
+// Current returns the hasher used for new hashes.
+func (m *Manager) Current() Hasher {
+	return m.current
+}
+
+// SetPeppers sets the peppers mixed into passwords before they are hashed.
+func (m *Manager) SetPeppers(p *Peppers) {
+	m.peppers = p
+}
+
+// PepperVersion returns the version of the pepper used by Hash, which has to be
+// stored alongside the hash to verify it later. It is 0 when there is no pepper.
+func (m *Manager) PepperVersion() int {
+	return m.peppers.Current()
+}
+
+// Hash returns the encoded hash of the password using the current hasher and the
+// current pepper version.
+func (m *Manager) Hash(password []byte) (string, error) {
+	peppered, err := m.peppers.Apply(password, m.PepperVersion())
+	if err != nil {
+		return "", err
+	}
+	return m.current.Hash(peppered)
+}
+
+// Verify checks the password against the encoded hash using whichever hasher
+// created it, and the pepper version it was made with. It returns nil on a match
+// and ErrMismatchedPassword otherwise.
+func (m *Manager) Verify(encoded string, password []byte, pepperVersion int) error {
+	h, ok := m.hashers[Identify(encoded)]
+	if !ok {
+		return ErrUnknownAlgorithm
+	}
+
+	peppered, err := m.peppers.Apply(password, pepperVersion)
+	if err != nil {
+		return err
+	}
+
+	match, err := h.Verify(encoded, peppered)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrMismatchedPassword
+	}
+	return nil
+}
+
+// DummyVerify does the same work as verifying a password against a hash made by
+// the current hasher, but always fails. Calling it when there is no hash to verify
+// against, e.g. for an unknown email address, makes the response take as long as
+// it would for a known one, so response times don't reveal which exist.
+func (m *Manager) DummyVerify(password []byte) {
+	m.dummyOnce.Do(func() {
+		hash, err := m.current.Hash([]byte("dummy password that is never used"))
+		if err == nil {
+			m.dummyHash = hash
+		}
+	})
+
+	peppered, err := m.peppers.Apply(password, m.PepperVersion())
+	if err != nil || m.dummyHash == "" {
+		return
+	}
+	m.current.Verify(m.dummyHash, peppered)
+}
+
+// NeedsRehash reports whether the encoded hash was created by an algorithm other
+// than the current one, with outdated parameters, or with an old pepper.
+func (m *Manager) NeedsRehash(encoded string, pepperVersion int) bool {
+	if pepperVersion != m.PepperVersion() {
+		return true
+	}
+	if Identify(encoded) != m.current.ID() {
+		return true
+	}
+	return m.current.NeedsRehash(encoded)
+}
+
+// Identify returns the algorithm identifier of an encoded hash, or an empty
+// string if it isn't recognised. bcrypt hashes use the older modular crypt format
+// ($2a$, $2b$ or $2y$) and are all identified as "bcrypt", and "$1$" hashes are
+// identified as "md5-crypt".
+func Identify(encoded string) string {
+	if !strings.HasPrefix(encoded, "$") {
+		return ""
+	}
+
+	id := strings.SplitN(encoded[1:], "$", 2)[0]
+	switch id {
+	case "2a", "2b", "2y":
+		return bcryptID
+	case "1":
+		return md5CryptID
+	default:
+		return id
+	}
+}
+
+var (
+	defaultMu      sync.RWMutex
+	defaultManager = NewManager(
+		NewArgon2id(DefaultArgon2idParams),
+		NewScrypt(DefaultScryptParams),
+		NewBcrypt(DefaultBcryptCost),
+		NewPBKDF2SHA256(),
+		NewMD5Crypt(),
+	)
+)
+
+// Default returns the manager used throughout the application. Unless replaced
+// with SetDefault it hashes with argon2id, and verifies scrypt, bcrypt and
+// imported pbkdf2-sha256 and md5-crypt hashes.
+func Default() *Manager {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultManager
+}
+
+// SetDefault replaces the manager returned by Default. It is meant to be called
+// once while bootstrapping the application.
+func SetDefault(m *Manager) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultManager = m
+}
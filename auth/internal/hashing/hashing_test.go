@@ -0,0 +1,429 @@
+package hashing
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters so the tests run quickly
+var (
+	testArgon2idParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	testScryptParams   = ScryptParams{LogN: 4, R: 8, P: 1, SaltLength: 16, KeyLength: 32}
+	testBcryptCost     = 4
+)
+
+func TestHashers(t *testing.T) {
+	tests := []struct {
+		hasher Hasher
+		prefix string
+	}{
+		{hasher: NewArgon2id(testArgon2idParams), prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{hasher: NewScrypt(testScryptParams), prefix: "$scrypt$ln=4,r=8,p=1$"},
+		{hasher: NewBcrypt(testBcryptCost), prefix: "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hasher.ID(), func(t *testing.T) {
+			encoded, err := tt.hasher.Hash([]byte("supersecret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(encoded, tt.prefix) {
+				t.Errorf("want hash to start with %q; got %q", tt.prefix, encoded)
+			}
+			if got := Identify(encoded); got != tt.hasher.ID() {
+				t.Errorf("want hash identified as %q; got %q", tt.hasher.ID(), got)
+			}
+
+			match, err := tt.hasher.Verify(encoded, []byte("supersecret"))
+			if err != nil || !match {
+				t.Errorf("expected correct password to match, err: %v", err)
+			}
+
+			match, err = tt.hasher.Verify(encoded, []byte("notsecret"))
+			if err != nil || match {
+				t.Errorf("expected wrong password not to match, err: %v", err)
+			}
+
+			if tt.hasher.NeedsRehash(encoded) {
+				t.Errorf("expected hash made with current params not to need a rehash")
+			}
+		})
+	}
+}
+
+func TestBcryptRejectsLongPasswords(t *testing.T) {
+	bcrypt := NewBcrypt(testBcryptCost)
+
+	if _, err := bcrypt.Hash([]byte(strings.Repeat("a", BcryptMaxPasswordLength))); err != nil {
+		t.Errorf("expected a %d byte password to hash, err: %v", BcryptMaxPasswordLength, err)
+	}
+	if _, err := bcrypt.Hash([]byte(strings.Repeat("a", BcryptMaxPasswordLength+1))); err != ErrPasswordTooLong {
+		t.Errorf("want: %v; got %v", ErrPasswordTooLong, err)
+	}
+}
+
+func TestNeedsRehashWhenParamsChange(t *testing.T) {
+	weakArgon2id := NewArgon2id(testArgon2idParams)
+	strongerParams := testArgon2idParams
+	strongerParams.Iterations = 2
+	strongArgon2id := NewArgon2id(strongerParams)
+
+	encoded, err := weakArgon2id.Hash([]byte("supersecret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strongArgon2id.NeedsRehash(encoded) {
+		t.Errorf("expected hash made with fewer iterations to need a rehash")
+	}
+
+	// Raising the work factor must not stop old hashes from verifying
+	match, err := strongArgon2id.Verify(encoded, []byte("supersecret"))
+	if err != nil || !match {
+		t.Errorf("expected old hash to still verify, err: %v", err)
+	}
+}
+
+func TestManager(t *testing.T) {
+	bcrypt := NewBcrypt(testBcryptCost)
+	argon2id := NewArgon2id(testArgon2idParams)
+
+	legacy, err := bcrypt.Hash([]byte("supersecret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(argon2id, bcrypt)
+
+	if err := manager.Verify(legacy, []byte("supersecret"), 0); err != nil {
+		t.Errorf("expected bcrypt hash to verify, got: %v", err)
+	}
+	if err := manager.Verify(legacy, []byte("wrong"), 0); !errors.Is(err, ErrMismatchedPassword) {
+		t.Errorf("want: %v; got %v", ErrMismatchedPassword, err)
+	}
+	if !manager.NeedsRehash(legacy, 0) {
+		t.Errorf("expected bcrypt hash to need a rehash when argon2id is current")
+	}
+
+	upgraded, err := manager.Hash([]byte("supersecret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.NeedsRehash(upgraded, 0) {
+		t.Errorf("expected new hash not to need a rehash")
+	}
+
+	// Hashes by algorithms the manager doesn't know about can't be verified
+	onlyArgon2id := NewManager(argon2id)
+	if err := onlyArgon2id.Verify(legacy, []byte("supersecret"), 0); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("want: %v; got %v", ErrUnknownAlgorithm, err)
+	}
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	manager := NewManager(NewArgon2id(testArgon2idParams), NewScrypt(testScryptParams))
+
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=1024,t=1$abc$def",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$def",
+		"$scrypt$ln=4,r=8$abc$def",
+	} {
+		if err := manager.Verify(encoded, []byte("supersecret"), 0); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Verify(%q) want: %v; got %v", encoded, ErrInvalidHash, err)
+		}
+	}
+}
+
+func TestVerifyArgon2idLimits(t *testing.T) {
+	argon2id := NewArgon2id(testArgon2idParams)
+	salt := "c29tZXNhbHRzb21lc2FsdA"          // 16 bytes
+	key := "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5" // 24 bytes
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"No iterations", "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key},
+		{"Too many iterations", "$argon2id$v=19$m=1024,t=65,p=1$" + salt + "$" + key},
+		{"No parallelism", "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key},
+		{"Too much memory", "$argon2id$v=19$m=1048577,t=1,p=1$" + salt + "$" + key},
+		{"Short salt", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$" + key},
+		{"Short key", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$a2V5"},
+		{"No key", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := argon2id.Verify(tt.encoded, []byte("supersecret")); !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("want: %v; got %v", ErrInvalidHash, err)
+			}
+		})
+	}
+}
+
+func TestLegacyHashers(t *testing.T) {
+	firebase, err := NewFirebaseScrypt(FirebaseScryptParams{
+		SignerKey:     "jxspr8Ki0RYycVU8zykbdLGjFQ3McFUH0uiiTvC8pVMXAn210wjLNmdZJzxUECKbm0QsEmYUSDzZvpjeJ9WmXA==",
+		SaltSeparator: "Bw==",
+		Rounds:        8,
+		MemCost:       14,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(NewArgon2id(testArgon2idParams), NewPBKDF2SHA256(), NewMD5Crypt(), firebase)
+
+	tests := []struct {
+		name     string
+		format   string
+		hash     string
+		salt     string
+		password string
+		wantID   string
+	}{
+		{
+			name:     "Django pbkdf2_sha256",
+			format:   FormatDjango,
+			hash:     "pbkdf2_sha256$260000$seasaltseasalt$c8aAVwqwSycDmSdHTVJz8BZs6T//o/0GzmL6O3LoXY0=",
+			password: "password",
+			wantID:   pbkdf2SHA256ID,
+		},
+		{
+			name:     "Firebase scrypt",
+			format:   FormatFirebase,
+			hash:     "lSrfV15cpx95/sZS2W9c9Kp6i/LVgQNDNC/qzrCnh1SAyZvqmZqAjTdn3aoItz+VHjoZilo78198JAdRuid5lQ==",
+			salt:     "42xEC+ixf3L2lw==",
+			password: "user1password",
+			wantID:   firebaseScryptID,
+		},
+		{
+			name:     "MD5-crypt",
+			format:   FormatMD5Crypt,
+			hash:     "$1$abcdefgh$G//4keteveJp0qb8z2DxG/",
+			password: "password",
+			wantID:   md5CryptID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := ConvertForeignHash(tt.format, tt.hash, tt.salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := Identify(encoded); got != tt.wantID {
+				t.Errorf("want hash identified as %q; got %q", tt.wantID, got)
+			}
+
+			if err := manager.Verify(encoded, []byte(tt.password), 0); err != nil {
+				t.Errorf("expected correct password to verify, got: %v", err)
+			}
+			if err := manager.Verify(encoded, []byte("wrong"+tt.password), 0); !errors.Is(err, ErrMismatchedPassword) {
+				t.Errorf("want: %v; got %v", ErrMismatchedPassword, err)
+			}
+
+			// Imported hashes should always be upgraded on first sign in
+			if !manager.NeedsRehash(encoded, 0) {
+				t.Errorf("expected imported hash to need a rehash")
+			}
+		})
+	}
+}
+
+func TestConvertForeignHashInvalid(t *testing.T) {
+	tests := []struct {
+		format string
+		hash   string
+	}{
+		{FormatDjango, "md5$abc$def"},
+		{FormatFirebase, "not base64!"},
+		{FormatMD5Crypt, "$2a$10$abcdefghijklmnopqrstuu"},
+		{FormatNative, "plaintext"},
+		{"sha1", "abc"},
+		// Out of range parameters, or salts and keys too short to be real
+		{FormatDjango, "pbkdf2_sha256$260000$seasaltseasalt$"},
+		{FormatDjango, "pbkdf2_sha256$260000$salt$c8aAVwqwSycDmSdHTVJz8BZs6T//o/0GzmL6O3LoXY0="},
+		{FormatDjango, "pbkdf2_sha256$2000001$seasaltseasalt$c8aAVwqwSycDmSdHTVJz8BZs6T//o/0GzmL6O3LoXY0="},
+		{FormatMD5Crypt, "$1$$G//4keteveJp0qb8z2DxG/"},
+		{FormatNative, "$argon2id$v=19$m=1024,t=0,p=1$c29tZXNhbHRzb21lc2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"},
+		{FormatNative, "$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHRzb21lc2FsdA$"},
+		{FormatNative, "$scrypt$ln=20,r=32,p=1$c29tZXNhbHRzb21lc2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"},
+		{FormatNative, "$scrypt$ln=4,r=8,p=0$c29tZXNhbHRzb21lc2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"},
+		{FormatNative, "$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ConvertForeignHash(tt.format, tt.hash, ""); err == nil {
+			t.Errorf("ConvertForeignHash(%q, %q) expected an error", tt.format, tt.hash)
+		}
+	}
+}
+
+func TestVerifyImportedLimits(t *testing.T) {
+	firebase, err := NewFirebaseScrypt(FirebaseScryptParams{SignerKey: "a2V5", SaltSeparator: "Bw==", Rounds: 8, MemCost: 14})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := NewManager(NewScrypt(testScryptParams), NewBcrypt(testBcryptCost), NewPBKDF2SHA256(), NewMD5Crypt(), firebase)
+
+	for _, encoded := range []string{
+		// An empty key would match any password
+		"$pbkdf2-sha256$i=1000$c2Vhc2FsdHNlYXNhbHQ$",
+		"$pbkdf2-sha256$i=2000001$c2Vhc2FsdHNlYXNhbHQ$c8aAVwqwSycDmSdHTVJz8BZs6T//o/0GzmL6O3LoXY0",
+		"$firebase-scrypt$NDJ4RUMraXhmM0wybHc$",
+		"$scrypt$ln=4,r=8,p=1$c29tZXNhbHRzb21lc2FsdA$",
+		"$scrypt$ln=30,r=8,p=1$c29tZXNhbHRzb21lc2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		"$1$$G//4keteveJp0qb8z2DxG/",
+	} {
+		if err := manager.Verify(encoded, []byte("supersecret"), 0); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Verify(%q) want: %v; got %v", encoded, ErrInvalidHash, err)
+		}
+	}
+}
+
+func TestCanImport(t *testing.T) {
+	manager := NewManager(NewArgon2id(testArgon2idParams), NewScrypt(testScryptParams), NewBcrypt(testBcryptCost))
+	manager.Register(NewPBKDF2SHA256())
+
+	if !manager.CanImport(FormatDjango) {
+		t.Errorf("expected django hashes to be importable")
+	}
+	// Firebase hashes can't be verified without the project's hash parameters
+	if manager.CanImport(FormatFirebase) {
+		t.Errorf("expected firebase hashes not to be importable without a verifier")
+	}
+	if manager.CanImport("sha1") {
+		t.Errorf("expected an unsupported format not to be importable")
+	}
+
+	encoded, err := ConvertForeignHash(FormatFirebase, "lSrfV15cpx95/sZS2W9c9Kp6i/LVgQNDNC/qzrCnh1SAyZvqmZqAjTdn3aoItz+VHjoZilo78198JAdRuid5lQ==", "42xEC+ixf3L2lw==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.CanVerify(encoded) {
+		t.Errorf("expected converted firebase hash not to be verifiable")
+	}
+}
+
+func TestPepperRotation(t *testing.T) {
+	manager := NewManager(NewArgon2id(testArgon2idParams))
+
+	// A hash made before peppering was enabled
+	unpeppered, err := manager.Hash([]byte("supersecret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1, err := ParsePeppers("1:first-pepper-secret-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetPeppers(v1)
+
+	if err := manager.Verify(unpeppered, []byte("supersecret"), 0); err != nil {
+		t.Errorf("expected unpeppered hash to verify, got: %v", err)
+	}
+	if !manager.NeedsRehash(unpeppered, 0) {
+		t.Errorf("expected unpeppered hash to need a rehash")
+	}
+
+	peppered, err := manager.Hash([]byte("supersecret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.PepperVersion(); got != 1 {
+		t.Fatalf("want pepper version 1; got %d", got)
+	}
+	if err := manager.Verify(peppered, []byte("supersecret"), 0); !errors.Is(err, ErrMismatchedPassword) {
+		t.Errorf("expected peppered hash not to verify without the pepper, got: %v", err)
+	}
+
+	// Rotate to a new pepper, keeping the old one around
+	v2, err := ParsePeppers("1:first-pepper-secret-value,2:second-pepper-secret-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetPeppers(v2)
+
+	if err := manager.Verify(peppered, []byte("supersecret"), 1); err != nil {
+		t.Errorf("expected hash with old pepper to verify, got: %v", err)
+	}
+	if !manager.NeedsRehash(peppered, 1) {
+		t.Errorf("expected hash with old pepper to need a rehash")
+	}
+
+	// Once the old pepper is removed, its hashes can't be verified anymore
+	manager.SetPeppers(mustParsePeppers(t, "2:second-pepper-secret-value"))
+	if err := manager.Verify(peppered, []byte("supersecret"), 1); !errors.Is(err, ErrUnknownPepper) {
+		t.Errorf("want: %v; got %v", ErrUnknownPepper, err)
+	}
+}
+
+func TestParsePeppersInvalid(t *testing.T) {
+	for _, s := range []string{
+		"no-version-secret-value",
+		"x:not-a-number-version",
+		"0:version-zero-is-reserved",
+		"1:too-short",
+		"1:first-pepper-secret-value,1:duplicate-version-value",
+	} {
+		if _, err := ParsePeppers(s); err == nil {
+			t.Errorf("ParsePeppers(%q) expected an error", s)
+		}
+	}
+}
+
+func TestLoadPeppers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peppers")
+	content := "# comment\n1:first, pepper secret \r\n\n2:second-pepper-secret-value\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	peppers, err := LoadPeppers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := peppers.Current(); got != 2 {
+		t.Errorf("want current pepper version 2; got %d", got)
+	}
+	// Commas and whitespace are part of the secret in a file
+	if got := string(peppers.secrets[1]); got != "first, pepper secret " {
+		t.Errorf("want secret %q; got %q", "first, pepper secret ", got)
+	}
+}
+
+func TestParsePeppersKeepsWhitespace(t *testing.T) {
+	peppers := mustParsePeppers(t, "1: first-pepper-secret-value ")
+	if got := string(peppers.secrets[1]); got != " first-pepper-secret-value " {
+		t.Errorf("want secret %q; got %q", " first-pepper-secret-value ", got)
+	}
+}
+
+func mustParsePeppers(t *testing.T, s string) *Peppers {
+	t.Helper()
+	p, err := ParsePeppers(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDummyVerify(t *testing.T) {
+	manager := NewManager(NewArgon2id(testArgon2idParams), NewBcrypt(testBcryptCost))
+	manager.DummyVerify([]byte("supersecret"))
+
+	// The dummy hash must be made by the current hasher, so verifying against it
+	// costs the same as verifying a real, up to date hash.
+	if got := Identify(manager.dummyHash); got != argon2idID {
+		t.Errorf("want dummy hash made with %q; got %q", argon2idID, got)
+	}
+}
@@ -0,0 +1,445 @@
+package hashing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The hashers in this file only exist to verify password hashes imported from
+// other systems. They can't be used to create new hashes, and every hash they
+// verify needs a rehash, so users are moved on to the current algorithm the first
+// time they sign in.
+
+// ErrVerifyOnly is returned when trying to create a hash with an algorithm we
+// only support for verifying imported hashes.
+var ErrVerifyOnly = errors.New("password hashing algorithm can only verify existing hashes")
+
+const (
+	pbkdf2SHA256ID   = "pbkdf2-sha256"
+	firebaseScryptID = "firebase-scrypt"
+	md5CryptID       = "md5-crypt"
+)
+
+// pbkdf2MaxIterations is the most iterations of the pbkdf2-sha256 hashes
+// verified, about twice what Django currently uses.
+const pbkdf2MaxIterations = 2000000
+
+// ----------------------- PBKDF2-SHA256 ----------------------- //
+
+// PBKDF2SHA256 verifies PBKDF2-HMAC-SHA256 hashes in the form
+// $pbkdf2-sha256$i=<iterations>$<salt>$<hash>, which is what Django's
+// "pbkdf2_sha256$<iterations>$<salt>$<hash>" hashes are converted to on import.
+type PBKDF2SHA256 struct{}
+
+func NewPBKDF2SHA256() *PBKDF2SHA256 {
+	return &PBKDF2SHA256{}
+}
+
+func (p *PBKDF2SHA256) ID() string {
+	return pbkdf2SHA256ID
+}
+
+func (p *PBKDF2SHA256) Hash(password []byte) (string, error) {
+	return "", ErrVerifyOnly
+}
+
+func (p *PBKDF2SHA256) Verify(encoded string, password []byte) (bool, error) {
+	iterations, salt, key, err := decodePBKDF2SHA256(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := pbkdf2.Key(password, salt, iterations, len(key), sha256.New)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (p *PBKDF2SHA256) NeedsRehash(encoded string) bool {
+	return true
+}
+
+func decodePBKDF2SHA256(encoded string) (int, []byte, []byte, error) {
+	// "", "pbkdf2-sha256", "i=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != pbkdf2SHA256ID {
+		return 0, nil, nil, ErrInvalidHash
+	}
+
+	var iterations int
+	if _, err := fmt.Sscanf(parts[2], "i=%d", &iterations); err != nil || iterations < 1 || iterations > pbkdf2MaxIterations {
+		return 0, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(salt) < minSaltLength {
+		return 0, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) < minKeyLength {
+		return 0, nil, nil, ErrInvalidHash
+	}
+
+	return iterations, salt, key, nil
+}
+
+// ----------------------- Firebase scrypt ----------------------- //
+
+// FirebaseScryptParams are the project wide hash parameters shown in the Firebase
+// console under Authentication > Users > Password hash parameters. SignerKey and
+// SaltSeparator are base64 encoded, exactly as the console shows them.
+type FirebaseScryptParams struct {
+	SignerKey     string
+	SaltSeparator string
+	Rounds        int
+	MemCost       int
+}
+
+// FirebaseScrypt verifies hashes exported from Firebase Authentication, stored in
+// the form $firebase-scrypt$<salt>$<hash>. Firebase uses a modified scrypt: the
+// scrypt output is used as an AES-256-CTR key to encrypt the project's signer
+// key, and the ciphertext is the password hash.
+type FirebaseScrypt struct {
+	signerKey     []byte
+	saltSeparator []byte
+	rounds        int
+	memCost       int
+}
+
+func NewFirebaseScrypt(params FirebaseScryptParams) (*FirebaseScrypt, error) {
+	signerKey, err := base64.StdEncoding.DecodeString(params.SignerKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid firebase signer key: %w", err)
+	}
+
+	saltSeparator, err := base64.StdEncoding.DecodeString(params.SaltSeparator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid firebase salt separator: %w", err)
+	}
+
+	return &FirebaseScrypt{
+		signerKey:     signerKey,
+		saltSeparator: saltSeparator,
+		rounds:        params.Rounds,
+		memCost:       params.MemCost,
+	}, nil
+}
+
+func (f *FirebaseScrypt) ID() string {
+	return firebaseScryptID
+}
+
+func (f *FirebaseScrypt) Hash(password []byte) (string, error) {
+	return "", ErrVerifyOnly
+}
+
+func (f *FirebaseScrypt) Verify(encoded string, password []byte) (bool, error) {
+	salt, hash, err := decodeFirebaseScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	fullSalt := append(append([]byte{}, salt...), f.saltSeparator...)
+	derivedKey, err := scrypt.Key(password, fullSalt, 1<<f.memCost, f.rounds, 1, 32)
+	if err != nil {
+		return false, err
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return false, err
+	}
+
+	other := make([]byte, len(f.signerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(other, f.signerKey)
+
+	return subtle.ConstantTimeCompare(hash, other) == 1, nil
+}
+
+func (f *FirebaseScrypt) NeedsRehash(encoded string) bool {
+	return true
+}
+
+// decodeFirebaseScrypt returns the salt and hash of a Firebase hash. Its costs
+// are the project's, so only their lengths are checked.
+func decodeFirebaseScrypt(encoded string) ([]byte, []byte, error) {
+	// "", "firebase-scrypt", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[1] != firebaseScryptID {
+		return nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(salt) < minSaltLength {
+		return nil, nil, ErrInvalidHash
+	}
+
+	hash, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(hash) < minKeyLength {
+		return nil, nil, ErrInvalidHash
+	}
+
+	return salt, hash, nil
+}
+
+// ----------------------- MD5-crypt ----------------------- //
+
+// MD5Crypt verifies the FreeBSD MD5-crypt hashes ($1$<salt>$<hash>) produced by
+// crypt(3), htpasswd and older PHP applications.
+type MD5Crypt struct{}
+
+func NewMD5Crypt() *MD5Crypt {
+	return &MD5Crypt{}
+}
+
+func (m *MD5Crypt) ID() string {
+	return md5CryptID
+}
+
+func (m *MD5Crypt) Hash(password []byte) (string, error) {
+	return "", ErrVerifyOnly
+}
+
+func (m *MD5Crypt) Verify(encoded string, password []byte) (bool, error) {
+	salt, err := decodeMD5Crypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := md5Crypt(password, salt)
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(other)) == 1, nil
+}
+
+func (m *MD5Crypt) NeedsRehash(encoded string) bool {
+	return true
+}
+
+// decodeMD5Crypt returns the salt of an MD5-crypt hash, which is at most 8
+// characters and used as they are.
+func decodeMD5Crypt(encoded string) ([]byte, error) {
+	// "", "1", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[1] != "1" || parts[2] == "" || len(parts[2]) > 8 || len(parts[3]) != 22 {
+		return nil, ErrInvalidHash
+	}
+	return []byte(parts[2]), nil
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5Crypt is a port of Poul-Henning Kamp's original crypt_md5.c.
+func md5Crypt(password, salt []byte) string {
+	const magic = "$1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alternate := md5.New()
+	alternate.Write(password)
+	alternate.Write(salt)
+	alternate.Write(password)
+	final := alternate.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(password)
+	ctx.Write([]byte(magic))
+	ctx.Write(salt)
+	for i := len(password); i > 0; i -= 16 {
+		if i > 16 {
+			ctx.Write(final)
+		} else {
+			ctx.Write(final[:i])
+		}
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(password[:1])
+		}
+	}
+	final = ctx.Sum(nil)
+
+	// Slow things down with 1000 extra rounds
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(password)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write(salt)
+		}
+		if i%7 != 0 {
+			round.Write(password)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(password)
+		}
+		final = round.Sum(nil)
+	}
+
+	out := make([]byte, 0, 22)
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out = append(out, cryptAlphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(uint32(final[0])<<16|uint32(final[6])<<8|uint32(final[12]), 4)
+	encode(uint32(final[1])<<16|uint32(final[7])<<8|uint32(final[13]), 4)
+	encode(uint32(final[2])<<16|uint32(final[8])<<8|uint32(final[14]), 4)
+	encode(uint32(final[3])<<16|uint32(final[9])<<8|uint32(final[15]), 4)
+	encode(uint32(final[4])<<16|uint32(final[10])<<8|uint32(final[5]), 4)
+	encode(uint32(final[11]), 2)
+
+	return magic + string(salt) + "$" + string(out)
+}
+
+// ----------------------- Import ----------------------- //
+
+// Formats accepted by ConvertForeignHash
+const (
+	FormatDjango   = "django"
+	FormatFirebase = "firebase"
+	FormatMD5Crypt = "md5-crypt"
+	// FormatNative is any hash already in a format we store, such as bcrypt or
+	// PHC encoded argon2id and scrypt hashes.
+	FormatNative = "native"
+)
+
+// formatAlgorithms is the algorithm each foreign format is converted to.
+var formatAlgorithms = map[string][]string{
+	FormatDjango:   {pbkdf2SHA256ID},
+	FormatFirebase: {firebaseScryptID},
+	FormatMD5Crypt: {md5CryptID},
+	FormatNative:   {argon2idID, scryptID, bcryptID},
+}
+
+// CanImport reports whether hashes imported in the format can be verified once
+// converted. Firebase hashes, for one, can only be verified when the project's
+// hash parameters are configured. It is false for unsupported formats.
+func (m *Manager) CanImport(format string) bool {
+	algorithms, ok := formatAlgorithms[format]
+	if !ok {
+		return false
+	}
+	for _, id := range algorithms {
+		if _, ok := m.hashers[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ConvertForeignHash converts a password hash exported from another system into
+// the encoded form we store, whose prefix records the algorithm it was made with.
+// salt is only used by the Firebase format, which exports it separately. The
+// converted hash has to pass the same checks as when it is verified, so hashes
+// whose costs are out of range, or whose salt or key are too short, are refused.
+func ConvertForeignHash(format, hash, salt string) (string, error) {
+	encoded, err := convertForeignHash(format, hash, salt)
+	if err != nil {
+		return "", err
+	}
+	if err := checkHash(encoded); err != nil {
+		return "", fmt.Errorf("%w: parameters, salt or key out of range", err)
+	}
+	return encoded, nil
+}
+
+func convertForeignHash(format, hash, salt string) (string, error) {
+	switch format {
+	case FormatDjango:
+		// pbkdf2_sha256$<iterations>$<salt>$<base64 hash>
+		parts := strings.Split(hash, "$")
+		if len(parts) != 4 || parts[0] != "pbkdf2_sha256" {
+			return "", fmt.Errorf("%w: expected a django pbkdf2_sha256 hash", ErrInvalidHash)
+		}
+		iterations, err := strconv.Atoi(parts[1])
+		if err != nil || iterations < 1 {
+			return "", fmt.Errorf("%w: invalid iteration count", ErrInvalidHash)
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[3])
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid base64 hash", ErrInvalidHash)
+		}
+		return fmt.Sprintf(
+			"$%s$i=%d$%s$%s",
+			pbkdf2SHA256ID,
+			iterations,
+			base64.RawStdEncoding.EncodeToString([]byte(parts[2])),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+
+	case FormatFirebase:
+		// Firebase exports the hash and salt as separate standard base64 strings
+		key, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid base64 hash", ErrInvalidHash)
+		}
+		saltBytes, err := base64.StdEncoding.DecodeString(salt)
+		if err != nil || len(saltBytes) == 0 {
+			return "", fmt.Errorf("%w: invalid base64 salt", ErrInvalidHash)
+		}
+		return fmt.Sprintf(
+			"$%s$%s$%s",
+			firebaseScryptID,
+			base64.RawStdEncoding.EncodeToString(saltBytes),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+
+	case FormatMD5Crypt:
+		if Identify(hash) != md5CryptID {
+			return "", fmt.Errorf("%w: expected a $1$ md5-crypt hash", ErrInvalidHash)
+		}
+		return hash, nil
+
+	case FormatNative:
+		switch Identify(hash) {
+		case argon2idID, scryptID, bcryptID:
+			return hash, nil
+		default:
+			return "", fmt.Errorf("%w: unrecognised hash format", ErrInvalidHash)
+		}
+
+	default:
+		return "", fmt.Errorf("unsupported password hash format %q", format)
+	}
+}
+
+// checkHash runs an encoded hash through the checks its algorithm makes before
+// verifying it.
+func checkHash(encoded string) error {
+	var err error
+	switch Identify(encoded) {
+	case argon2idID:
+		_, _, _, err = decodeArgon2id(encoded)
+	case scryptID:
+		_, _, _, err = decodeScrypt(encoded)
+	case bcryptID:
+		_, err = decodeBcryptCost(encoded)
+	case pbkdf2SHA256ID:
+		_, _, _, err = decodePBKDF2SHA256(encoded)
+	case firebaseScryptID:
+		_, _, err = decodeFirebaseScrypt(encoded)
+	case md5CryptID:
+		_, err = decodeMD5Crypt(encoded)
+	default:
+		err = ErrInvalidHash
+	}
+	return err
+}
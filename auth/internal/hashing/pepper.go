@@ -0,0 +1,132 @@
+package hashing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownPepper is returned when a hash was peppered with a version of the
+// pepper that is no longer configured.
+var ErrUnknownPepper = errors.New("unknown password pepper version")
+
+// Peppers holds every version of the server side password pepper. A pepper is a
+// secret that is mixed into the password with HMAC-SHA256 before it is hashed.
+// Unlike a salt it is never stored in the database, so a database dump alone is
+// not enough to attack the hashes.
+//
+// Version 0 always means "no pepper", which is what every hash made before
+// peppering was introduced uses. Rotating the pepper is done by adding a new,
+// higher version. Hashes made with older versions keep verifying, and are
+// re-peppered with the current version the next time the user logs in.
+type Peppers struct {
+	secrets map[int][]byte
+	current int
+}
+
+// NewPeppers returns the peppers with the given secrets by version. The highest
+// version is used for new hashes.
+func NewPeppers(secrets map[int][]byte) (*Peppers, error) {
+	p := &Peppers{secrets: make(map[int][]byte, len(secrets))}
+	for version, secret := range secrets {
+		if version < 1 {
+			return nil, fmt.Errorf("pepper versions must be greater than 0, got %d", version)
+		}
+		if len(secret) < 16 {
+			return nil, fmt.Errorf("pepper version %d must be at least 16 bytes long", version)
+		}
+		p.secrets[version] = secret
+		if version > p.current {
+			p.current = version
+		}
+	}
+	return p, nil
+}
+
+// ParsePeppers reads comma separated peppers in the form "<version>:<secret>",
+// as they are given in the PASSWORD_PEPPERS environment variable. Secrets are
+// used byte for byte, so they can't contain commas, and any whitespace around
+// them is part of the secret. Use LoadPeppers for secrets with commas.
+func ParsePeppers(s string) (*Peppers, error) {
+	return parsePepperEntries(strings.Split(s, ","))
+}
+
+// LoadPeppers reads peppers in the form "<version>:<secret>" from a file, one
+// per line. Blank lines and lines starting with # are ignored. Secrets are used
+// byte for byte up to the end of the line, so whitespace is part of the secret.
+func LoadPeppers(path string) (*Peppers, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return parsePepperEntries(entries)
+}
+
+func parsePepperEntries(entries []string) (*Peppers, error) {
+	secrets := make(map[int][]byte)
+
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("peppers must be in the form <version>:<secret>")
+		}
+
+		version, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pepper version %q", parts[0])
+		}
+		if _, exists := secrets[version]; exists {
+			return nil, fmt.Errorf("pepper version %d is defined more than once", version)
+		}
+		secrets[version] = []byte(parts[1])
+	}
+
+	return NewPeppers(secrets)
+}
+
+// Current returns the version of the pepper used for new hashes, 0 if there is none.
+func (p *Peppers) Current() int {
+	if p == nil {
+		return 0
+	}
+	return p.current
+}
+
+// Apply mixes the pepper of the given version into the password. With version 0
+// the password is returned unchanged. The HMAC is base64 encoded so that it's
+// safe to pass to any hasher, bcrypt included.
+func (p *Peppers) Apply(password []byte, version int) ([]byte, error) {
+	if version == 0 {
+		return password, nil
+	}
+
+	var secret []byte
+	if p != nil {
+		secret = p.secrets[version]
+	}
+	if secret == nil {
+		return nil, ErrUnknownPepper
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(password)
+	sum := mac.Sum(nil)
+
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(sum)))
+	base64.StdEncoding.Encode(encoded, sum)
+	return encoded, nil
+}
@@ -0,0 +1,132 @@
+package hashing
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const scryptID = "scrypt"
+
+// The highest costs of the scrypt hashes verified. scrypt uses 128 * r * N
+// bytes of memory.
+const (
+	scryptMaxMemory = 1 << 30 // 1 GiB
+	scryptMaxR      = 32
+	scryptMaxP      = 16
+)
+
+// ScryptParams are the cost parameters of scrypt. The CPU/memory cost N is
+// stored as its base 2 logarithm, LogN.
+type ScryptParams struct {
+	LogN       uint8
+	R          int
+	P          int
+	SaltLength int
+	KeyLength  int
+}
+
+var DefaultScryptParams = ScryptParams{
+	LogN:       15,
+	R:          8,
+	P:          1,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+type Scrypt struct {
+	params ScryptParams
+}
+
+func NewScrypt(params ScryptParams) *Scrypt {
+	return &Scrypt{params: params}
+}
+
+func (s *Scrypt) ID() string {
+	return scryptID
+}
+
+// Hash returns a hash in the form $scrypt$ln=15,r=8,p=1$<salt>$<hash>
+func (s *Scrypt) Hash(password []byte) (string, error) {
+	salt := make([]byte, s.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key(password, salt, 1<<s.params.LogN, s.params.R, s.params.P, s.params.KeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(
+		"$%s$ln=%d,r=%d,p=%d$%s$%s",
+		scryptID,
+		s.params.LogN,
+		s.params.R,
+		s.params.P,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (s *Scrypt) Verify(encoded string, password []byte) (bool, error) {
+	params, salt, key, err := decodeScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other, err := scrypt.Key(password, salt, 1<<params.LogN, params.R, params.P, params.KeyLength)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (s *Scrypt) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeScrypt(encoded)
+	if err != nil {
+		return true
+	}
+	return params.LogN != s.params.LogN ||
+		params.R != s.params.R ||
+		params.P != s.params.P ||
+		params.KeyLength != s.params.KeyLength ||
+		params.SaltLength != s.params.SaltLength
+}
+
+func decodeScrypt(encoded string) (ScryptParams, []byte, []byte, error) {
+	var params ScryptParams
+
+	// "", "scrypt", "ln=...,r=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != scryptID {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.LogN, &params.R, &params.P); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if params.LogN == 0 || params.LogN > 30 ||
+		params.R < 1 || params.R > scryptMaxR || params.P < 1 || params.P > scryptMaxP ||
+		uint64(128*params.R)<<params.LogN > scryptMaxMemory {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(salt) < minSaltLength {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.SaltLength = len(salt)
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) < minKeyLength {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.KeyLength = len(key)
+
+	return params, salt, key, nil
+}
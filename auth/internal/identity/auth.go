@@ -12,16 +12,19 @@ import (
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/hashing"
 	"github.com/todo-app/pkg/logger"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserNotActivated   = errors.New("account not activated")
-	IdentitySessionName   = "user-session"
-	SessionStore          *sessions.CookieStore
-	cookies               *securecookie.SecureCookie
+	// ErrPasswordResetRequired is returned when an admin has required the user
+	// to reset their password before signing in again.
+	ErrPasswordResetRequired = errors.New("password reset required")
+	IdentitySessionName      = "user-session"
+	SessionStore             *sessions.CookieStore
+	cookies                  *securecookie.SecureCookie
 )
 
 func init() {
@@ -40,30 +43,90 @@ func init() {
 type LoginRequest struct {
 	Email     string `json:"email"`
 	Passsword string `json:"password"`
+	// IP is the address of the client signing in, and UserAgent and RequestID
+	// identify its request in the audit log. All three are set by the handler.
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+	RequestID string `json:"-"`
 }
 
 type JWTClaims struct {
-	UserId    uuid.UUID `json:"user_id"`
-	Email     string    `json:"email"`
-	Activated bool      `json:"activated"`
+	UserId uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	// Status is the status of the account when the token was issued.
+	// AuthenticationMiddleware checks the current one on every request.
+	Status string `json:"status"`
+	// Roles and Permissions are a snapshot taken when the token was issued.
+	// Assigning or removing a role, or changing the permissions of one of their
+	// roles, revokes the user's sessions, so they sign in again and pick up the
+	// change.
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// OrgID is the organization the user is signed in to, and OrgRole their role
+	// in it when the token was issued. Both are empty if the user doesn't belong
+	// to any organization.
+	OrgID   string `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// Act is set when an admin is impersonating the user, see impersonation.go.
+	Act *ActorClaim `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
+// HasPermission reports whether the token grants the permission.
+func (c JWTClaims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HashPassword hashes a password with the current password hashing algorithm and
+// pepper. The pepper version it used is returned by PepperVersion and has to be
+// stored with the hash.
 func HashPassword(password []byte) ([]byte, error) {
-	return bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+	hash, err := hashing.Default().Hash(password)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(hash), nil
+}
+
+// PepperVersion returns the version of the pepper used by HashPassword.
+func PepperVersion() int {
+	return hashing.Default().PepperVersion()
+}
+
+// ComparePasswords returns nil if the supplied password matches the hashed
+// password, whichever supported algorithm and pepper version it was hashed with.
+func ComparePasswords(hashedPassword, suppliedPassword []byte, pepperVersion int) error {
+	return hashing.Default().Verify(string(hashedPassword), suppliedPassword, pepperVersion)
 }
 
-func ComparePasswords(hashedPassword, suppliedPassword []byte) error {
-	return bcrypt.CompareHashAndPassword(hashedPassword, suppliedPassword)
+// CompareDummyPassword takes as long as ComparePasswords, but always fails. Use it
+// when there is no user to compare the password against so the response time
+// doesn't give away that the user doesn't exist.
+func CompareDummyPassword(suppliedPassword []byte) error {
+	hashing.Default().DummyVerify(suppliedPassword)
+	return ErrInvalidCredentials
 }
 
-func newToken(claims *JWTClaims) (string, error) {
+// PasswordNeedsRehash reports whether a hashed password was made with an outdated
+// algorithm, work factor or pepper, and should be hashed again with the current ones.
+func PasswordNeedsRehash(hashedPassword []byte, pepperVersion int) bool {
+	return hashing.Default().NeedsRehash(string(hashedPassword), pepperVersion)
+}
+
+func newToken(claims *JWTClaims, ttl time.Duration) (string, error) {
 	//TODO:
 	//TODO:
 	//TODO:
 	//TODO: Make Expiration time 15 minutes and implement a refresh token
 	// Add expiration to the claims
-	claims.ExpiresAt = time.Now().Add(24 * time.Hour).Unix()
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -94,13 +157,22 @@ func ExtractClaimsFromToken(tokenString string) (JWTClaims, error) {
 	}
 }
 
+// claimsForUser returns the claims of a token for the user.
+func claimsForUser(user *domain.User) *JWTClaims {
+	return &JWTClaims{
+		UserId:      user.ID,
+		Email:       user.Email,
+		Status:      user.Status,
+		Roles:       user.Roles,
+		Permissions: user.Permissions,
+		OrgID:       user.OrgID,
+		OrgRole:     user.OrgRole,
+	}
+}
+
 // TODO: Add Expiration date on cookie
 func SetCookie(w http.ResponseWriter, user *domain.User) error {
-	token, err := newToken(&JWTClaims{
-		UserId:    user.ID,
-		Email:     user.Email,
-		Activated: user.Activated,
-	})
+	token, err := newToken(claimsForUser(user), 24*time.Hour)
 
 	if err != nil {
 		return err
@@ -109,6 +181,11 @@ func SetCookie(w http.ResponseWriter, user *domain.User) error {
 		"token": token,
 	}
 
+	return writeCookie(w, cookieValue)
+}
+
+// writeCookie encodes the values into the "auth-session" cookie.
+func writeCookie(w http.ResponseWriter, cookieValue map[string]string) error {
 	encoded, err := cookies.Encode("auth-session", cookieValue)
 	if err != nil {
 		return err
@@ -130,26 +207,49 @@ func SetCookie(w http.ResponseWriter, user *domain.User) error {
 	return nil
 }
 
+// ClearCookie expires the "auth-session" cookie on the client, effectively
+// logging the user out of the current session.
+func ClearCookie(w http.ResponseWriter) {
+	cookie := &http.Cookie{
+		Name:     "auth-session",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+	}
+	http.SetCookie(w, cookie)
+}
+
 // GetTokenFromCookie extracts a cookie from the request named "auth-session"
 // If not present, it will return an error and an emtpy string.
 // Once we verify that the cookie is present, we decode it, which should
 // contain a key value pair of "jwt": "{JSON web token}".
 func GetTokenFromCookie(r *http.Request) (string, error) {
+	value, err := readCookie(r)
+	if err != nil {
+		return "", err
+	}
+	token := value["token"]
+	return token, nil
+}
+
+// readCookie decodes the values of the "auth-session" cookie.
+func readCookie(r *http.Request) (map[string]string, error) {
 
 	value := make(map[string]string)
 
 	cookie, err := r.Cookie("auth-session")
 	if err != nil {
 		logger.Error.Println("Error getting cookie", err)
-		return "", err
+		return nil, err
 	}
 
 	if err := cookies.Decode("auth-session", cookie.Value, &value); err != nil {
 		logger.Error.Println("Error Decoding cookie", err)
-		return "", err
+		return nil, err
 	}
-	token := value["token"]
-	return token, nil
+	return value, nil
 }
 
 var UserCtxKey = &authContextKey{"user"}
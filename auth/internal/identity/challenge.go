@@ -0,0 +1,42 @@
+package identity
+
+import (
+	"errors"
+
+	"github.com/todo-app/internal/domain"
+)
+
+var (
+	// ErrLoginConfirmationRequired is returned when a sign in with the right
+	// password looks too risky to sign in without the user confirming it by email.
+	ErrLoginConfirmationRequired = errors.New("sign in must be confirmed")
+	ErrInvalidConfirmationToken  = errors.New("invalid or expired confirmation token")
+)
+
+// ChallengeError is returned instead of ErrLoginConfirmationRequired with the
+// token the user has to be emailed to confirm the sign in.
+// errors.Is(err, ErrLoginConfirmationRequired) is true for every ChallengeError.
+type ChallengeError struct {
+	User  *domain.User
+	Token *domain.Token
+	// Location is where the sign in came from, if it could be located.
+	Location *domain.GeoLocation
+}
+
+func (e *ChallengeError) Error() string {
+	return ErrLoginConfirmationRequired.Error()
+}
+
+func (e *ChallengeError) Is(target error) bool {
+	return target == ErrLoginConfirmationRequired
+}
+
+// LoginConfirmationRequest confirms a sign in that was challenged, with the
+// token emailed to the user.
+type LoginConfirmationRequest struct {
+	Token string `json:"token"`
+	// IP, UserAgent and RequestID are set by the handler, as for LoginRequest.
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+	RequestID string `json:"-"`
+}
@@ -0,0 +1,80 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/domain"
+)
+
+var (
+	// ErrNotImpersonating is returned by StopImpersonation when the request isn't
+	// from an impersonation session.
+	ErrNotImpersonating = errors.New("not impersonating a user")
+	// ErrImpersonationEnded is returned for an impersonation token whose session
+	// has been stopped.
+	ErrImpersonationEnded = errors.New("impersonation session has ended")
+)
+
+// ActorClaim identifies the admin really using a token issued to impersonate
+// another user, like the "act" claim of RFC 8693.
+type ActorClaim struct {
+	UserId    uuid.UUID `json:"sub"`
+	Email     string    `json:"email"`
+	SessionID int64     `json:"sid"`
+}
+
+// Impersonating reports whether the token was issued to an admin impersonating
+// the user.
+func (c JWTClaims) Impersonating() bool {
+	return c.Act != nil
+}
+
+// SetImpersonationCookie signs the actor in as the user for ttl. The actor's own
+// token is kept in the cookie, so StopImpersonation can sign them back in.
+func SetImpersonationCookie(w http.ResponseWriter, r *http.Request, user *domain.User, actor ActorClaim, ttl time.Duration) error {
+	actorToken, err := GetTokenFromCookie(r)
+	if err != nil {
+		return err
+	}
+
+	claims := claimsForUser(user)
+	claims.Act = &actor
+	token, err := newToken(claims, ttl)
+	if err != nil {
+		return err
+	}
+
+	return writeCookie(w, map[string]string{
+		"token":                 token,
+		"actor_token":           actorToken,
+		"impersonation_session": strconv.FormatInt(actor.SessionID, 10),
+	})
+}
+
+// StopImpersonation signs the actor back in with the token they had before they
+// started impersonating, and returns the id of the impersonation session. It
+// works even after the impersonation token has expired. If the actor's own token
+// has expired too they are signed out.
+func StopImpersonation(w http.ResponseWriter, r *http.Request) (int64, error) {
+	values, err := readCookie(r)
+	if err != nil || values["actor_token"] == "" {
+		return 0, ErrNotImpersonating
+	}
+
+	sessionID, err := strconv.ParseInt(values["impersonation_session"], 10, 64)
+	if err != nil {
+		return 0, ErrNotImpersonating
+	}
+
+	actorToken := values["actor_token"]
+	if _, err := ExtractClaimsFromToken(actorToken); err != nil {
+		ClearCookie(w)
+		return sessionID, nil
+	}
+
+	return sessionID, writeCookie(w, map[string]string{"token": actorToken})
+}
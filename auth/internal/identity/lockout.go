@@ -0,0 +1,38 @@
+package identity
+
+import (
+	"errors"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// ErrAccountLocked is returned when signing in is refused because of too many
+// failed attempts, either on the account or from the client's IP address.
+var ErrAccountLocked = errors.New("too many failed sign in attempts")
+
+// LockoutError is returned instead of ErrAccountLocked to say how long the lock
+// lasts. errors.Is(err, ErrAccountLocked) is true for every LockoutError.
+type LockoutError struct {
+	Until time.Time
+	// Account is true when the account is locked, and false when the client's IP
+	// address is.
+	Account bool
+	// User and UnlockToken are only set on the failed attempt that locked the
+	// account, so the user can be emailed a way to unlock it straight away.
+	User        *domain.User
+	UnlockToken *domain.Token
+}
+
+func (e *LockoutError) Error() string {
+	return ErrAccountLocked.Error()
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// RetryAfter returns how long the client has to wait before trying again.
+func (e *LockoutError) RetryAfter() time.Duration {
+	return time.Until(e.Until)
+}
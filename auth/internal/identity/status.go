@@ -0,0 +1,35 @@
+package identity
+
+import (
+	"errors"
+
+	"github.com/todo-app/internal/domain"
+)
+
+var (
+	ErrAccountSuspended = errors.New("account suspended")
+	// ErrAccountOnHold is returned for accounts with domain.StatusLocked. It is
+	// distinct from ErrAccountLocked, which is about failed sign in attempts.
+	ErrAccountOnHold = errors.New("account locked for security reasons")
+	ErrAccountClosed = errors.New("account closed")
+	// ErrSessionRevoked is returned for a token issued before the user revoked
+	// their sessions.
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// CheckStatus returns nil if an account with the status can be used, or the
+// error saying why it can't.
+func CheckStatus(status string) error {
+	switch status {
+	case domain.StatusActive:
+		return nil
+	case domain.StatusPending:
+		return ErrUserNotActivated
+	case domain.StatusSuspended:
+		return ErrAccountSuspended
+	case domain.StatusLocked:
+		return ErrAccountOnHold
+	default:
+		return ErrAccountClosed
+	}
+}
@@ -0,0 +1,146 @@
+// Package ipfilter restricts which IP addresses can use the service, and the
+// organizations in it, with the allow and deny rules set by admins.
+package ipfilter
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// ErrNotAllowed is returned for clients whose IP address the rules don't allow.
+var ErrNotAllowed = errors.New("access from your IP address isn't allowed")
+
+// RuleSource loads every IP rule, see repositories.IPRuleRepositoryInterface.
+type RuleSource interface {
+	GetAll() ([]*domain.IPRule, error)
+}
+
+// Filter checks IP addresses against the rules of the whole service and of
+// organizations. The rules are cached for ttl, so that they aren't loaded on
+// every request. A nil *Filter allows every address.
+type Filter struct {
+	source RuleSource
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	// policies are by organization id, with the rules of the whole service
+	// under "".
+	policies map[string]policy
+}
+
+func New(source RuleSource, ttl time.Duration) *Filter {
+	return &Filter{source: source, ttl: ttl}
+}
+
+// Check returns ErrNotAllowed unless the IP address is allowed by the rules of
+// the whole service and of each of the organizations.
+func (f *Filter) Check(ip string, orgIds ...string) error {
+	if f == nil {
+		return nil
+	}
+
+	policies, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	parsed := net.ParseIP(ip)
+	if !policies[""].permits(parsed) {
+		return ErrNotAllowed
+	}
+	for _, orgId := range orgIds {
+		if !policies[orgId].permits(parsed) {
+			return ErrNotAllowed
+		}
+	}
+	return nil
+}
+
+// Invalidate makes the next check load the rules again, so that changes to
+// them apply straight away.
+func (f *Filter) Invalidate() {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policies = nil
+}
+
+// load returns the cached policies, loading them again if they are too old.
+func (f *Filter) load() (map[string]policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.policies != nil && time.Since(f.loadedAt) < f.ttl {
+		return f.policies, nil
+	}
+
+	rules, err := f.source.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	byOrg := map[string][]*domain.IPRule{}
+	for _, rule := range rules {
+		byOrg[rule.OrganizationID] = append(byOrg[rule.OrganizationID], rule)
+	}
+
+	f.policies = map[string]policy{}
+	for orgId, rules := range byOrg {
+		f.policies[orgId] = compile(rules)
+	}
+	f.loadedAt = time.Now()
+	return f.policies, nil
+}
+
+// Permits reports whether the rules, all of the same organization or of the
+// whole service, allow the IP address. It is used to check a change to the rules
+// before making it.
+func Permits(rules []*domain.IPRule, ip string) bool {
+	return compile(rules).permits(net.ParseIP(ip))
+}
+
+// policy is a compiled set of rules.
+type policy struct {
+	allow List
+	deny  List
+}
+
+// compile parses the rules. Rules that can't be parsed are skipped, which the
+// validation of new rules prevents.
+func compile(rules []*domain.IPRule) policy {
+	var p policy
+	for _, rule := range rules {
+		network, err := ParseNetwork(rule.CIDR)
+		if err != nil {
+			continue
+		}
+		switch rule.Action {
+		case domain.IPRuleAllow:
+			p.allow = append(p.allow, network)
+		case domain.IPRuleDeny:
+			p.deny = append(p.deny, network)
+		}
+	}
+	return p
+}
+
+// permits reports whether the IP address isn't denied and, if there are allow
+// rules, is allowed. Without any rules every address is permitted, including
+// ones that couldn't be parsed.
+func (p policy) permits(ip net.IP) bool {
+	if len(p.allow) == 0 && len(p.deny) == 0 {
+		return true
+	}
+	if ip == nil || p.deny.Contains(ip) {
+		return false
+	}
+	return len(p.allow) == 0 || p.allow.Contains(ip)
+}
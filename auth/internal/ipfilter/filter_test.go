@@ -0,0 +1,116 @@
+package ipfilter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+)
+
+type fakeSource struct {
+	rules []*domain.IPRule
+	loads int
+	err   error
+}
+
+func (s *fakeSource) GetAll() ([]*domain.IPRule, error) {
+	s.loads++
+	return s.rules, s.err
+}
+
+func TestCheck(t *testing.T) {
+	source := &fakeSource{rules: []*domain.IPRule{
+		{CIDR: "198.51.100.7/32", Action: domain.IPRuleDeny},
+		{OrganizationID: "acme", CIDR: "203.0.113.0/24", Action: domain.IPRuleAllow},
+		{OrganizationID: "acme", CIDR: "2001:db8::/32", Action: domain.IPRuleAllow},
+		{OrganizationID: "acme", CIDR: "203.0.113.128/25", Action: domain.IPRuleDeny},
+		{OrganizationID: "initech", CIDR: "192.0.2.0/24", Action: domain.IPRuleAllow},
+	}}
+	filter := New(source, time.Minute)
+
+	tests := []struct {
+		name    string
+		ip      string
+		orgIds  []string
+		wantErr error
+	}{
+		{"No rules apply", "192.0.2.1", nil, nil},
+		{"Denied everywhere", "198.51.100.7", nil, ErrNotAllowed},
+		{"Org without rules", "192.0.2.1", []string{"globex"}, nil},
+		{"In the org's allowlist", "203.0.113.5", []string{"acme"}, nil},
+		{"In the org's allowlist over IPv6", "2001:db8::1", []string{"acme"}, nil},
+		{"Outside the org's allowlist", "192.0.2.1", []string{"acme"}, ErrNotAllowed},
+		{"Deny takes precedence", "203.0.113.200", []string{"acme"}, ErrNotAllowed},
+		{"Every org must allow it", "203.0.113.5", []string{"acme", "initech"}, ErrNotAllowed},
+		{"Global deny applies to orgs", "198.51.100.7", []string{"globex"}, ErrNotAllowed},
+		{"Unparseable address", "unknown", nil, ErrNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := filter.Check(tt.ip, tt.orgIds...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if source.loads != 1 {
+		t.Errorf("got %d loads of the rules, want them cached after 1", source.loads)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	source := &fakeSource{}
+	filter := New(source, time.Hour)
+
+	if err := filter.Check("unknown"); err != nil {
+		t.Fatalf("got error %v without any rules, want nil", err)
+	}
+
+	source.rules = []*domain.IPRule{{CIDR: "192.0.2.0/24", Action: domain.IPRuleDeny}}
+	if err := filter.Check("192.0.2.1"); err != nil {
+		t.Fatalf("got error %v before invalidating, want the cached rules", err)
+	}
+
+	filter.Invalidate()
+	if err := filter.Check("192.0.2.1"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("got error %v after invalidating, want %v", err, ErrNotAllowed)
+	}
+}
+
+func TestCheckLoadError(t *testing.T) {
+	loadErr := errors.New("database down")
+	filter := New(&fakeSource{err: loadErr}, time.Minute)
+
+	if err := filter.Check("192.0.2.1"); !errors.Is(err, loadErr) {
+		t.Errorf("got error %v, want %v", err, loadErr)
+	}
+
+	var disabled *Filter
+	if err := disabled.Check("192.0.2.1", "acme"); err != nil {
+		t.Errorf("got error %v from a nil filter, want nil", err)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	list, err := ParseList(" 10.0.0.0/8, 192.0.2.1 ,,2001:db8::1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::1/128"}
+	if len(list) != len(want) {
+		t.Fatalf("got %d networks, want %d", len(list), len(want))
+	}
+	for i, network := range list {
+		if network.String() != want[i] {
+			t.Errorf("got network %s, want %s", network, want[i])
+		}
+	}
+
+	if _, err := ParseList("10.0.0.0/8, nonsense"); err == nil {
+		t.Error("expected an error parsing an invalid list")
+	}
+}
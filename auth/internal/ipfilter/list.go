@@ -0,0 +1,55 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// List is a set of IP address ranges.
+type List []*net.IPNet
+
+// ParseNetwork parses a CIDR range, or a single address as a range of one.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// ParseList parses a comma separated list of ranges and addresses, e.g.
+// "10.0.0.0/8, 192.0.2.1".
+func ParseList(s string) (List, error) {
+	var list List
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		network, err := ParseNetwork(entry)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, network)
+	}
+	return list, nil
+}
+
+// Contains reports whether the IP address is in any of the list's ranges.
+func (l List) Contains(ip net.IP) bool {
+	for _, network := range l {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
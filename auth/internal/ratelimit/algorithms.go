@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// ----------------------- Token bucket ----------------------- //
+
+// TokenBucket allows up to rate.Limit events at once, refilling one token every
+// rate.Period / rate.Limit.
+//
+// State.Value holds the tokens left and State.Timestamp when they were counted.
+type TokenBucket struct {
+	store Store
+	rate  Rate
+	now   func() time.Time
+}
+
+func NewTokenBucket(store Store, rate Rate) (*TokenBucket, error) {
+	if rate.Disabled() {
+		return nil, ErrInvalidRate
+	}
+	return &TokenBucket{store: store, rate: rate, now: time.Now}, nil
+}
+
+func (b *TokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	capacity := float64(b.rate.Limit)
+	perToken := b.rate.Period / time.Duration(b.rate.Limit)
+	result := Result{Limit: b.rate.Limit}
+
+	err := b.store.Update(ctx, key, b.rate.Period, func(s *State) error {
+		now := b.now()
+
+		tokens := capacity
+		if !s.Timestamp.IsZero() {
+			refilled := float64(now.Sub(s.Timestamp)) / float64(perToken)
+			tokens = math.Min(capacity, s.Value+refilled)
+		}
+
+		if tokens >= 1 {
+			tokens--
+			result.Allowed = true
+		} else {
+			result.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+		}
+
+		result.Remaining = int(tokens)
+		result.Reset = time.Duration((capacity - tokens) * float64(perToken))
+
+		s.Value = tokens
+		s.Timestamp = now
+		return nil
+	})
+
+	return result, err
+}
+
+// ----------------------- Sliding window ----------------------- //
+
+// SlidingWindow allows up to rate.Limit events in any window of rate.Period. It
+// approximates the sliding window from the counts of the current and previous
+// fixed windows, assuming the previous window's events were evenly spread.
+//
+// State.Value holds the count of the current window, State.Prev the count of the
+// previous one and State.Timestamp when the current window started.
+type SlidingWindow struct {
+	store Store
+	rate  Rate
+	now   func() time.Time
+}
+
+func NewSlidingWindow(store Store, rate Rate) (*SlidingWindow, error) {
+	if rate.Disabled() {
+		return nil, ErrInvalidRate
+	}
+	return &SlidingWindow{store: store, rate: rate, now: time.Now}, nil
+}
+
+func (w *SlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	window := w.rate.Period
+	limit := float64(w.rate.Limit)
+	result := Result{Limit: w.rate.Limit}
+
+	// The state must outlive the next window too, as it becomes the previous one.
+	err := w.store.Update(ctx, key, 2*window, func(s *State) error {
+		now := w.now()
+		start := now.Truncate(window)
+
+		if !s.Timestamp.Equal(start) {
+			if s.Timestamp.Equal(start.Add(-window)) {
+				s.Prev = s.Value
+			} else {
+				s.Prev = 0
+			}
+			s.Value = 0
+			s.Timestamp = start
+		}
+
+		elapsed := now.Sub(start)
+		overlap := 1 - float64(elapsed)/float64(window)
+		count := s.Prev*overlap + s.Value
+
+		if count+1 <= limit {
+			s.Value++
+			count++
+			result.Allowed = true
+		} else {
+			result.RetryAfter = w.retryAfter(s, elapsed)
+		}
+
+		result.Remaining = int(math.Max(0, limit-count))
+		result.Reset = window - elapsed
+		return nil
+	})
+
+	return result, err
+}
+
+// retryAfter works out how long until the weighted count drops enough for one
+// more event, either as the previous window slides out of this one, or once the
+// current window has become the previous one.
+func (w *SlidingWindow) retryAfter(s *State, elapsed time.Duration) time.Duration {
+	window := float64(w.rate.Period)
+	limit := float64(w.rate.Limit)
+	untilNext := time.Duration(window) - elapsed
+
+	if s.Value+1 <= limit && s.Prev > 0 {
+		// Solve Prev * (1 - t/window) + Value <= limit - 1 for t
+		t := (1 - (limit-1-s.Value)/s.Prev) * window
+		if wait := time.Duration(t) - elapsed; wait < untilNext {
+			return wait
+		}
+	}
+
+	if s.Value == 0 {
+		return untilNext
+	}
+
+	// Solve Value * (1 - t/window) <= limit - 1 for t in the next window
+	t := math.Max(0, 1-(limit-1)/s.Value) * window
+	return untilNext + time.Duration(t)
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many updates a store handles between removing expired keys.
+const sweepEvery = 1000
+
+// MemoryStore keeps limiter state in memory. Its counters aren't shared between
+// instances of the application, so it's only suitable when running one.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	updates int
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	m.updates++
+	if m.updates%sweepEvery == 0 {
+		for k, e := range m.entries {
+			if !now.Before(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+
+	var state State
+	if e, ok := m.entries[key]; ok && now.Before(e.expires) {
+		state = e.state
+	}
+
+	if err := fn(&state); err != nil {
+		return err
+	}
+
+	m.entries[key] = memoryEntry{state: state, expires: now.Add(ttl)}
+	return nil
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore keeps limiter state in the rate_limits table, so every instance of
+// the application shares the same counters. Each update locks the key's row with
+// SELECT ... FOR UPDATE, so concurrent requests for a key are counted one at a time.
+type PostgresStore struct {
+	db      *sqlx.DB
+	updates uint64
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (p *PostgresStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State) error) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if atomic.AddUint64(&p.updates, 1)%sweepEvery == 0 {
+		_, err := p.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE expires_at <= NOW()`)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Make sure the row exists so there is always something to lock. A new row
+	// is created already expired, so it's read as the zero State.
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO rate_limits (key, value, prev, stamp, expires_at)
+	VALUES ($1, 0, 0, NOW(), NOW())
+	ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return err
+	}
+
+	var state State
+	var expires time.Time
+	err = tx.QueryRowContext(ctx, `
+	SELECT value, prev, stamp, expires_at
+	FROM rate_limits
+	WHERE key = $1
+	FOR UPDATE`, key).Scan(&state.Value, &state.Prev, &state.Timestamp, &expires)
+	if err != nil {
+		return err
+	}
+
+	if !time.Now().Before(expires) {
+		state = State{}
+	}
+
+	if err := fn(&state); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE rate_limits
+	SET value = $1, prev = $2, stamp = $3, expires_at = $4
+	WHERE key = $5`, state.Value, state.Prev, state.Timestamp, time.Now().Add(ttl), key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+// Package ratelimit limits how often something may happen per key, such as
+// requests per client IP address or password reset emails per address.
+//
+// Two algorithms are available. A TokenBucket allows short bursts of up to the
+// full limit, refilling steadily over the period. A SlidingWindow counts events in
+// fixed windows, weighting the previous window's count by how much of it still
+// overlaps the sliding window, which smooths out the burst a fixed window allows
+// at its boundary.
+//
+// Limiter state lives in a Store. MemoryStore is enough for a single instance,
+// while PostgresStore lets every replica share the same counters.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a number of events allowed per period.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRate parses a rate in the form "<limit>/<period>", e.g. "5/1m" or "3/1h".
+// An empty string or "0" returns the zero Rate, which disables limiting.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("rate %q must be in the form <limit>/<period>", s)
+	}
+
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return Rate{}, fmt.Errorf("invalid rate limit %q", parts[0])
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate period %q", parts[1])
+	}
+
+	return Rate{Limit: limit, Period: period}, nil
+}
+
+// Disabled reports whether the rate doesn't limit anything.
+func (r Rate) Disabled() bool {
+	return r.Limit == 0 || r.Period == 0
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+// Result is the outcome of checking a key against a limiter.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the limit fully resets.
+	Reset time.Duration
+	// RetryAfter is how long until the next event would be allowed. It is 0 when
+	// Allowed is true.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether an event for a key is allowed, and counts it if so.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// State is what limiters persist per key. Its meaning depends on the algorithm.
+type State struct {
+	Value     float64
+	Prev      float64
+	Timestamp time.Time
+}
+
+// ErrInvalidRate is returned when creating a limiter for a disabled rate.
+var ErrInvalidRate = errors.New("rate limit must have a positive limit and period")
+
+// Store persists limiter state.
+type Store interface {
+	// Update atomically loads the state of key, passes it to fn to modify, and
+	// saves it to expire after ttl. A key that doesn't exist or has expired is
+	// passed to fn as the zero State.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State) error) error
+}
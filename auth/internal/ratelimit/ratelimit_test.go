@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore(clock *fakeClock) *MemoryStore {
+	store := NewMemoryStore()
+	store.now = clock.Now
+	return store
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("5/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Limit != 5 || rate.Period != time.Minute {
+		t.Errorf("want 5/1m; got %s", rate)
+	}
+
+	for _, s := range []string{"", "0"} {
+		rate, err := ParseRate(s)
+		if err != nil || !rate.Disabled() {
+			t.Errorf("ParseRate(%q) want a disabled rate; got %s, %v", s, rate, err)
+		}
+	}
+
+	for _, s := range []string{"5", "x/1m", "5/x", "5/-1m"} {
+		if _, err := ParseRate(s); err == nil {
+			t.Errorf("ParseRate(%q) expected an error", s)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)}
+	bucket, err := NewTokenBucket(newTestStore(clock), Rate{Limit: 3, Period: 3 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket.now = clock.Now
+	ctx := context.Background()
+
+	// The full limit can be used in a burst
+	for i := 2; i >= 0; i-- {
+		res, err := bucket.Allow(ctx, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("want allowed with %d remaining; got %+v", i, res)
+		}
+	}
+
+	res, _ := bucket.Allow(ctx, "key")
+	if res.Allowed {
+		t.Fatalf("expected request over the limit to be denied")
+	}
+	if res.RetryAfter != time.Minute {
+		t.Errorf("want retry after %s; got %s", time.Minute, res.RetryAfter)
+	}
+
+	// Other keys have their own bucket
+	if res, _ := bucket.Allow(ctx, "other"); !res.Allowed {
+		t.Errorf("expected a different key to be allowed")
+	}
+
+	// One token is refilled every minute
+	clock.Advance(time.Minute)
+	if res, _ := bucket.Allow(ctx, "key"); !res.Allowed {
+		t.Errorf("expected a request to be allowed after a token was refilled")
+	}
+	if res, _ := bucket.Allow(ctx, "key"); res.Allowed {
+		t.Errorf("expected only one token to have been refilled")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)}
+	window, err := NewSlidingWindow(newTestStore(clock), Rate{Limit: 4, Period: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	window.now = clock.Now
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if res, _ := window.Allow(ctx, "key"); !res.Allowed {
+			t.Fatalf("request %d: expected to be allowed", i+1)
+		}
+	}
+
+	res, _ := window.Allow(ctx, "key")
+	if res.Allowed {
+		t.Fatalf("expected request over the limit to be denied")
+	}
+	if res.Remaining != 0 {
+		t.Errorf("want 0 remaining; got %d", res.Remaining)
+	}
+	// At the start of the next window all 4 events still count, and a quarter of
+	// the next window has to pass for the weighted count to drop to 3.
+	if want := time.Hour + 15*time.Minute; res.RetryAfter != want {
+		t.Errorf("want retry after %s; got %s", want, res.RetryAfter)
+	}
+
+	// Halfway through the next window, half the previous window's events count
+	clock.Advance(time.Hour + 30*time.Minute)
+	for i := 0; i < 2; i++ {
+		if res, _ := window.Allow(ctx, "key"); !res.Allowed {
+			t.Fatalf("request %d in the next window: expected to be allowed", i+1)
+		}
+	}
+	if res, _ := window.Allow(ctx, "key"); res.Allowed {
+		t.Errorf("expected weighted count of the previous window to still limit requests")
+	}
+
+	// After two full windows nothing counts anymore
+	clock.Advance(2 * time.Hour)
+	res, _ = window.Allow(ctx, "key")
+	if !res.Allowed || res.Remaining != 3 {
+		t.Errorf("want allowed with 3 remaining; got %+v", res)
+	}
+}
+
+func TestNewLimiterDisabledRate(t *testing.T) {
+	if _, err := NewTokenBucket(NewMemoryStore(), Rate{}); err != ErrInvalidRate {
+		t.Errorf("want: %v; got %v", ErrInvalidRate, err)
+	}
+	if _, err := NewSlidingWindow(NewMemoryStore(), Rate{}); err != ErrInvalidRate {
+		t.Errorf("want: %v; got %v", ErrInvalidRate, err)
+	}
+}
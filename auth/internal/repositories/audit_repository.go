@@ -0,0 +1,363 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+type AuditRepositoryInterface interface {
+	// Insert appends an event to the audit log, setting its id, time and hashes.
+	Insert(event *domain.AuditEvent) error
+	// List returns a page of the events matching the filter, newest first, and
+	// the cursor of the next page, which is nil on the last page.
+	List(filter AuditFilter) ([]*domain.AuditEvent, *Cursor, error)
+	// Latest returns the last event of the audit log.
+	Latest() (*domain.AuditEvent, error)
+	// ListChain returns up to limit events with an id greater than afterID, in
+	// the order they were recorded.
+	ListChain(afterID int64, limit int) ([]*domain.AuditEvent, error)
+	InsertCheckpoint(checkpoint *domain.AuditCheckpoint) error
+	// LatestCheckpoint returns the last checkpoint made.
+	LatestCheckpoint() (*domain.AuditCheckpoint, error)
+	// ListCheckpoints returns every checkpoint, oldest first.
+	ListCheckpoints() ([]*domain.AuditCheckpoint, error)
+}
+
+// AuditFilter filters and pages the events returned by List. Zero values don't
+// filter.
+type AuditFilter struct {
+	ActorID  string
+	TargetID string
+	// UserID matches the events the user either did or was the target of.
+	UserID string
+	Action string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	// After is the cursor of the page to return, nil for the first page
+	After *Cursor
+}
+
+type AuditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+// Insert appends an event to the audit log, setting its id, time and hashes.
+// Each event's hash covers the hash of the event before it, so events are
+// inserted one at a time, in id order, while holding a lock on the table.
+func (r *AuditRepository) Insert(event *domain.AuditEvent) error {
+	if event.Metadata == nil {
+		event.Metadata = map[string]interface{}{}
+	}
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// EXCLUSIVE still lets the log be read while an event is inserted
+	_, err = tx.ExecContext(ctx, `LOCK TABLE audit_events IN EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+
+	var prevHash []byte
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('audit_events', 'id'))`).Scan(&event.ID)
+	if err != nil {
+		return err
+	}
+	// Postgres keeps microseconds, and the time has to hash the same once read back
+	event.OccurredAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	event.PrevHash = prevHash
+	event.Hash, err = event.ChainHash(prevHash)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO audit_events (id, occurred_at, action, actor_id, actor_email, target_type, target_id, ip,
+		user_agent, request_id, metadata, prev_hash, hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+
+	args := []interface{}{
+		event.ID,
+		event.OccurredAt,
+		event.Action,
+		event.ActorID,
+		event.ActorEmail,
+		event.TargetType,
+		event.TargetID,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		metadata,
+		event.PrevHash,
+		event.Hash,
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// List returns a page of the events matching the filter, newest first, and the
+// cursor of the next page, which is nil on the last page.
+func (r *AuditRepository) List(filter AuditFilter) ([]*domain.AuditEvent, *Cursor, error) {
+	where, args := filter.where()
+
+	if filter.After != nil {
+		id, err := strconv.ParseInt(filter.After.ID, 10, 64)
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		args = append(args, id)
+		where += fmt.Sprintf(" AND id < $%d", len(args))
+	}
+
+	// Fetch one more than the limit to know if there is a next page
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM audit_events
+	WHERE %s
+	ORDER BY id DESC
+	LIMIT $%d`, auditEventColumns, where, len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanAuditEvents(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(events) <= filter.Limit {
+		return events, nil, nil
+	}
+
+	events = events[:filter.Limit]
+	next := &Cursor{ID: strconv.FormatInt(events[len(events)-1].ID, 10)}
+	return events, next, nil
+}
+
+// Latest returns the last event of the audit log.
+func (r *AuditRepository) Latest() (*domain.AuditEvent, error) {
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM audit_events
+	ORDER BY id DESC
+	LIMIT 1`, auditEventColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanAuditEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return events[0], nil
+}
+
+// ListChain returns up to limit events with an id greater than afterID, in the
+// order they were recorded.
+func (r *AuditRepository) ListChain(afterID int64, limit int) ([]*domain.AuditEvent, error) {
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM audit_events
+	WHERE id > $1
+	ORDER BY id
+	LIMIT $2`, auditEventColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAuditEvents(rows)
+}
+
+const auditEventColumns = `id, occurred_at, action, actor_id, actor_email, target_type, target_id, ip,
+	user_agent, request_id, metadata, prev_hash, hash`
+
+func scanAuditEvents(rows *sql.Rows) ([]*domain.AuditEvent, error) {
+	events := []*domain.AuditEvent{}
+	for rows.Next() {
+		var e domain.AuditEvent
+		var metadata []byte
+		err := rows.Scan(&e.ID, &e.OccurredAt, &e.Action, &e.ActorID, &e.ActorEmail, &e.TargetType,
+			&e.TargetID, &e.IP, &e.UserAgent, &e.RequestID, &metadata, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *AuditRepository) InsertCheckpoint(checkpoint *domain.AuditCheckpoint) error {
+	query := `
+	INSERT INTO audit_checkpoints (created_at, event_id, event_hash, key_id, signature)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id`
+
+	args := []interface{}{
+		checkpoint.CreatedAt,
+		checkpoint.EventID,
+		checkpoint.EventHash,
+		checkpoint.KeyID,
+		checkpoint.Signature,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&checkpoint.ID)
+}
+
+// LatestCheckpoint returns the last checkpoint made.
+func (r *AuditRepository) LatestCheckpoint() (*domain.AuditCheckpoint, error) {
+	query := `
+	SELECT id, created_at, event_id, event_hash, key_id, signature
+	FROM audit_checkpoints
+	ORDER BY id DESC
+	LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c domain.AuditCheckpoint
+	err := r.db.QueryRowContext(ctx, query).Scan(&c.ID, &c.CreatedAt, &c.EventID, &c.EventHash, &c.KeyID, &c.Signature)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// ListCheckpoints returns every checkpoint, oldest first.
+func (r *AuditRepository) ListCheckpoints() ([]*domain.AuditCheckpoint, error) {
+	query := `
+	SELECT id, created_at, event_id, event_hash, key_id, signature
+	FROM audit_checkpoints
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []*domain.AuditCheckpoint{}
+	for rows.Next() {
+		var c domain.AuditCheckpoint
+		err := rows.Scan(&c.ID, &c.CreatedAt, &c.EventID, &c.EventHash, &c.KeyID, &c.Signature)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// where returns the conditions of the filter, not including its cursor, and
+// their arguments.
+func (f AuditFilter) where() (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	if f.ActorID != "" {
+		args = append(args, f.ActorID)
+		conditions = append(conditions, fmt.Sprintf("actor_id = $%d", len(args)))
+	}
+	if f.TargetID != "" {
+		args = append(args, f.TargetID)
+		conditions = append(conditions, fmt.Sprintf("target_id = $%d", len(args)))
+	}
+	if f.UserID != "" {
+		args = append(args, f.UserID)
+		conditions = append(conditions, fmt.Sprintf("(actor_id = $%d OR target_id = $%d)", len(args), len(args)))
+	}
+	if f.Action != "" {
+		args = append(args, f.Action)
+		conditions = append(conditions, fmt.Sprintf("action = $%d", len(args)))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		conditions = append(conditions, fmt.Sprintf("occurred_at >= $%d", len(args)))
+	}
+	if !f.Until.IsZero() {
+		args = append(args, f.Until)
+		conditions = append(conditions, fmt.Sprintf("occurred_at < $%d", len(args)))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
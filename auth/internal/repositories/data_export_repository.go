@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+type DataExportRepositoryInterface interface {
+	// Insert stores a generated export archive
+	Insert(export *domain.DataExport) error
+	// GetLatestForUser returns the most recent export for a user that has not expired
+	GetLatestForUser(userId string) (*domain.DataExport, error)
+	// DeleteAllForUser deletes every stored export for a user
+	DeleteAllForUser(userId string) error
+}
+
+type DataExportRepository struct {
+	db *sqlx.DB
+}
+
+func NewDataExportRepository(db *sqlx.DB) *DataExportRepository {
+	return &DataExportRepository{
+		db: db,
+	}
+}
+
+// Insert stores a generated export archive
+func (r *DataExportRepository) Insert(export *domain.DataExport) error {
+	query := `
+	INSERT INTO data_exports (id, user_id, expiry, archive)
+	VALUES ($1, $2, $3, $4)
+	RETURNING created_at`
+
+	args := []interface{}{export.ID, export.UserID, export.Expiry, export.Archive}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&export.CreatedAt)
+}
+
+// GetLatestForUser returns the most recent export for a user that has not expired.
+// If there is none, ErrRecordNotFound is returned.
+func (r *DataExportRepository) GetLatestForUser(userId string) (*domain.DataExport, error) {
+	query := `
+	SELECT id, user_id, created_at, expiry, archive
+	FROM data_exports
+	WHERE user_id = $1
+	AND expiry > $2
+	ORDER BY created_at DESC
+	LIMIT 1`
+
+	var export domain.DataExport
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, userId, time.Now()).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.CreatedAt,
+		&export.Expiry,
+		&export.Archive,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// DeleteAllForUser deletes every stored export for a user
+func (r *DataExportRepository) DeleteAllForUser(userId string) error {
+	query := `DELETE FROM data_exports WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, userId)
+	return err
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+type DeviceRepositoryInterface interface {
+	// Touch records that the user signed in from the device, and reports whether
+	// it is the first time they have.
+	Touch(device *domain.Device) (bool, error)
+	// GetAllForUser returns the devices the user has signed in from, most
+	// recently used first.
+	GetAllForUser(userId string) ([]*domain.Device, error)
+}
+
+type DeviceRepository struct {
+	db *sqlx.DB
+}
+
+func NewDeviceRepository(db *sqlx.DB) *DeviceRepository {
+	return &DeviceRepository{
+		db: db,
+	}
+}
+
+// Touch records that the user signed in from the device, and reports whether it
+// is the first time they have.
+func (r *DeviceRepository) Touch(device *domain.Device) (bool, error) {
+	// xmax is only zero for a row that was inserted rather than updated
+	query := `
+	INSERT INTO user_devices (user_id, fingerprint, browser, os, network, ip)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id, fingerprint) DO UPDATE
+	SET ip = EXCLUDED.ip, last_seen_at = NOW()
+	RETURNING id, first_seen_at, last_seen_at, xmax = 0`
+
+	args := []interface{}{
+		device.UserID,
+		device.Fingerprint,
+		device.Browser,
+		device.OS,
+		device.Network,
+		device.IP,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var inserted bool
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&device.ID, &device.FirstSeenAt, &device.LastSeenAt, &inserted)
+	return inserted, err
+}
+
+// GetAllForUser returns the devices the user has signed in from, most recently
+// used first.
+func (r *DeviceRepository) GetAllForUser(userId string) ([]*domain.Device, error) {
+	query := `
+	SELECT id, user_id, fingerprint, browser, os, network, ip, first_seen_at, last_seen_at
+	FROM user_devices
+	WHERE user_id = $1
+	ORDER BY last_seen_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []*domain.Device{}
+	for rows.Next() {
+		var d domain.Device
+		err := rows.Scan(&d.ID, &d.UserID, &d.Fingerprint, &d.Browser, &d.OS, &d.Network, &d.IP, &d.FirstSeenAt, &d.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, &d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
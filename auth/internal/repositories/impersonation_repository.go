@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+type ImpersonationRepositoryInterface interface {
+	// Start records the start of an impersonation session, setting its id.
+	Start(session *domain.ImpersonationSession) error
+	// End records that an impersonation session was stopped. Ending a session
+	// that has already ended does nothing.
+	End(id int64) error
+	// Get returns the impersonation session with the id.
+	Get(id int64) (*domain.ImpersonationSession, error)
+	// GetRecent returns the latest impersonation sessions, newest first.
+	GetRecent(limit int) ([]*domain.ImpersonationSession, error)
+	// GetAllForUser returns the impersonation sessions the user either started
+	// or was the target of, newest first.
+	GetAllForUser(userId string) ([]*domain.ImpersonationSession, error)
+}
+
+type ImpersonationRepository struct {
+	db *sqlx.DB
+}
+
+func NewImpersonationRepository(db *sqlx.DB) *ImpersonationRepository {
+	return &ImpersonationRepository{
+		db: db,
+	}
+}
+
+// Start records the start of an impersonation session, setting its id.
+func (r *ImpersonationRepository) Start(session *domain.ImpersonationSession) error {
+	query := `
+	INSERT INTO impersonation_sessions (actor_id, actor_email, target_id, target_email, reason, ip, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, started_at`
+
+	args := []interface{}{
+		session.ActorID,
+		session.ActorEmail,
+		session.TargetID,
+		session.TargetEmail,
+		session.Reason,
+		session.IP,
+		session.ExpiresAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.StartedAt)
+}
+
+// End records that an impersonation session was stopped. Ending a session that
+// has already ended does nothing.
+func (r *ImpersonationRepository) End(id int64) error {
+	query := `
+	UPDATE impersonation_sessions
+	SET ended_at = LEAST(NOW(), expires_at)
+	WHERE id = $1 AND ended_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Get returns the impersonation session with the id.
+func (r *ImpersonationRepository) Get(id int64) (*domain.ImpersonationSession, error) {
+	query := `
+	SELECT id, COALESCE(actor_id, ''), actor_email, COALESCE(target_id, ''), target_email,
+		reason, ip, started_at, expires_at, ended_at
+	FROM impersonation_sessions
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s domain.ImpersonationSession
+	var endedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&s.ID, &s.ActorID, &s.ActorEmail, &s.TargetID,
+		&s.TargetEmail, &s.Reason, &s.IP, &s.StartedAt, &s.ExpiresAt, &endedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if endedAt.Valid {
+		s.EndedAt = &endedAt.Time
+	}
+
+	return &s, nil
+}
+
+// GetRecent returns the latest impersonation sessions, newest first.
+func (r *ImpersonationRepository) GetRecent(limit int) ([]*domain.ImpersonationSession, error) {
+	query := `
+	SELECT id, COALESCE(actor_id, ''), actor_email, COALESCE(target_id, ''), target_email,
+		reason, ip, started_at, expires_at, ended_at
+	FROM impersonation_sessions
+	ORDER BY started_at DESC, id DESC
+	LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanImpersonationSessions(rows)
+}
+
+// GetAllForUser returns the impersonation sessions the user either started or
+// was the target of, newest first.
+func (r *ImpersonationRepository) GetAllForUser(userId string) ([]*domain.ImpersonationSession, error) {
+	query := `
+	SELECT id, COALESCE(actor_id, ''), actor_email, COALESCE(target_id, ''), target_email,
+		reason, ip, started_at, expires_at, ended_at
+	FROM impersonation_sessions
+	WHERE actor_id = $1 OR target_id = $1
+	ORDER BY started_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanImpersonationSessions(rows)
+}
+
+func scanImpersonationSessions(rows *sql.Rows) ([]*domain.ImpersonationSession, error) {
+	sessions := []*domain.ImpersonationSession{}
+	for rows.Next() {
+		var s domain.ImpersonationSession
+		var endedAt sql.NullTime
+		err := rows.Scan(&s.ID, &s.ActorID, &s.ActorEmail, &s.TargetID, &s.TargetEmail,
+			&s.Reason, &s.IP, &s.StartedAt, &s.ExpiresAt, &endedAt)
+		if err != nil {
+			return nil, err
+		}
+		if endedAt.Valid {
+			s.EndedAt = &endedAt.Time
+		}
+		sessions = append(sessions, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
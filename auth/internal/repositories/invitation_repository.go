@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+type InvitationRepositoryInterface interface {
+	// Insert adds an invitation, replacing any earlier invitation of the same
+	// email address to the organization along with its token.
+	Insert(tenant Tenant, inv *domain.Invitation) error
+	// GetAllPending returns the organization's invitations that haven't expired.
+	GetAllPending(tenant Tenant) ([]*domain.Invitation, error)
+	Delete(tenant Tenant, id int64) error
+	// GetForToken returns the unexpired invitation of an invitation token.
+	GetForToken(tokenPlaintext string) (*domain.Invitation, error)
+	// Accept makes the user a member of the invitation's organization and
+	// deletes the invitation. If the user is already a member their role is kept.
+	Accept(inv *domain.Invitation, userId string) error
+}
+
+type InvitationRepository struct {
+	db *sqlx.DB
+}
+
+func NewInvitationRepository(db *sqlx.DB) *InvitationRepository {
+	return &InvitationRepository{
+		db: db,
+	}
+}
+
+const invitationSelect = `
+	SELECT invitations.id, invitations.organization_id, organizations.name,
+		invitations.email, invitations.role, COALESCE(invitations.invited_by, ''),
+		invitations.created_at, invitations.expiry
+	FROM invitations
+	INNER JOIN organizations ON organizations.id = invitations.organization_id`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*domain.Invitation, error) {
+	var inv domain.Invitation
+	err := row.Scan(&inv.ID, &inv.OrganizationID, &inv.OrganizationName, &inv.Email, &inv.Role,
+		&inv.InvitedBy, &inv.CreatedAt, &inv.Expiry)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Insert adds an invitation, replacing any earlier invitation of the same email
+// address to the organization along with its token.
+func (r *InvitationRepository) Insert(tenant Tenant, inv *domain.Invitation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, args := tenant.scope(`DELETE FROM invitations WHERE email = $1`, "organization_id", inv.Email)
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO invitations (organization_id, email, role, invited_by, expiry)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	invitedBy := sql.NullString{String: inv.InvitedBy, Valid: inv.InvitedBy != ""}
+	err = tx.QueryRowContext(ctx, query, tenant.OrgID(), inv.Email, inv.Role, invitedBy, inv.Expiry).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAllPending returns the organization's invitations that haven't expired.
+func (r *InvitationRepository) GetAllPending(tenant Tenant) ([]*domain.Invitation, error) {
+	query, args := tenant.scope(invitationSelect+` WHERE invitations.expiry > $1`, "invitations.organization_id", time.Now())
+	query += ` ORDER BY invitations.created_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*domain.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// Delete revokes an invitation. Its token is deleted along with it.
+func (r *InvitationRepository) Delete(tenant Tenant, id int64) error {
+	query, args := tenant.scope(`DELETE FROM invitations WHERE id = $1`, "organization_id", id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// GetForToken returns the unexpired invitation of an invitation token.
+func (r *InvitationRepository) GetForToken(tokenPlaintext string) (*domain.Invitation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := invitationSelect + `
+	INNER JOIN tokens ON tokens.invitation_id = invitations.id
+	WHERE tokens.hash = $1
+	AND tokens.scope = $2
+	AND tokens.expiry > $3
+	AND invitations.expiry > $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	inv, err := scanInvitation(r.db.QueryRowContext(ctx, query, tokenHash[:], domain.TokenScopeInvitation, time.Now()))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+// Accept makes the user a member of the invitation's organization and deletes
+// the invitation. If the user is already a member their role is kept.
+func (r *InvitationRepository) Accept(inv *domain.Invitation, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Deleting the invitation first means it can only be accepted once, even if
+	// its token is used twice at the same time.
+	result, err := tx.ExecContext(ctx, `DELETE FROM invitations WHERE id = $1`, inv.ID)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO memberships (organization_id, user_id, role)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, inv.OrganizationID, userId, inv.Role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
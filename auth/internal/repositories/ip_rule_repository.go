@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+type IPRuleRepositoryInterface interface {
+	// GetAll returns the rules of the whole service and of every organization.
+	GetAll() ([]*domain.IPRule, error)
+	// ListGlobal and List return the rules of the whole service, and of the
+	// tenant's organization, oldest first.
+	ListGlobal() ([]*domain.IPRule, error)
+	List(tenant Tenant) ([]*domain.IPRule, error)
+	// Insert adds the rule to the whole service, or to its organization if it
+	// has one.
+	Insert(rule *domain.IPRule) error
+	DeleteGlobal(id int64) error
+	Delete(tenant Tenant, id int64) error
+}
+
+type IPRuleRepository struct {
+	db *sqlx.DB
+}
+
+func NewIPRuleRepository(db *sqlx.DB) *IPRuleRepository {
+	return &IPRuleRepository{
+		db: db,
+	}
+}
+
+const ipRuleSelect = `
+	SELECT id, COALESCE(organization_id, ''), cidr::text, action, description,
+		COALESCE(created_by, ''), created_at
+	FROM ip_rules`
+
+// GetAll returns the rules of the whole service and of every organization.
+func (r *IPRuleRepository) GetAll() ([]*domain.IPRule, error) {
+	return r.query(ipRuleSelect + ` ORDER BY id`)
+}
+
+func (r *IPRuleRepository) ListGlobal() ([]*domain.IPRule, error) {
+	return r.query(ipRuleSelect + ` WHERE organization_id IS NULL ORDER BY id`)
+}
+
+func (r *IPRuleRepository) List(tenant Tenant) ([]*domain.IPRule, error) {
+	query, args := tenant.scope(ipRuleSelect+` WHERE TRUE`, "organization_id")
+	return r.query(query+` ORDER BY id`, args...)
+}
+
+func (r *IPRuleRepository) query(query string, args ...interface{}) ([]*domain.IPRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*domain.IPRule{}
+	for rows.Next() {
+		var rule domain.IPRule
+		err := rows.Scan(&rule.ID, &rule.OrganizationID, &rule.CIDR, &rule.Action, &rule.Description,
+			&rule.CreatedBy, &rule.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Insert adds the rule to the whole service, or to its organization if it has
+// one. ErrRecordNotFound is returned if the organization doesn't exist.
+func (r *IPRuleRepository) Insert(rule *domain.IPRule) error {
+	query := `
+	INSERT INTO ip_rules (organization_id, cidr, action, description, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	args := []interface{}{
+		sql.NullString{String: rule.OrganizationID, Valid: rule.OrganizationID != ""},
+		rule.CIDR,
+		rule.Action,
+		rule.Description,
+		sql.NullString{String: rule.CreatedBy, Valid: rule.CreatedBy != ""},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&rule.ID, &rule.CreatedAt)
+	if err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *IPRuleRepository) DeleteGlobal(id int64) error {
+	return r.exec(`DELETE FROM ip_rules WHERE id = $1 AND organization_id IS NULL`, id)
+}
+
+func (r *IPRuleRepository) Delete(tenant Tenant, id int64) error {
+	query, args := tenant.scope(`DELETE FROM ip_rules WHERE id = $1`, "organization_id", id)
+	return r.exec(query, args...)
+}
+
+func (r *IPRuleRepository) exec(query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
@@ -0,0 +1,150 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// LoginAttemptRepositoryInterface keeps track of failed sign in attempts, both per
+// account (on the users table) and per client IP address.
+type LoginAttemptRepositoryInterface interface {
+	// RecordUserFailure counts a failed sign in for the user and returns the number
+	// of failures in a row. Failures older than window are forgotten.
+	RecordUserFailure(userId string, window time.Duration) (int, error)
+	// LockUser prevents the user from signing in until the given time.
+	LockUser(userId string, until time.Time) error
+	// ResetUser clears the user's failure count and lock.
+	ResetUser(userId string) error
+	// RecordIPFailure counts a failed sign in from the IP address and returns the
+	// number of failures in a row. Failures older than window are forgotten.
+	RecordIPFailure(ip string, window time.Duration) (int, error)
+	// LockIP prevents any sign in from the IP address until the given time.
+	LockIP(ip string, until time.Time) error
+	// IPLockedUntil returns the time the IP address is locked until. It is the zero
+	// time if the address isn't locked.
+	IPLockedUntil(ip string) (time.Time, error)
+}
+
+type LoginAttemptRepository struct {
+	db *sqlx.DB
+}
+
+func NewLoginAttemptRepository(db *sqlx.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{
+		db: db,
+	}
+}
+
+// RecordUserFailure counts a failed sign in for the user and returns the number
+// of failures in a row. Failures older than window are forgotten.
+func (r *LoginAttemptRepository) RecordUserFailure(userId string, window time.Duration) (int, error) {
+	query := `
+	UPDATE users
+	SET failed_login_attempts = CASE
+			WHEN last_failed_login_at > $2 THEN failed_login_attempts + 1
+			ELSE 1
+		END,
+		last_failed_login_at = NOW()
+	WHERE id = $1
+	RETURNING failed_login_attempts`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, query, userId, time.Now().Add(-window)).Scan(&failures)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return failures, nil
+}
+
+// LockUser prevents the user from signing in until the given time.
+func (r *LoginAttemptRepository) LockUser(userId string, until time.Time) error {
+	query := `UPDATE users SET locked_until = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, until, userId)
+	return err
+}
+
+// ResetUser clears the user's failure count and lock.
+func (r *LoginAttemptRepository) ResetUser(userId string) error {
+	query := `
+	UPDATE users
+	SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, userId)
+	return err
+}
+
+// RecordIPFailure counts a failed sign in from the IP address and returns the
+// number of failures in a row. Failures older than window are forgotten.
+func (r *LoginAttemptRepository) RecordIPFailure(ip string, window time.Duration) (int, error) {
+	query := `
+	INSERT INTO ip_login_failures (ip, failures, last_failed_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (ip) DO UPDATE
+	SET failures = CASE
+			WHEN ip_login_failures.last_failed_at > $2 THEN ip_login_failures.failures + 1
+			ELSE 1
+		END,
+		last_failed_at = NOW()
+	RETURNING failures`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, query, ip, time.Now().Add(-window)).Scan(&failures)
+	return failures, err
+}
+
+// LockIP prevents any sign in from the IP address until the given time.
+func (r *LoginAttemptRepository) LockIP(ip string, until time.Time) error {
+	query := `UPDATE ip_login_failures SET locked_until = $1 WHERE ip = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, until, ip)
+	return err
+}
+
+// IPLockedUntil returns the time the IP address is locked until. It is the zero
+// time if the address isn't locked.
+func (r *LoginAttemptRepository) IPLockedUntil(ip string) (time.Time, error) {
+	query := `SELECT locked_until FROM ip_login_failures WHERE ip = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, ip).Scan(&lockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, nil
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return lockedUntil.Time, nil
+}
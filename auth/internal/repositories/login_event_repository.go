@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+type LoginEventRepositoryInterface interface {
+	Insert(event *domain.LoginEvent) error
+	// ListForUser returns a page of the user's sign in attempts, newest first,
+	// and the cursor of the next page, which is nil on the last page.
+	ListForUser(userId string, limit int, after *Cursor) ([]*domain.LoginEvent, *Cursor, error)
+	// ListRecentSucceeded returns the user's last successful sign ins, newest first.
+	ListRecentSucceeded(userId string, limit int) ([]*domain.LoginEvent, error)
+}
+
+const loginEventColumns = `id, user_id, email, succeeded, failure_reason, ip, user_agent, browser, os,
+	city, country, country_code, latitude, longitude, occurred_at`
+
+type LoginEventRepository struct {
+	db *sqlx.DB
+}
+
+func NewLoginEventRepository(db *sqlx.DB) *LoginEventRepository {
+	return &LoginEventRepository{
+		db: db,
+	}
+}
+
+func (r *LoginEventRepository) Insert(event *domain.LoginEvent) error {
+	query := `
+	INSERT INTO login_events (user_id, email, succeeded, failure_reason, ip, user_agent, browser, os,
+		city, country, country_code, latitude, longitude)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	RETURNING id, occurred_at`
+
+	userId := sql.NullString{String: event.UserID, Valid: event.UserID != ""}
+	var location domain.GeoLocation
+	var latitude, longitude sql.NullFloat64
+	if event.Location != nil {
+		location = *event.Location
+		latitude = sql.NullFloat64{Float64: location.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: location.Longitude, Valid: true}
+	}
+
+	args := []interface{}{
+		userId,
+		event.Email,
+		event.Succeeded,
+		event.FailureReason,
+		event.IP,
+		event.UserAgent,
+		event.Browser,
+		event.OS,
+		location.City,
+		location.Country,
+		location.CountryCode,
+		latitude,
+		longitude,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.OccurredAt)
+}
+
+// ListForUser returns a page of the user's sign in attempts, newest first, and
+// the cursor of the next page, which is nil on the last page.
+func (r *LoginEventRepository) ListForUser(userId string, limit int, after *Cursor) ([]*domain.LoginEvent, *Cursor, error) {
+	args := []interface{}{userId}
+	where := "user_id = $1"
+
+	if after != nil {
+		id, err := strconv.ParseInt(after.ID, 10, 64)
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		args = append(args, id)
+		where += fmt.Sprintf(" AND id < $%d", len(args))
+	}
+
+	// Fetch one more than the limit to know if there is a next page
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM login_events
+	WHERE %s
+	ORDER BY id DESC
+	LIMIT $%d`, loginEventColumns, where, len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanLoginEvents(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(events) <= limit {
+		return events, nil, nil
+	}
+
+	events = events[:limit]
+	next := &Cursor{ID: strconv.FormatInt(events[len(events)-1].ID, 10)}
+	return events, next, nil
+}
+
+// ListRecentSucceeded returns the user's last successful sign ins, newest first.
+func (r *LoginEventRepository) ListRecentSucceeded(userId string, limit int) ([]*domain.LoginEvent, error) {
+	query := `
+	SELECT ` + loginEventColumns + `
+	FROM login_events
+	WHERE user_id = $1 AND succeeded
+	ORDER BY id DESC
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanLoginEvents(rows)
+}
+
+func scanLoginEvents(rows *sql.Rows) ([]*domain.LoginEvent, error) {
+	events := []*domain.LoginEvent{}
+	for rows.Next() {
+		var e domain.LoginEvent
+		var location domain.GeoLocation
+		var latitude, longitude sql.NullFloat64
+		err := rows.Scan(&e.ID, &e.UserID, &e.Email, &e.Succeeded, &e.FailureReason, &e.IP, &e.UserAgent,
+			&e.Browser, &e.OS, &location.City, &location.Country, &location.CountryCode, &latitude, &longitude,
+			&e.OccurredAt)
+		if err != nil {
+			return nil, err
+		}
+		location.Latitude, location.Longitude = latitude.Float64, longitude.Float64
+		if latitude.Valid || location.Country != "" || location.City != "" {
+			e.Location = &location
+		}
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,269 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/domain"
+)
+
+var (
+	ErrDuplicateSlug       = errors.New("an organization with this slug already exists")
+	ErrDuplicateMembership = errors.New("the user is already a member of this organization")
+	ErrLastOwner           = errors.New("an organization must have at least one owner")
+)
+
+type OrganizationRepositoryInterface interface {
+	// Create inserts the organization and makes the user its owner.
+	Create(org *domain.Organization, ownerId string) error
+	Get(tenant Tenant) (*domain.Organization, error)
+	// GetForUser returns every organization the user is a member of, with their
+	// role in it, oldest membership first.
+	GetForUser(userId string) ([]*domain.Organization, error)
+
+	ListMembers(tenant Tenant) ([]*domain.Membership, error)
+	GetMember(tenant Tenant, userId string) (*domain.Membership, error)
+	// UpdateMemberRole and RemoveMember return ErrLastOwner rather than leave
+	// the organization without an owner.
+	UpdateMemberRole(tenant Tenant, userId, role string) error
+	RemoveMember(tenant Tenant, userId string) error
+}
+
+type OrganizationRepository struct {
+	db *sqlx.DB
+}
+
+func NewOrganizationRepository(db *sqlx.DB) *OrganizationRepository {
+	return &OrganizationRepository{
+		db: db,
+	}
+}
+
+const membershipSelect = `
+	SELECT memberships.organization_id, memberships.user_id, users.email,
+		users.first_name, users.last_name, memberships.role, memberships.created_at
+	FROM memberships
+	INNER JOIN users ON users.id = memberships.user_id`
+
+func scanMembership(row interface{ Scan(...interface{}) error }) (*domain.Membership, error) {
+	var m domain.Membership
+	err := row.Scan(&m.OrganizationID, &m.UserID, &m.Email, &m.FirstName, &m.LastName, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Create inserts the organization and makes the user its owner.
+func (r *OrganizationRepository) Create(org *domain.Organization, ownerId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO organizations (id, name, slug)
+	VALUES ($1, $2, $3)
+	RETURNING created_at`
+
+	err = tx.QueryRowContext(ctx, query, org.ID, org.Name, org.Slug).Scan(&org.CreatedAt)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO memberships (organization_id, user_id, role)
+	VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, query, org.ID, ownerId, domain.OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+
+	org.Role = domain.OrgRoleOwner
+	return tx.Commit()
+}
+
+func (r *OrganizationRepository) Get(tenant Tenant) (*domain.Organization, error) {
+	query, args := tenant.scope(`
+	SELECT id, name, slug, created_at
+	FROM organizations
+	WHERE TRUE`, "id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var org domain.Organization
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &org, nil
+}
+
+// GetForUser returns every organization the user is a member of, with their
+// role in it, oldest membership first.
+func (r *OrganizationRepository) GetForUser(userId string) ([]*domain.Organization, error) {
+	query := `
+	SELECT organizations.id, organizations.name, organizations.slug,
+		organizations.created_at, memberships.role
+	FROM organizations
+	INNER JOIN memberships ON memberships.organization_id = organizations.id
+	WHERE memberships.user_id = $1
+	ORDER BY memberships.created_at, organizations.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*domain.Organization{}
+	for rows.Next() {
+		var org domain.Organization
+		err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt, &org.Role)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, &org)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (r *OrganizationRepository) ListMembers(tenant Tenant) ([]*domain.Membership, error) {
+	query, args := tenant.scope(membershipSelect+` WHERE TRUE`, "memberships.organization_id")
+	query += ` ORDER BY users.email`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*domain.Membership{}
+	for rows.Next() {
+		m, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (r *OrganizationRepository) GetMember(tenant Tenant, userId string) (*domain.Membership, error) {
+	query, args := tenant.scope(membershipSelect+` WHERE memberships.user_id = $1`, "memberships.organization_id", userId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	m, err := scanMembership(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (r *OrganizationRepository) UpdateMemberRole(tenant Tenant, userId, role string) error {
+	return r.changeMember(tenant, userId, role != domain.OrgRoleOwner, func(ctx context.Context, tx *sqlx.Tx) (sql.Result, error) {
+		query, args := tenant.scope(`UPDATE memberships SET role = $1 WHERE user_id = $2`, "organization_id", role, userId)
+		return tx.ExecContext(ctx, query, args...)
+	})
+}
+
+func (r *OrganizationRepository) RemoveMember(tenant Tenant, userId string) error {
+	return r.changeMember(tenant, userId, true, func(ctx context.Context, tx *sqlx.Tx) (sql.Result, error) {
+		query, args := tenant.scope(`DELETE FROM memberships WHERE user_id = $1`, "organization_id", userId)
+		return tx.ExecContext(ctx, query, args...)
+	})
+}
+
+// changeMember runs change on a member of the tenant's organization. If
+// demotesOwner is set and the member is the organization's only owner,
+// ErrLastOwner is returned instead. The organization is locked for the duration,
+// so that two owners can't demote each other at the same time.
+func (r *OrganizationRepository) changeMember(tenant Tenant, userId string, demotesOwner bool, change func(context.Context, *sqlx.Tx) (sql.Result, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orgId string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM organizations WHERE id = $1 FOR UPDATE`, tenant.OrgID()).Scan(&orgId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if demotesOwner {
+		query, args := tenant.scope(`
+		SELECT COUNT(*) FILTER (WHERE role = 'owner'),
+			COUNT(*) FILTER (WHERE role = 'owner' AND user_id = $1)
+		FROM memberships
+		WHERE TRUE`, "organization_id", userId)
+
+		var owners, isOwner int
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&owners, &isOwner); err != nil {
+			return err
+		}
+		if isOwner == 1 && owners == 1 {
+			return ErrLastOwner
+		}
+	}
+
+	result, err := change(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
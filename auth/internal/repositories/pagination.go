@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned when a page cursor can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks where a page of results ends, by the sort value and id of its
+// last row. The next page starts with the rows that sort after it. Unlike an
+// offset, rows inserted or deleted in the meantime don't shift the pages.
+type Cursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// Encode returns the cursor as an opaque string that is safe to use in a URL.
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor returned by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
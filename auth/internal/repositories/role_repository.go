@@ -0,0 +1,426 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/todo-app/internal/domain"
+)
+
+var (
+	ErrDuplicateRole       = errors.New("a role with this name already exists")
+	ErrDuplicatePermission = errors.New("a permission with this name already exists")
+	ErrUnknownPermission   = errors.New("unknown permission")
+)
+
+type RoleRepositoryInterface interface {
+	// GetAll returns every role along with its permissions.
+	GetAll() ([]*domain.Role, error)
+	Get(id int64) (*domain.Role, error)
+	Insert(role *domain.Role) error
+	Update(role *domain.Role) error
+	// Delete, SetPermissions and DeletePermission revoke the sessions of every
+	// user with an affected role, like AssignToUser and RemoveFromUser.
+	Delete(id int64) error
+	// SetPermissions replaces the permissions of a role. It returns
+	// ErrUnknownPermission if any of them don't exist.
+	SetPermissions(roleId int64, permissions []string) error
+
+	GetAllPermissions() ([]*domain.Permission, error)
+	InsertPermission(permission *domain.Permission) error
+	DeletePermission(id int64) error
+
+	// GetForUser returns the roles of a user.
+	GetForUser(userId string) ([]*domain.Role, error)
+	// GetNamesForUser returns the names of the user's roles, and of every
+	// permission those roles grant.
+	GetNamesForUser(userId string) (roles []string, permissions []string, err error)
+	// AssignToUser and RemoveFromUser revoke the user's sessions, so the change
+	// takes effect straight away rather than once their token expires.
+	AssignToUser(userId string, roleId int64) error
+	RemoveFromUser(userId string, roleId int64) error
+}
+
+type RoleRepository struct {
+	db *sqlx.DB
+}
+
+func NewRoleRepository(db *sqlx.DB) *RoleRepository {
+	return &RoleRepository{
+		db: db,
+	}
+}
+
+// roleSelect selects roles with their permissions aggregated into an array, and
+// must be followed by any WHERE clause and then roleGroupBy.
+const roleSelect = `
+	SELECT roles.id, roles.name, roles.description, roles.created_at,
+		COALESCE(array_agg(permissions.name ORDER BY permissions.name)
+			FILTER (WHERE permissions.name IS NOT NULL), '{}')
+	FROM roles
+	LEFT JOIN role_permissions ON role_permissions.role_id = roles.id
+	LEFT JOIN permissions ON permissions.id = role_permissions.permission_id`
+
+const roleGroupBy = `
+	GROUP BY roles.id
+	ORDER BY roles.name`
+
+func (r *RoleRepository) queryRoles(query string, args ...interface{}) ([]*domain.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*domain.Role{}
+	for rows.Next() {
+		var role domain.Role
+		var permissions pq.StringArray
+		err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &permissions)
+		if err != nil {
+			return nil, err
+		}
+		role.Permissions = []string(permissions)
+		roles = append(roles, &role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetAll returns every role along with its permissions.
+func (r *RoleRepository) GetAll() ([]*domain.Role, error) {
+	return r.queryRoles(roleSelect + roleGroupBy)
+}
+
+func (r *RoleRepository) Get(id int64) (*domain.Role, error) {
+	roles, err := r.queryRoles(roleSelect+` WHERE roles.id = $1`+roleGroupBy, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return roles[0], nil
+}
+
+func (r *RoleRepository) Insert(role *domain.Role) error {
+	query := `
+	INSERT INTO roles (name, description)
+	VALUES ($1, $2)
+	RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, role.Name, role.Description).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	return nil
+}
+
+func (r *RoleRepository) Update(role *domain.Role) error {
+	query := `
+	UPDATE roles
+	SET name = $1, description = $2
+	WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, role.Name, role.Description, role.ID)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	return requireRowsAffected(result)
+}
+
+// Delete removes a role, taking it away from every user that had it and
+// revoking their sessions.
+func (r *RoleRepository) Delete(id int64) error {
+	query := `
+	WITH revoked AS (
+		UPDATE users SET sessions_revoked_at = NOW()
+		WHERE id IN (SELECT user_id FROM user_roles WHERE role_id = $1)
+	)
+	DELETE FROM roles WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// SetPermissions replaces the permissions of a role, and revokes the sessions of
+// every user with the role. It returns ErrUnknownPermission if any of them don't
+// exist.
+func (r *RoleRepository) SetPermissions(roleId int64, permissions []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM roles WHERE id = $1)`, roleId).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleId)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+	INSERT INTO role_permissions (role_id, permission_id)
+	SELECT $1, id FROM permissions WHERE name = ANY($2)`, roleId, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(inserted) != countUnique(permissions) {
+		return ErrUnknownPermission
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE users SET sessions_revoked_at = NOW()
+	WHERE id IN (SELECT user_id FROM user_roles WHERE role_id = $1)`, roleId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *RoleRepository) GetAllPermissions() ([]*domain.Permission, error) {
+	query := `SELECT id, name, description FROM permissions ORDER BY name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*domain.Permission{}
+	for rows.Next() {
+		var p domain.Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *RoleRepository) InsertPermission(permission *domain.Permission) error {
+	query := `
+	INSERT INTO permissions (name, description)
+	VALUES ($1, $2)
+	RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, permission.Name, permission.Description).Scan(&permission.ID)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicatePermission
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePermission removes a permission, taking it away from every role that
+// had it and revoking the sessions of every user with those roles.
+func (r *RoleRepository) DeletePermission(id int64) error {
+	query := `
+	WITH revoked AS (
+		UPDATE users SET sessions_revoked_at = NOW()
+		WHERE id IN (
+			SELECT user_roles.user_id
+			FROM user_roles
+			INNER JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+			WHERE role_permissions.permission_id = $1
+		)
+	)
+	DELETE FROM permissions WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// GetForUser returns the roles of a user.
+func (r *RoleRepository) GetForUser(userId string) ([]*domain.Role, error) {
+	return r.queryRoles(roleSelect+`
+	INNER JOIN user_roles ON user_roles.role_id = roles.id
+	WHERE user_roles.user_id = $1`+roleGroupBy, userId)
+}
+
+// GetNamesForUser returns the names of the user's roles, and of every
+// permission those roles grant.
+func (r *RoleRepository) GetNamesForUser(userId string) ([]string, []string, error) {
+	roles, err := r.GetForUser(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleNames := make([]string, 0, len(roles))
+	permissionNames := []string{}
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+		for _, p := range role.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissionNames = append(permissionNames, p)
+			}
+		}
+	}
+
+	return roleNames, permissionNames, nil
+}
+
+// AssignToUser gives a role to a user and revokes their sessions, as their
+// tokens still carry their old permissions. Assigning a role the user already
+// has does nothing. ErrRecordNotFound is returned if the user or role doesn't exist.
+func (r *RoleRepository) AssignToUser(userId string, roleId int64) error {
+	query := `
+	WITH assigned AS (
+		INSERT INTO user_roles (user_id, role_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+	)
+	UPDATE users SET sessions_revoked_at = NOW()
+	WHERE id IN (SELECT user_id FROM assigned)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, userId, roleId)
+	if err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveFromUser takes a role away from a user and revokes their sessions, as
+// their tokens still carry the role's permissions. ErrRecordNotFound is
+// returned if the user didn't have the role.
+func (r *RoleRepository) RemoveFromUser(userId string, roleId int64) error {
+	query := `
+	WITH removed AS (
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role_id = $2
+		RETURNING user_id
+	)
+	UPDATE users SET sessions_revoked_at = NOW()
+	WHERE id IN (SELECT user_id FROM removed)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, userId, roleId)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// ----------------------- Helpers ----------------------- //
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// requireRowsAffected returns ErrRecordNotFound if the statement didn't change any rows.
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func countUnique(values []string) int {
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		seen[v] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,31 @@
+package repositories
+
+import "fmt"
+
+// Tenant scopes repository queries to a single organization. Repository methods
+// that read or change an organization's data take a Tenant rather than a plain
+// organization id, so that a handler can't forget to restrict a query to the
+// organization the user is signed in to.
+//
+// The zero Tenant matches no rows.
+type Tenant struct {
+	orgID string
+}
+
+// NewTenant returns the tenant of the organization with the given id.
+func NewTenant(orgID string) Tenant {
+	return Tenant{orgID: orgID}
+}
+
+// OrgID returns the id of the tenant's organization.
+func (t Tenant) OrgID() string {
+	return t.orgID
+}
+
+// scope restricts query to the tenant's rows by appending a condition on column,
+// which must hold the organization id. The query must already have a WHERE
+// clause, and the tenant's id is passed as the last argument.
+func (t Tenant) scope(query, column string, args ...interface{}) (string, []interface{}) {
+	args = append(args, t.orgID)
+	return fmt.Sprintf("%s AND %s = $%d", query, column, len(args)), args
+}
@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTenantScope(t *testing.T) {
+	tenant := NewTenant("org-1")
+
+	query, args := tenant.scope(`SELECT * FROM memberships WHERE user_id = $1`, "organization_id", "user-1")
+
+	wantQuery := `SELECT * FROM memberships WHERE user_id = $1 AND organization_id = $2`
+	if query != wantQuery {
+		t.Errorf("got query %q, want %q", query, wantQuery)
+	}
+	if want := []interface{}{"user-1", "org-1"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got args %v, want %v", args, want)
+	}
+
+	// The zero Tenant must not match every organization
+	_, args = Tenant{}.scope(`SELECT * FROM memberships WHERE TRUE`, "organization_id")
+	if want := []interface{}{""}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got args %v for the zero tenant, want %v", args, want)
+	}
+}
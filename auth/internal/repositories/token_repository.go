@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -12,10 +13,15 @@ type TokenRepositoryInterface interface {
 	// New is a shortcut which creates a new Token struct and then inserts the
 	// data in the tokens table.
 	New(userId string, ttl time.Duration, scope string) (*domain.Token, error)
+	// NewForInvitation creates and inserts an invitation token for an invitation.
+	NewForInvitation(invitationId int64, ttl time.Duration) (*domain.Token, error)
 	// Insert adds the data for a specific token to the tokens table
 	Insert(token *domain.Token) error
 	// DeleteAllForUser deletes all tokens for a specific user and scope
 	DeleteAllForUser(scope, userId string) error
+	// GetAllForUser returns the metadata of every token belonging to a user. The
+	// token hashes are never included.
+	GetAllForUser(userId string) ([]*domain.TokenMetadata, error)
 }
 
 type TokenRepository struct {
@@ -40,13 +46,31 @@ func (r *TokenRepository) New(userId string, ttl time.Duration, scope string) (*
 	return token, err
 }
 
+// NewForInvitation creates and inserts an invitation token for an invitation.
+func (r *TokenRepository) NewForInvitation(invitationId int64, ttl time.Duration) (*domain.Token, error) {
+	token, err := domain.GenerateToken("", ttl, domain.TokenScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+	token.InvitationID = invitationId
+
+	err = r.Insert(token)
+	return token, err
+}
+
 // Insert adds the data for a specific token to the tokens table
 func (r *TokenRepository) Insert(token *domain.Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
+	INSERT INTO tokens (hash, user_id, expiry, scope, invitation_id)
+	VALUES ($1, $2, $3, $4, $5)`
 
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []interface{}{
+		token.Hash,
+		sql.NullString{String: token.UserID, Valid: token.UserID != ""},
+		token.Expiry,
+		token.Scope,
+		sql.NullInt64{Int64: token.InvitationID, Valid: token.InvitationID != 0},
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -67,3 +91,37 @@ func (r *TokenRepository) DeleteAllForUser(scope, userId string) error {
 	_, err := r.db.ExecContext(ctx, query, scope, userId)
 	return err
 }
+
+// GetAllForUser returns the metadata of every token belonging to a user. The
+// token hashes are never included.
+func (r *TokenRepository) GetAllForUser(userId string) ([]*domain.TokenMetadata, error) {
+	query := `
+	SELECT scope, expiry
+	FROM tokens
+	WHERE user_id = $1
+	ORDER BY expiry DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*domain.TokenMetadata{}
+	for rows.Next() {
+		var token domain.TokenMetadata
+		if err := rows.Scan(&token.Scope, &token.Expiry); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
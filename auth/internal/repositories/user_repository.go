@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +21,35 @@ type UserRepositoryInterface interface {
 	GetById(id string) (*domain.User, error)
 	GetForToken(tokenScope, tokenPlaintext string) (*domain.User, error)
 	Update(user *domain.User) error
+	Delete(id string) error
+	// List returns a page of the users matching the filter, and the cursor of
+	// the next page, which is nil on the last page.
+	List(filter UserFilter) ([]*domain.User, *Cursor, error)
+	// Count returns how many users match the filter, ignoring its cursor and limit.
+	Count(filter UserFilter) (int, error)
+	// GetSessionState returns the status of a user's account and when they last
+	// revoked their sessions.
+	GetSessionState(id string) (*domain.SessionState, error)
+	// RevokeSessions makes every token issued to the user until now invalid.
+	RevokeSessions(id string) error
+}
+
+// UserSortSafelist are the values UserFilter.Sort can take. A leading "-" sorts
+// in descending order.
+var UserSortSafelist = []string{"created_at", "-created_at", "email", "-email"}
+
+// UserFilter filters, sorts and pages the users returned by List. Zero values
+// don't filter.
+type UserFilter struct {
+	Status        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	EmailPrefix   string
+	// Sort is one of UserSortSafelist, created_at by default
+	Sort  string
+	Limit int
+	// After is the cursor of the page to return, nil for the first page
+	After *Cursor
 }
 
 type UserRepo struct {
@@ -32,8 +63,44 @@ type UserDBModel struct {
 	LastName  string    `db:"last_name"`
 	Email     string    `db:"email"`
 	Password  string    `db:"password"`
-	Activated bool      `db:"activated"`
 	CreatedAt time.Time `db:"created_at"`
+
+	Status          string    `db:"status"`
+	StatusReason    string    `db:"status_reason"`
+	StatusChangedAt time.Time `db:"status_changed_at"`
+
+	PepperVersion int `db:"password_pepper_version"`
+
+	FailedLoginAttempts int          `db:"failed_login_attempts"`
+	LockedUntil         sql.NullTime `db:"locked_until"`
+
+	PasswordResetRequired bool `db:"password_reset_required"`
+}
+
+// userColumns lists the columns selected for a user, in the order of the
+// destinations returned by scanDest.
+const userColumns = `users.id, users.created_at, users.first_name, users.last_name, users.email,
+	users.password, users.status, users.status_reason, users.status_changed_at,
+	users.password_pepper_version, users.failed_login_attempts, users.locked_until,
+	users.password_reset_required`
+
+// scanDest returns the model's fields to scan a row of userColumns into.
+func (m *UserDBModel) scanDest() []interface{} {
+	return []interface{}{
+		&m.ID,
+		&m.CreatedAt,
+		&m.FirstName,
+		&m.LastName,
+		&m.Email,
+		&m.Password,
+		&m.Status,
+		&m.StatusReason,
+		&m.StatusChangedAt,
+		&m.PepperVersion,
+		&m.FailedLoginAttempts,
+		&m.LockedUntil,
+		&m.PasswordResetRequired,
+	}
 }
 
 // Returns a domain user object, insuring that we interact with the domain object,
@@ -46,7 +113,17 @@ func (m *UserDBModel) ToDomain() *domain.User {
 		Email:     m.Email,
 		Password:  m.Password,
 		CreatedAt: m.CreatedAt,
-		Activated: m.Activated,
+
+		Status:          m.Status,
+		StatusReason:    m.StatusReason,
+		StatusChangedAt: m.StatusChangedAt,
+
+		PepperVersion: m.PepperVersion,
+
+		FailedLoginAttempts: m.FailedLoginAttempts,
+		LockedUntil:         m.LockedUntil.Time,
+
+		PasswordResetRequired: m.PasswordResetRequired,
 	}
 }
 
@@ -60,21 +137,13 @@ func NewUserRepository(db *sqlx.DB) *UserRepo {
 // returning the user if found, and returning and empty user
 // domain model if not found.
 func (r *UserRepo) GetByEmail(email string) (*domain.User, error) {
-	query := `SELECT * FROM users WHERE email=$1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
 	user := UserDBModel{}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.CreatedAt,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.Activated,
-	)
+	err := r.db.QueryRowContext(ctx, query, email).Scan(user.scanDest()...)
 
 	if err != nil {
 		switch {
@@ -96,21 +165,13 @@ func (r *UserRepo) GetByEmail(email string) (*domain.User, error) {
 //
 
 func (r *UserRepo) GetById(id string) (*domain.User, error) {
-	query := `SELECT * FROM USERS WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 	user := UserDBModel{}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.CreatedAt,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.Activated,
-	)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(user.scanDest()...)
 
 	if err != nil {
 		switch {
@@ -127,28 +188,25 @@ func (r *UserRepo) GetById(id string) (*domain.User, error) {
 
 // Create inserts a user to the database. It takes a domain.User object
 // as it's only parameter, and returns it if the insert is successful
-// otherwise, it returns an error
+// otherwise, it returns an error. Users without a status are created pending
+// activation.
 func (r *UserRepo) Create(user *domain.User) (*domain.User, error) {
+	status := user.Status
+	if status == "" {
+		status = domain.StatusPending
+	}
 
 	model := UserDBModel{}
-	query := `INSERT INTO users (id, first_name, last_name, email, password, activated)
-	VALUES ($1, $2, $3, $4, $5, $6)
-	RETURNING id, first_name, last_name, email, password, activated, created_at`
+	query := `INSERT INTO users (id, first_name, last_name, email, password, status, status_reason, password_pepper_version)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING ` + userColumns
 
-	args := []interface{}{user.ID, user.FirstName, user.LastName, user.Email, user.Password, user.Activated}
+	args := []interface{}{user.ID, user.FirstName, user.LastName, user.Email, user.Password, status, user.StatusReason, user.PepperVersion}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(
-		&model.ID,
-		&model.FirstName,
-		&model.LastName,
-		&model.Email,
-		&model.Password,
-		&model.Activated,
-		&model.CreatedAt,
-	)
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(model.scanDest()...)
 
 	// If the table already contains a record with this email address, then when we try
 	// to perform the insert there will be a violation of the UNIQUE "users_email_key"
@@ -175,7 +233,7 @@ func (r *UserRepo) GetForToken(tokenScope, tokenPlaintext string) (*domain.User,
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-	SELECT users.id, users.created_at, users.first_name, users.last_name, users.email, users.password, users.activated
+	SELECT ` + userColumns + `
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
@@ -194,15 +252,7 @@ func (r *UserRepo) GetForToken(tokenScope, tokenPlaintext string) (*domain.User,
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(
-		&user.ID,
-		&user.CreatedAt,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.Activated,
-	)
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(user.scanDest()...)
 
 	if err != nil {
 		switch {
@@ -222,16 +272,29 @@ func (r *UserRepo) GetForToken(tokenScope, tokenPlaintext string) (*domain.User,
 func (r *UserRepo) Update(user *domain.User) error {
 	query := `
 	UPDATE users
-	SET first_name = $1, last_name = $2, email = $3, password = $4, activated = $5
-	WHERE id = $6
-	RETURNING id, first_name, last_name, email, password, activated, created_at`
+	SET first_name = $1, last_name = $2, email = $3, password = $4, status = $5,
+		status_reason = $6, status_changed_at = $7, password_pepper_version = $8,
+		password_reset_required = $9
+	WHERE id = $10
+	RETURNING id, first_name, last_name, email, password, status, status_reason, status_changed_at,
+		created_at, password_pepper_version, password_reset_required`
+
+	// Users loaded before the status existed in the row have a zero StatusChangedAt
+	statusChangedAt := user.StatusChangedAt
+	if statusChangedAt.IsZero() {
+		statusChangedAt = time.Now()
+	}
 
 	args := []interface{}{
 		user.FirstName,
 		user.LastName,
 		user.Email,
 		user.Password,
-		user.Activated,
+		user.Status,
+		user.StatusReason,
+		statusChangedAt,
+		user.PepperVersion,
+		user.PasswordResetRequired,
 		user.ID,
 	}
 
@@ -244,8 +307,12 @@ func (r *UserRepo) Update(user *domain.User) error {
 		&user.LastName,
 		&user.Email,
 		&user.Password,
-		&user.Activated,
+		&user.Status,
+		&user.StatusReason,
+		&user.StatusChangedAt,
 		&user.CreatedAt,
+		&user.PepperVersion,
+		&user.PasswordResetRequired,
 	)
 
 	if err != nil {
@@ -261,3 +328,194 @@ func (r *UserRepo) Update(user *domain.User) error {
 	}
 	return nil
 }
+
+// Delete permanently removes a user record. Any tokens belonging to the user
+// are removed along with it by the `ON DELETE CASCADE` on the tokens table.
+// If no user exists with the given id, ErrRecordNotFound is returned.
+func (r *UserRepo) Delete(id string) error {
+	query := `DELETE FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetSessionState returns the status of a user's account and when they last
+// revoked their sessions. It is cheaper than GetById for checking the session
+// can still be used on every request.
+func (r *UserRepo) GetSessionState(id string) (*domain.SessionState, error) {
+	query := `SELECT status, sessions_revoked_at FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var state domain.SessionState
+	var revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&state.Status, &revokedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	state.SessionsRevokedAt = revokedAt.Time
+
+	return &state, nil
+}
+
+// RevokeSessions makes every token issued to the user until now invalid.
+func (r *UserRepo) RevokeSessions(id string) error {
+	query := `UPDATE users SET sessions_revoked_at = NOW() WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// List returns a page of the users matching the filter, and the cursor of the
+// next page, which is nil on the last page.
+func (r *UserRepo) List(filter UserFilter) ([]*domain.User, *Cursor, error) {
+	where, args := filter.where()
+	column, cast, descending := filter.sortColumn()
+
+	if filter.After != nil {
+		op := ">"
+		if descending {
+			op = "<"
+		}
+		args = append(args, filter.After.Value, filter.After.ID)
+		where += fmt.Sprintf(` AND (%s, users.id) %s ($%d::%s, $%d)`, column, op, len(args)-1, cast, len(args))
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+
+	// Fetch one more than the limit to know if there is a next page
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM users
+	WHERE %s
+	ORDER BY %s %s, users.id %s
+	LIMIT $%d`, userColumns, where, column, direction, direction, len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	users := []*domain.User{}
+	for rows.Next() {
+		var model UserDBModel
+		if err := rows.Scan(model.scanDest()...); err != nil {
+			return nil, nil, err
+		}
+		users = append(users, model.ToDomain())
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(users) <= filter.Limit {
+		return users, nil, nil
+	}
+
+	users = users[:filter.Limit]
+	last := users[len(users)-1]
+	next := &Cursor{ID: last.ID.String(), Value: last.CreatedAt.Format(time.RFC3339Nano)}
+	if column == "users.email" {
+		next.Value = last.Email
+	}
+	return users, next, nil
+}
+
+// Count returns how many users match the filter, ignoring its cursor and limit.
+func (r *UserRepo) Count(filter UserFilter) (int, error) {
+	where, args := filter.where()
+	query := `SELECT COUNT(*) FROM users WHERE ` + where
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// where returns the conditions of the filter, not including its cursor, and
+// their arguments.
+func (f UserFilter) where() (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conditions = append(conditions, fmt.Sprintf("users.status = $%d", len(args)))
+	}
+	if !f.CreatedAfter.IsZero() {
+		args = append(args, f.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("users.created_at >= $%d", len(args)))
+	}
+	if !f.CreatedBefore.IsZero() {
+		args = append(args, f.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("users.created_at < $%d", len(args)))
+	}
+	if f.EmailPrefix != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.EmailPrefix)
+		args = append(args, escaped+"%")
+		conditions = append(conditions, fmt.Sprintf("users.email LIKE $%d", len(args)))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// sortColumn returns the column to sort by, its type, and whether to sort in
+// descending order.
+func (f UserFilter) sortColumn() (column, cast string, descending bool) {
+	descending = strings.HasPrefix(f.Sort, "-")
+	switch strings.TrimPrefix(f.Sort, "-") {
+	case "email":
+		return "users.email", "citext", descending
+	default:
+		return "users.created_at", "timestamptz", descending
+	}
+}
@@ -101,7 +101,7 @@ func TestGetById(t *testing.T) {
 				LastName:  "test",
 				Email:     "test1@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -114,7 +114,7 @@ func TestGetById(t *testing.T) {
 				LastName:  "test",
 				Email:     "test2@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -127,7 +127,7 @@ func TestGetById(t *testing.T) {
 				LastName:  "test",
 				Email:     "test3@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -140,7 +140,7 @@ func TestGetById(t *testing.T) {
 				LastName:  "test",
 				Email:     "test4@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -209,7 +209,7 @@ func TestGetByEmail(t *testing.T) {
 				LastName:  "test",
 				Email:     "test1@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -222,7 +222,7 @@ func TestGetByEmail(t *testing.T) {
 				LastName:  "test",
 				Email:     "test2@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -235,7 +235,7 @@ func TestGetByEmail(t *testing.T) {
 				LastName:  "test",
 				Email:     "test3@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -248,7 +248,7 @@ func TestGetByEmail(t *testing.T) {
 				LastName:  "test",
 				Email:     "test4@gmail.com",
 				Password:  "password",
-				Activated: false,
+				Status:    domain.StatusPending,
 				CreatedAt: time.Time{},
 			},
 		},
@@ -316,7 +316,7 @@ func TestCreate(t *testing.T) {
 				LastName:  "test",
 				Email:     "test@gmail.com",
 				Password:  "asdfasdf",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 		},
 		{
@@ -328,7 +328,7 @@ func TestCreate(t *testing.T) {
 				LastName:  "test",
 				Email:     "test@gmail.com",
 				Password:  "hello",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 		},
 		{
@@ -340,7 +340,7 @@ func TestCreate(t *testing.T) {
 				LastName:  "goodbye",
 				Email:     "email777@gmail.com",
 				Password:  "passwordthatslong",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 		},
 	}
@@ -378,7 +378,7 @@ func TestUpdate(t *testing.T) {
 				LastName:  "test",
 				Email:     "test@gmail.com",
 				Password:  "asdfasdf",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 		},
 		{
@@ -390,7 +390,7 @@ func TestUpdate(t *testing.T) {
 				LastName:  "test",
 				Email:     "test7676@gmail.com",
 				Password:  "hello",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 		},
 		{
@@ -402,7 +402,7 @@ func TestUpdate(t *testing.T) {
 				LastName:  "goodbye",
 				Email:     "email777@gmail.com",
 				Password:  "passwordthatslong",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 		},
 	}
@@ -416,7 +416,9 @@ func TestUpdate(t *testing.T) {
 			}
 
 			// Make a change to the user *these are pointers, so the actual memory location value will be changed*
-			tt.User.Activated = true
+			if err := tt.User.SetStatus(domain.StatusActive, "test"); err != nil {
+				t.Fatalf("setting status: %v", err)
+			}
 			tt.User.LastName = "Test Lastname"
 
 			err = repo.Update(tt.User)
@@ -432,8 +434,11 @@ func TestUpdate(t *testing.T) {
 				LastName:  "Test Lastname",
 				Email:     tt.User.Email,
 				Password:  tt.User.Password,
-				Activated: true,
 				CreatedAt: tt.User.CreatedAt,
+
+				Status:          domain.StatusActive,
+				StatusReason:    "test",
+				StatusChangedAt: tt.User.StatusChangedAt,
 			}
 
 			if !reflect.DeepEqual(tt.User, want) {
@@ -445,13 +450,130 @@ func TestUpdate(t *testing.T) {
 	testutil.TeardownUserTable(db, t)
 }
 
+func TestDelete(t *testing.T) {
+	testutil.SetupUserTable(db)
+	repo := NewUserRepository(db)
+
+	existing, err := CreateTestUser(db, UserDBModel{
+		ID:        uuid.New(),
+		FirstName: "test",
+		LastName:  "test",
+		Email:     "delete@gmail.com",
+		Password:  "password",
+		Status:    domain.StatusActive,
+	})
+	if err != nil {
+		t.Fatalf("failed creating user before test: %s", err)
+	}
+
+	tests := []struct {
+		Name    string
+		UserId  string
+		WantErr error
+	}{
+		{
+			Name:    "Existing user",
+			UserId:  existing.ID.String(),
+			WantErr: nil,
+		},
+		{
+			Name:    "Already deleted user",
+			UserId:  existing.ID.String(),
+			WantErr: ErrRecordNotFound,
+		},
+		{
+			Name:    "Unknown user",
+			UserId:  uuid.New().String(),
+			WantErr: ErrRecordNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			err := repo.Delete(tt.UserId)
+
+			if !errors.Is(err, tt.WantErr) {
+				t.Errorf("want: %v; got %v", tt.WantErr, err)
+			}
+		})
+	}
+
+	_, err = repo.GetById(existing.ID.String())
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected deleted user to be gone, got: %v", err)
+	}
+
+	testutil.TeardownUserTable(db, t)
+}
+
 // ---------------------  Helpers ---------------------------- //
 // CreateTestUser is a helper function that inserts a user to the DB given a UserDBModel.
 // Note: It does NOT hash passwords.
+// TestList pages through the users matching a filter, checking that every
+// user is returned exactly once and in order.
+func TestList(t *testing.T) {
+	testutil.SetupUserTable(db)
+	repo := NewUserRepository(db)
+
+	for i, email := range []string{"carol@example.com", "alice@example.com", "bob@example.com", "dave@other.com", "eve@example.com"} {
+		status := domain.StatusActive
+		if i == 4 {
+			status = domain.StatusSuspended
+		}
+		_, err := CreateTestUser(db, UserDBModel{
+			ID:        uuid.New(),
+			FirstName: "test",
+			LastName:  "test",
+			Email:     email,
+			Password:  "password",
+			Status:    status,
+		})
+		if err != nil {
+			t.Fatalf("error creating user: %v", err)
+		}
+	}
+
+	filter := UserFilter{Status: domain.StatusActive, Sort: "email", Limit: 2}
+
+	var emails []string
+	for page := 0; page < 3; page++ {
+		users, next, err := repo.List(filter)
+		if err != nil {
+			t.Fatalf("listing users: %v", err)
+		}
+		for _, u := range users {
+			emails = append(emails, u.Email)
+		}
+		if next == nil {
+			break
+		}
+		// The cursor must survive being sent to the client and back
+		filter.After, err = DecodeCursor(next.Encode())
+		if err != nil {
+			t.Fatalf("decoding cursor: %v", err)
+		}
+	}
+
+	want := []string{"alice@example.com", "bob@example.com", "carol@example.com", "dave@other.com"}
+	if !reflect.DeepEqual(emails, want) {
+		t.Errorf("got %v, want %v", emails, want)
+	}
+
+	count, err := repo.Count(UserFilter{EmailPrefix: "A", Sort: "-email", Limit: 1})
+	if err != nil {
+		t.Fatalf("counting users: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("got %d users with the email prefix, want 1", count)
+	}
+
+	testutil.TeardownUserTable(db, t)
+}
+
 func CreateTestUser(db *sqlx.DB, model UserDBModel) (*domain.User, error) {
 
-	_, err := db.NamedExec(`INSERT INTO users (id, first_name, last_name, email, password, activated)
-	 VALUES (:id, :first_name, :last_name, :email, :password, :activated)`, model)
+	_, err := db.NamedExec(`INSERT INTO users (id, first_name, last_name, email, password, status)
+	 VALUES (:id, :first_name, :last_name, :email, :password, :status)`, model)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,76 @@
+// Package risk scores how suspicious a sign in is from the user's sign in
+// history, so that only risky sign ins need to be confirmed.
+package risk
+
+import (
+	"time"
+
+	"github.com/todo-app/internal/domain"
+)
+
+// Attempt is a sign in with the right password, being scored before the user is
+// signed in.
+type Attempt struct {
+	IP       string
+	Location *domain.GeoLocation
+	Time     time.Time
+	// History is the user's previous successful sign ins, newest first.
+	History []*domain.LoginEvent
+}
+
+// Rule scores one kind of risk of an attempt. It returns 0 if the attempt looks
+// fine to it, and otherwise its score with why, e.g. "new country GB".
+type Rule interface {
+	Name() string
+	Evaluate(a *Attempt) (score int, reason string)
+}
+
+// Signal is a rule that scored an attempt.
+type Signal struct {
+	Rule   string `json:"rule"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// Assessment is the total score of an attempt and the rules it is made up of.
+type Assessment struct {
+	Score   int      `json:"score"`
+	Signals []Signal `json:"signals"`
+}
+
+// Engine scores attempts with a set of rules. A nil *Engine scores every
+// attempt 0.
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Assess adds up the scores of every rule.
+func (e *Engine) Assess(a *Attempt) *Assessment {
+	assessment := &Assessment{Signals: []Signal{}}
+	if e == nil {
+		return assessment
+	}
+
+	for _, rule := range e.rules {
+		score, reason := rule.Evaluate(a)
+		if score <= 0 {
+			continue
+		}
+		assessment.Score += score
+		assessment.Signals = append(assessment.Signals, Signal{Rule: rule.Name(), Score: score, Reason: reason})
+	}
+	return assessment
+}
+
+// Rules returns the names of the rules that scored the attempt.
+func (a *Assessment) Rules() []string {
+	names := make([]string, len(a.Signals))
+	for i, s := range a.Signals {
+		names[i] = s.Rule
+	}
+	return names
+}
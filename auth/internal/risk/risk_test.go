@@ -0,0 +1,179 @@
+package risk
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+)
+
+var (
+	berlin  = &domain.GeoLocation{City: "Berlin", Country: "Germany", CountryCode: "DE", Latitude: 52.52, Longitude: 13.405}
+	munich  = &domain.GeoLocation{City: "Munich", Country: "Germany", CountryCode: "DE", Latitude: 48.137, Longitude: 11.575}
+	potsdam = &domain.GeoLocation{City: "Potsdam", Country: "Germany", CountryCode: "DE", Latitude: 52.391, Longitude: 13.064}
+	sydney  = &domain.GeoLocation{City: "Sydney", Country: "Australia", CountryCode: "AU", Latitude: -33.869, Longitude: 151.209}
+)
+
+var now = time.Date(2021, time.June, 1, 14, 0, 0, 0, time.UTC)
+
+func signIn(location *domain.GeoLocation, ago time.Duration) *domain.LoginEvent {
+	return &domain.LoginEvent{Succeeded: true, Location: location, OccurredAt: now.Add(-ago)}
+}
+
+func TestNewCountry(t *testing.T) {
+	rule := &NewCountry{Score: 40}
+
+	tests := []struct {
+		name      string
+		location  *domain.GeoLocation
+		history   []*domain.LoginEvent
+		wantScore int
+	}{
+		{"Same country", munich, []*domain.LoginEvent{signIn(berlin, time.Hour)}, 0},
+		{"New country", sydney, []*domain.LoginEvent{signIn(berlin, time.Hour)}, 40},
+		{"Seen before", sydney, []*domain.LoginEvent{signIn(berlin, time.Hour), signIn(sydney, 48*time.Hour)}, 0},
+		{"No history", sydney, nil, 0},
+		{"Never located", sydney, []*domain.LoginEvent{signIn(nil, time.Hour)}, 0},
+		{"Not located", nil, []*domain.LoginEvent{signIn(berlin, time.Hour)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, _ := rule.Evaluate(&Attempt{Location: tt.location, Time: now, History: tt.history})
+			if score != tt.wantScore {
+				t.Errorf("got score %d, want %d", score, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	rule := &ImpossibleTravel{Score: 60, MaxSpeed: 1000, MinDistance: 200}
+
+	tests := []struct {
+		name      string
+		location  *domain.GeoLocation
+		history   []*domain.LoginEvent
+		wantScore int
+	}{
+		{"Too fast", sydney, []*domain.LoginEvent{signIn(berlin, 2*time.Hour)}, 60},
+		{"Long enough to fly", sydney, []*domain.LoginEvent{signIn(berlin, 24*time.Hour)}, 0},
+		{"Too close to tell", potsdam, []*domain.LoginEvent{signIn(berlin, time.Minute)}, 0},
+		{"Skips unlocated sign ins", sydney, []*domain.LoginEvent{signIn(nil, time.Minute), signIn(berlin, 2*time.Hour)}, 60},
+		{"Only the last located sign in counts", sydney, []*domain.LoginEvent{signIn(berlin, 30*time.Hour), signIn(berlin, 2*time.Hour)}, 0},
+		{"No coordinates", &domain.GeoLocation{CountryCode: "AU"}, []*domain.LoginEvent{signIn(berlin, time.Hour)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, _ := rule.Evaluate(&Attempt{Location: tt.location, Time: now, History: tt.history})
+			if score != tt.wantScore {
+				t.Errorf("got score %d, want %d", score, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// Berlin to Sydney is about 16,100 km
+	got := Distance(berlin.Latitude, berlin.Longitude, sydney.Latitude, sydney.Longitude)
+	if math.Abs(got-16090) > 50 {
+		t.Errorf("got %.0f km, want about 16090 km", got)
+	}
+	if got := Distance(1, 2, 1, 2); got != 0 {
+		t.Errorf("got %f km between the same points, want 0", got)
+	}
+}
+
+func TestIPList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ips.txt")
+	list := "# Tor exit nodes\n198.51.100.7\n\n203.0.113.0/24 # abuse\n2001:db8::/32\n"
+	if err := ioutil.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := LoadIPList(path, 60)
+	if err != nil {
+		t.Fatalf("unexpected error loading the list: %v", err)
+	}
+
+	tests := []struct {
+		ip        string
+		wantScore int
+	}{
+		{"198.51.100.7", 60},
+		{"198.51.100.8", 0},
+		{"203.0.113.99", 60},
+		{"2001:db8::1", 60},
+		{"2001:db9::1", 0},
+		{"not an ip", 0},
+	}
+
+	for _, tt := range tests {
+		score, _ := rule.Evaluate(&Attempt{IP: tt.ip})
+		if score != tt.wantScore {
+			t.Errorf("%s: got score %d, want %d", tt.ip, score, tt.wantScore)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("198.51.100.7\nbogus\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIPList(path, 60); err == nil {
+		t.Error("expected an error loading a list with an invalid entry")
+	}
+}
+
+func TestUnusualHour(t *testing.T) {
+	rule := &UnusualHour{Score: 20, MinHistory: 3}
+
+	at := func(hour int) *domain.LoginEvent {
+		return &domain.LoginEvent{OccurredAt: time.Date(2021, time.May, 1, hour, 30, 0, 0, time.UTC)}
+	}
+
+	tests := []struct {
+		name      string
+		time      time.Time
+		history   []*domain.LoginEvent
+		wantScore int
+	}{
+		{"Usual hour", now, []*domain.LoginEvent{at(9), at(13), at(18)}, 0},
+		{"Unusual hour", now.Add(-11 * time.Hour), []*domain.LoginEvent{at(9), at(13), at(18)}, 20},
+		{"Wraps around midnight", now.Add(-14 * time.Hour), []*domain.LoginEvent{at(9), at(13), at(23)}, 0},
+		{"Too little history", now.Add(-11 * time.Hour), []*domain.LoginEvent{at(9), at(13)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, _ := rule.Evaluate(&Attempt{Time: tt.time, History: tt.history})
+			if score != tt.wantScore {
+				t.Errorf("got score %d, want %d", score, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestAssess(t *testing.T) {
+	engine := NewEngine(
+		&NewCountry{Score: 40},
+		&ImpossibleTravel{Score: 60, MaxSpeed: 1000, MinDistance: 200},
+		&UnusualHour{Score: 20, MinHistory: 10},
+	)
+
+	got := engine.Assess(&Attempt{Location: sydney, Time: now, History: []*domain.LoginEvent{signIn(berlin, time.Hour)}})
+	if got.Score != 100 {
+		t.Errorf("got score %d, want 100", got.Score)
+	}
+	if want := []string{"new_country", "impossible_travel"}; !reflect.DeepEqual(got.Rules(), want) {
+		t.Errorf("got rules %v, want %v", got.Rules(), want)
+	}
+
+	var disabled *Engine
+	if got := disabled.Assess(&Attempt{Location: sydney, Time: now}); got.Score != 0 {
+		t.Errorf("got score %d from a nil engine, want 0", got.Score)
+	}
+}
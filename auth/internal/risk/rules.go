@@ -0,0 +1,188 @@
+package risk
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/todo-app/internal/ipfilter"
+)
+
+// NewCountry scores a sign in from a country the user has never signed in from
+// before. Users that have never been located aren't scored, as there is nothing
+// to compare with.
+type NewCountry struct {
+	Score int
+}
+
+func (r *NewCountry) Name() string {
+	return "new_country"
+}
+
+func (r *NewCountry) Evaluate(a *Attempt) (int, string) {
+	if a.Location == nil || a.Location.CountryCode == "" {
+		return 0, ""
+	}
+
+	located := false
+	for _, e := range a.History {
+		if e.Location == nil || e.Location.CountryCode == "" {
+			continue
+		}
+		if e.Location.CountryCode == a.Location.CountryCode {
+			return 0, ""
+		}
+		located = true
+	}
+	if !located {
+		return 0, ""
+	}
+	return r.Score, "new country " + a.Location.CountryCode
+}
+
+// ImpossibleTravel scores a sign in that is further from the user's last located
+// sign in than they could have travelled at MaxSpeed, in km/h. Sign ins less
+// than MinDistance km apart aren't scored, as GeoIP locations are only rough.
+type ImpossibleTravel struct {
+	Score       int
+	MaxSpeed    float64
+	MinDistance float64
+}
+
+func (r *ImpossibleTravel) Name() string {
+	return "impossible_travel"
+}
+
+func (r *ImpossibleTravel) Evaluate(a *Attempt) (int, string) {
+	if a.Location == nil || !hasCoordinates(a.Location.Latitude, a.Location.Longitude) {
+		return 0, ""
+	}
+
+	for _, e := range a.History {
+		if e.Location == nil || !hasCoordinates(e.Location.Latitude, e.Location.Longitude) {
+			continue
+		}
+
+		distance := Distance(e.Location.Latitude, e.Location.Longitude, a.Location.Latitude, a.Location.Longitude)
+		if distance < r.MinDistance {
+			return 0, ""
+		}
+
+		elapsed := a.Time.Sub(e.OccurredAt)
+		if elapsed > 0 && distance/elapsed.Hours() <= r.MaxSpeed {
+			return 0, ""
+		}
+		return r.Score, fmt.Sprintf("%.0f km from the last sign in %s ago", distance, elapsed.Round(time.Second))
+	}
+	return 0, ""
+}
+
+// hasCoordinates reports whether a location has coordinates, which GeoIP
+// databases leave as 0, 0 when they don't know them.
+func hasCoordinates(latitude, longitude float64) bool {
+	return latitude != 0 || longitude != 0
+}
+
+// earthRadius is the mean radius of the Earth in km.
+const earthRadius = 6371.0
+
+// Distance returns the great circle distance in km between two points.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// IPList scores sign ins from addresses on a list, such as Tor exit nodes or
+// addresses known for abuse.
+type IPList struct {
+	Score    int
+	networks ipfilter.List
+}
+
+// LoadIPList reads a list of IP addresses and CIDR ranges, one per line. Blank
+// lines and anything after a # are ignored.
+func LoadIPList(path string, score int) (*IPList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &IPList{Score: score}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := scanner.Text()
+		if i := strings.IndexByte(entry, '#'); i >= 0 {
+			entry = entry[:i]
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		network, err := ipfilter.ParseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		list.networks = append(list.networks, network)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *IPList) Name() string {
+	return "ip_list"
+}
+
+func (r *IPList) Evaluate(a *Attempt) (int, string) {
+	ip := net.ParseIP(a.IP)
+	if ip == nil {
+		return 0, ""
+	}
+	if r.networks.Contains(ip) {
+		return r.Score, "listed address " + a.IP
+	}
+	return 0, ""
+}
+
+// UnusualHour scores a sign in at an hour of the day, in UTC, the user hasn't
+// signed in within an hour of before. Users with fewer than MinHistory sign ins
+// aren't scored, as they don't have habits yet.
+type UnusualHour struct {
+	Score      int
+	MinHistory int
+}
+
+func (r *UnusualHour) Name() string {
+	return "unusual_hour"
+}
+
+func (r *UnusualHour) Evaluate(a *Attempt) (int, string) {
+	if len(a.History) < r.MinHistory {
+		return 0, ""
+	}
+
+	hour := a.Time.UTC().Hour()
+	for _, e := range a.History {
+		diff := e.OccurredAt.UTC().Hour() - hour
+		if diff < 0 {
+			diff = -diff
+		}
+		// Hours wrap around midnight
+		if diff <= 1 || diff >= 23 {
+			return 0, ""
+		}
+	}
+	return r.Score, fmt.Sprintf("sign in at %02d:00 UTC", hour)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/todo-app/internal/audit"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ipfilter"
+)
+
+// SetAuditLog sets where sign ins are recorded. By default they go to the
+// audit_events table of the service's database.
+func (s *IdentityService) SetAuditLog(log *audit.Log) {
+	s.auditLog = log
+}
+
+// auditLogin records a sign in attempt. Failed attempts on an existing account
+// target it, but have no actor as we don't know who made them.
+func (s *IdentityService) auditLogin(req *identity.LoginRequest, user *domain.User, err error) {
+	if err == nil {
+		event := loginAuditEvent(req, domain.AuditLoginSucceeded).SetTarget(user)
+		event.ActorID, event.ActorEmail = user.ID.String(), user.Email
+		s.auditLog.Record(event)
+		return
+	}
+
+	event := loginAuditEvent(req, domain.AuditLoginFailed).
+		With("email", req.Email).
+		With("reason", loginFailureReason(err))
+	if user != nil {
+		event.SetTarget(user)
+	}
+	s.auditLog.Record(event)
+}
+
+// loginAuditEvent returns an event for the action about the sign in request.
+func loginAuditEvent(req *identity.LoginRequest, action string) *domain.AuditEvent {
+	return &domain.AuditEvent{
+		Action:    action,
+		IP:        req.IP,
+		UserAgent: req.UserAgent,
+		RequestID: req.RequestID,
+	}
+}
+
+// loginFailureReason names why a sign in failed in the audit log.
+func loginFailureReason(err error) string {
+	switch {
+	case errors.Is(err, identity.ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, identity.ErrAccountLocked):
+		return "locked_out"
+	case errors.Is(err, identity.ErrUserNotActivated):
+		return "not_activated"
+	case errors.Is(err, identity.ErrAccountSuspended):
+		return "suspended"
+	case errors.Is(err, identity.ErrAccountOnHold):
+		return "locked"
+	case errors.Is(err, identity.ErrAccountClosed):
+		return "closed"
+	case errors.Is(err, identity.ErrPasswordResetRequired):
+		return "password_reset_required"
+	case errors.Is(err, identity.ErrLoginConfirmationRequired):
+		return "confirmation_required"
+	case errors.Is(err, ipfilter.ErrNotAllowed):
+		return "ip_not_allowed"
+	default:
+		return "error"
+	}
+}
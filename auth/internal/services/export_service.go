@@ -0,0 +1,324 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+)
+
+// ExportSource provides one section of a user's data export. Every subsystem that
+// stores personal data should register a source so that subject-access requests
+// stay complete as the application grows.
+type ExportSource interface {
+	// Name is the key the section is stored under in the export.
+	Name() string
+	// Count returns the number of records the source holds for the user. It is
+	// used to decide whether an export is large enough to be built in the background.
+	Count(userId string) (int, error)
+	// Collect returns the data held for the user. The returned value must be
+	// JSON serializable and must never contain secrets such as password or token hashes.
+	Collect(userId string) (interface{}, error)
+}
+
+type ExportServiceInterface interface {
+	// CountRecords returns the total number of records held for a user across all sources.
+	CountRecords(userId string) (int, error)
+	// Build collects the data from every source into a single export.
+	Build(userId string) (*domain.UserExport, error)
+	// Archive zips a built export into a single export.json file.
+	Archive(export *domain.UserExport) ([]byte, error)
+}
+
+type ExportService struct {
+	sources []ExportSource
+}
+
+func NewExportService(sources ...ExportSource) *ExportService {
+	return &ExportService{
+		sources: sources,
+	}
+}
+
+// CountRecords returns the total number of records held for a user across all sources.
+func (s *ExportService) CountRecords(userId string) (int, error) {
+	total := 0
+	for _, source := range s.sources {
+		count, err := source.Count(userId)
+		if err != nil {
+			return 0, fmt.Errorf("counting %s records: %w", source.Name(), err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// Build collects the data from every source into a single export.
+func (s *ExportService) Build(userId string) (*domain.UserExport, error) {
+	id, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &domain.UserExport{
+		UserID:      id,
+		GeneratedAt: time.Now().UTC(),
+		Sections:    make(map[string]interface{}, len(s.sources)),
+	}
+
+	for _, source := range s.sources {
+		data, err := source.Collect(userId)
+		if err != nil {
+			return nil, fmt.Errorf("collecting %s: %w", source.Name(), err)
+		}
+		export.Sections[source.Name()] = data
+	}
+
+	return export, nil
+}
+
+// Archive zips a built export into a single export.json file.
+func (s *ExportService) Archive(export *domain.UserExport) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	f, err := zw.Create("export.json")
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// --------------------- Sources ---------------------------- //
+
+// exportPageSize is how many records sources backed by a paginated listing
+// read at a time.
+const exportPageSize = 500
+
+// UserExportSource exports the user record itself, without the password hash.
+type UserExportSource struct {
+	userRepo repositories.UserRepositoryInterface
+}
+
+func NewUserExportSource(userRepo repositories.UserRepositoryInterface) *UserExportSource {
+	return &UserExportSource{userRepo: userRepo}
+}
+
+func (s *UserExportSource) Name() string {
+	return "user"
+}
+
+func (s *UserExportSource) Count(userId string) (int, error) {
+	return 1, nil
+}
+
+func (s *UserExportSource) Collect(userId string) (interface{}, error) {
+	user, err := s.userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+	return user.ToHTTPResponse(), nil
+}
+
+// TokenExportSource exports the scope and expiry of every token issued to the
+// user. Token hashes and plaintexts are never exported.
+type TokenExportSource struct {
+	tokenRepo repositories.TokenRepositoryInterface
+}
+
+func NewTokenExportSource(tokenRepo repositories.TokenRepositoryInterface) *TokenExportSource {
+	return &TokenExportSource{tokenRepo: tokenRepo}
+}
+
+func (s *TokenExportSource) Name() string {
+	return "tokens"
+}
+
+func (s *TokenExportSource) Count(userId string) (int, error) {
+	tokens, err := s.tokenRepo.GetAllForUser(userId)
+	if err != nil {
+		return 0, err
+	}
+	return len(tokens), nil
+}
+
+func (s *TokenExportSource) Collect(userId string) (interface{}, error) {
+	return s.tokenRepo.GetAllForUser(userId)
+}
+
+// OrganizationExportSource exports the organizations the user is a member of,
+// and their role in each.
+type OrganizationExportSource struct {
+	orgRepo repositories.OrganizationRepositoryInterface
+}
+
+func NewOrganizationExportSource(orgRepo repositories.OrganizationRepositoryInterface) *OrganizationExportSource {
+	return &OrganizationExportSource{orgRepo: orgRepo}
+}
+
+func (s *OrganizationExportSource) Name() string {
+	return "organizations"
+}
+
+func (s *OrganizationExportSource) Count(userId string) (int, error) {
+	orgs, err := s.orgRepo.GetForUser(userId)
+	if err != nil {
+		return 0, err
+	}
+	return len(orgs), nil
+}
+
+func (s *OrganizationExportSource) Collect(userId string) (interface{}, error) {
+	return s.orgRepo.GetForUser(userId)
+}
+
+// ImpersonationExportSource exports the impersonation sessions the user either
+// started or was the target of.
+type ImpersonationExportSource struct {
+	impersonationRepo repositories.ImpersonationRepositoryInterface
+}
+
+func NewImpersonationExportSource(impersonationRepo repositories.ImpersonationRepositoryInterface) *ImpersonationExportSource {
+	return &ImpersonationExportSource{impersonationRepo: impersonationRepo}
+}
+
+func (s *ImpersonationExportSource) Name() string {
+	return "impersonationSessions"
+}
+
+func (s *ImpersonationExportSource) Count(userId string) (int, error) {
+	sessions, err := s.impersonationRepo.GetAllForUser(userId)
+	if err != nil {
+		return 0, err
+	}
+	return len(sessions), nil
+}
+
+func (s *ImpersonationExportSource) Collect(userId string) (interface{}, error) {
+	return s.impersonationRepo.GetAllForUser(userId)
+}
+
+// AuditExportSource exports the audit events the user either did or was the
+// target of.
+type AuditExportSource struct {
+	auditRepo repositories.AuditRepositoryInterface
+}
+
+func NewAuditExportSource(auditRepo repositories.AuditRepositoryInterface) *AuditExportSource {
+	return &AuditExportSource{auditRepo: auditRepo}
+}
+
+func (s *AuditExportSource) Name() string {
+	return "auditEvents"
+}
+
+func (s *AuditExportSource) Count(userId string) (int, error) {
+	events, err := s.events(userId)
+	if err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+func (s *AuditExportSource) Collect(userId string) (interface{}, error) {
+	return s.events(userId)
+}
+
+func (s *AuditExportSource) events(userId string) ([]*domain.AuditEvent, error) {
+	events := []*domain.AuditEvent{}
+	filter := repositories.AuditFilter{UserID: userId, Limit: exportPageSize}
+	for {
+		page, next, err := s.auditRepo.List(filter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if next == nil {
+			return events, nil
+		}
+		filter.After = next
+	}
+}
+
+// DeviceExportSource exports the devices the user has signed in from. Device
+// fingerprints are never exported.
+type DeviceExportSource struct {
+	deviceRepo repositories.DeviceRepositoryInterface
+}
+
+func NewDeviceExportSource(deviceRepo repositories.DeviceRepositoryInterface) *DeviceExportSource {
+	return &DeviceExportSource{deviceRepo: deviceRepo}
+}
+
+func (s *DeviceExportSource) Name() string {
+	return "devices"
+}
+
+func (s *DeviceExportSource) Count(userId string) (int, error) {
+	devices, err := s.deviceRepo.GetAllForUser(userId)
+	if err != nil {
+		return 0, err
+	}
+	return len(devices), nil
+}
+
+func (s *DeviceExportSource) Collect(userId string) (interface{}, error) {
+	return s.deviceRepo.GetAllForUser(userId)
+}
+
+// LoginEventExportSource exports the user's sign in history.
+type LoginEventExportSource struct {
+	loginEventRepo repositories.LoginEventRepositoryInterface
+}
+
+func NewLoginEventExportSource(loginEventRepo repositories.LoginEventRepositoryInterface) *LoginEventExportSource {
+	return &LoginEventExportSource{loginEventRepo: loginEventRepo}
+}
+
+func (s *LoginEventExportSource) Name() string {
+	return "logins"
+}
+
+func (s *LoginEventExportSource) Count(userId string) (int, error) {
+	events, err := s.events(userId)
+	if err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+func (s *LoginEventExportSource) Collect(userId string) (interface{}, error) {
+	return s.events(userId)
+}
+
+func (s *LoginEventExportSource) events(userId string) ([]*domain.LoginEvent, error) {
+	events := []*domain.LoginEvent{}
+	var after *repositories.Cursor
+	for {
+		page, next, err := s.loginEventRepo.ListForUser(userId, exportPageSize, after)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if next == nil {
+			return events, nil
+		}
+		after = next
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/repositories"
+)
+
+type fakeExportSource struct {
+	name  string
+	count int
+	data  interface{}
+	err   error
+}
+
+func (s *fakeExportSource) Name() string                               { return s.name }
+func (s *fakeExportSource) Count(userId string) (int, error)           { return s.count, s.err }
+func (s *fakeExportSource) Collect(userId string) (interface{}, error) { return s.data, s.err }
+
+func TestExportServiceBuild(t *testing.T) {
+	userId := uuid.New()
+
+	service := NewExportService(
+		&fakeExportSource{name: "user", count: 1, data: map[string]string{"email": "email@email.com"}},
+		&fakeExportSource{name: "tokens", count: 3, data: []string{"a", "b", "c"}},
+	)
+
+	count, err := service.CountRecords(userId.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("want %d records; got %d", 4, count)
+	}
+
+	export, err := service.Build(userId.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.UserID != userId {
+		t.Errorf("want user id %s; got %s", userId, export.UserID)
+	}
+
+	for _, name := range []string{"user", "tokens"} {
+		if _, ok := export.Sections[name]; !ok {
+			t.Errorf("expected export to contain section %q", name)
+		}
+	}
+
+	// The archive should contain a single export.json file holding the export
+	archive, err := service.Archive(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "export.json" {
+		t.Fatalf("expected archive to only contain export.json")
+	}
+
+	f, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	body, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded domain.UserExport
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.UserID != userId {
+		t.Errorf("want archived user id %s; got %s", userId, decoded.UserID)
+	}
+}
+
+func TestExportServiceBuildSourceError(t *testing.T) {
+	wantErr := errors.New("source failed")
+	service := NewExportService(&fakeExportSource{name: "broken", err: wantErr})
+
+	_, err := service.Build(uuid.New().String())
+	if !errors.Is(err, wantErr) {
+		t.Errorf("want: %v; got %v", wantErr, err)
+	}
+}
+
+// pagedAuditRepository serves the events in pages of two.
+type pagedAuditRepository struct {
+	repositories.AuditRepositoryInterface
+	events []*domain.AuditEvent
+}
+
+func (r *pagedAuditRepository) List(filter repositories.AuditFilter) ([]*domain.AuditEvent, *repositories.Cursor, error) {
+	start := 0
+	if filter.After != nil {
+		fmt.Sscan(filter.After.ID, &start)
+	}
+	end := start + 2
+	if end >= len(r.events) {
+		return r.events[start:], nil, nil
+	}
+	return r.events[start:end], &repositories.Cursor{ID: fmt.Sprint(end)}, nil
+}
+
+func TestAuditExportSourceReadsEveryPage(t *testing.T) {
+	repo := &pagedAuditRepository{}
+	for i := 0; i < 5; i++ {
+		repo.events = append(repo.events, &domain.AuditEvent{ID: int64(i)})
+	}
+	source := NewAuditExportSource(repo)
+
+	count, err := source.Count("user-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("want %d events; got %d", 5, count)
+	}
+}
@@ -2,53 +2,150 @@ package services
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/todo-app/internal/audit"
 	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/geoip"
+	"github.com/todo-app/internal/hashing"
 	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/ipfilter"
 	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/pkg/logger"
 )
 
 type IdentityServiceInterface interface {
 	HandleLogin(req *identity.LoginRequest) (*domain.User, error)
+	HandleLoginConfirmation(req *identity.LoginConfirmationRequest) (*domain.User, error)
 	HandleRegister(potentialUser *domain.User) (*domain.User, error)
 	GetUserById(id string) (*domain.User, error)
+	HandleDeleteAccount(userId, password string) error
+	HandleImport(imported *domain.ImportUser) (*domain.User, error)
 }
 
 type IdentityService struct {
-	userRepo repositories.UserRepositoryInterface
+	userRepo    repositories.UserRepositoryInterface
+	tokenRepo   repositories.TokenRepositoryInterface
+	attemptRepo repositories.LoginAttemptRepositoryInterface
+	orgRepo     repositories.OrganizationRepositoryInterface
+	lockout     LockoutPolicy
+	// enumerationSafe makes every failed sign in take as long as a wrong
+	// password for an existing user, see SetEnumerationSafe.
+	enumerationSafe bool
+	auditLog        *audit.Log
+	loginEventRepo  repositories.LoginEventRepositoryInterface
+	geoIP           *geoip.Reader
+	risk            RiskPolicy
+	ipFilter        *ipfilter.Filter
 }
 
 func NewIdentityService(db *sqlx.DB) *IdentityService {
 	return &IdentityService{
-		userRepo: repositories.NewUserRepository(db),
+		userRepo:        repositories.NewUserRepository(db),
+		tokenRepo:       repositories.NewTokenRepository(db),
+		attemptRepo:     repositories.NewLoginAttemptRepository(db),
+		orgRepo:         repositories.NewOrganizationRepository(db),
+		lockout:         DefaultLockoutPolicy,
+		enumerationSafe: true,
+		auditLog:        audit.New(repositories.NewAuditRepository(db)),
+		loginEventRepo:  repositories.NewLoginEventRepository(db),
+		risk:            DefaultRiskPolicy,
 	}
 }
 
+// SetEnumerationSafe controls whether sign ins for unknown or locked accounts run
+// a dummy password comparison, so that how long a failed sign in takes doesn't
+// reveal whether the email address is registered. It is on by default.
+func (s *IdentityService) SetEnumerationSafe(safe bool) {
+	s.enumerationSafe = safe
+}
+
 // Handle login will return a token if login criteria is met, otherwise it will return an
-// error.
+// error. Failed attempts are counted per account and per IP address, and once
+// either is locked out an *identity.LockoutError is returned. Risky sign ins
+// return an *identity.ChallengeError until confirmed with HandleLoginConfirmation. Every attempt is
+// recorded in the audit log and the sign in history.
 func (s *IdentityService) HandleLogin(req *identity.LoginRequest) (*domain.User, error) {
+	user, err := s.handleLogin(req)
+	s.auditLogin(req, user, err)
+	s.recordLogin(req, user, err)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// handleLogin does the work of HandleLogin. Once it has found the account being
+// signed in to it returns it even when refusing the sign in, so the attempt can
+// be audited against it.
+func (s *IdentityService) handleLogin(req *identity.LoginRequest) (*domain.User, error) {
+	if err := s.checkIPLock(req.IP); err != nil {
+		return nil, err
+	}
+
 	// Does a user with this email exist? If not, respond with error
 	existingUser, err := s.userRepo.GetByEmail(req.Email)
 
 	if err != nil {
 		if errors.Is(err, repositories.ErrRecordNotFound) {
+			s.recordIPFailure(req.IP)
+			if s.enumerationSafe {
+				return nil, identity.CompareDummyPassword([]byte(req.Passsword))
+			}
 			return nil, identity.ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
+	// While the account is locked even the right password is refused, otherwise
+	// the lock wouldn't slow down guessing it.
+	if existingUser.IsLocked() {
+		s.recordIPFailure(req.IP)
+		if s.enumerationSafe {
+			identity.CompareDummyPassword([]byte(req.Passsword))
+		}
+		return existingUser, &identity.LockoutError{Until: existingUser.LockedUntil, Account: true}
+	}
+
 	// Compare the passwords of the stored user & the supplied password
-	err = identity.ComparePasswords([]byte(existingUser.Password), []byte(req.Passsword))
+	err = identity.ComparePasswords([]byte(existingUser.Password), []byte(req.Passsword), existingUser.PepperVersion)
 	// If passwords are same, we're good.
 
 	if err != nil {
-		return nil, identity.ErrInvalidCredentials
+		s.recordIPFailure(req.IP)
+		return existingUser, s.recordUserFailure(existingUser, req)
 	}
 
-	// Prevent them from logging in if they haven't activated their account.
-	if !existingUser.Activated {
-		return nil, identity.ErrUserNotActivated
+	if existingUser.FailedLoginAttempts > 0 {
+		if err := s.attemptRepo.ResetUser(existingUser.ID.String()); err != nil {
+			logger.Error.Printf("failed resetting failed sign ins for user %s: %v", existingUser.ID, err)
+		}
+		existingUser.FailedLoginAttempts = 0
+	}
+
+	// Now that we have the plaintext password and know it's correct, upgrade the
+	// stored hash if it was made with an outdated algorithm, work factor or pepper.
+	s.upgradePasswordHash(existingUser, req.Passsword)
+
+	// Prevent them from logging in unless their account is active, e.g. if they
+	// haven't activated it yet or it has been suspended.
+	if err := identity.CheckStatus(existingUser.Status); err != nil {
+		return existingUser, err
+	}
+
+	if existingUser.PasswordResetRequired {
+		return existingUser, identity.ErrPasswordResetRequired
+	}
+
+	if err := s.checkIP(existingUser, req.IP); err != nil {
+		return existingUser, err
+	}
+
+	// Sign ins that look risky, e.g. from a new country, have to be confirmed by
+	// email before they are signed in.
+	if err := s.checkRisk(existingUser, req); err != nil {
+		return existingUser, err
 	}
 
 	return existingUser, nil
@@ -77,8 +174,76 @@ func (s *IdentityService) HandleRegister(potentialUser *domain.User) (*domain.Us
 	return newUser, nil
 }
 
+// upgradePasswordHash rehashes the user's password with the current algorithm,
+// parameters and pepper if needed. A failure is only logged, it should never stop
+// a user with the right password from logging in.
+func (s *IdentityService) upgradePasswordHash(user *domain.User, password string) {
+	if !identity.PasswordNeedsRehash([]byte(user.Password), user.PepperVersion) {
+		return
+	}
+
+	hashed, err := identity.HashPassword([]byte(password))
+	if err != nil {
+		logger.Error.Printf("failed rehashing password for user %s: %v", user.ID, err)
+		return
+	}
+
+	previousPassword, previousPepper := user.Password, user.PepperVersion
+	user.Password = string(hashed)
+	user.PepperVersion = identity.PepperVersion()
+	if err := s.userRepo.Update(user); err != nil {
+		logger.Error.Printf("failed saving rehashed password for user %s: %v", user.ID, err)
+		user.Password, user.PepperVersion = previousPassword, previousPepper
+	}
+}
+
 func (s *IdentityService) GetUserById(id string) (*domain.User, error) {
 
 	return s.userRepo.GetById(id)
 
 }
+
+// HandleDeleteAccount permanently deletes the account of the given user. The
+// user must re-authenticate by supplying their current password, otherwise
+// identity.ErrInvalidCredentials is returned and nothing is deleted.
+func (s *IdentityService) HandleDeleteAccount(userId, password string) error {
+	user, err := s.userRepo.GetById(userId)
+	if err != nil {
+		return err
+	}
+
+	err = identity.ComparePasswords([]byte(user.Password), []byte(password), user.PepperVersion)
+	if err != nil {
+		return identity.ErrInvalidCredentials
+	}
+
+	return s.userRepo.Delete(user.ID.String())
+}
+
+// HandleImport creates a user migrated from another system. Their password hash
+// is stored as-is (converted to our encoding, which records the algorithm), so
+// they can sign in with their existing password. The first successful sign in
+// rehashes it with our current algorithm.
+func (s *IdentityService) HandleImport(imported *domain.ImportUser) (*domain.User, error) {
+	encoded, err := hashing.ConvertForeignHash(imported.HashFormat, imported.PasswordHash, imported.PasswordSalt)
+	if err != nil {
+		return nil, err
+	}
+	// Otherwise the user is created, but can never sign in with their password
+	if !hashing.Default().CanVerify(encoded) {
+		return nil, fmt.Errorf("%w: no verifier is configured for %s hashes", hashing.ErrUnknownAlgorithm, imported.HashFormat)
+	}
+
+	user := &domain.User{
+		FirstName: imported.FirstName,
+		LastName:  imported.LastName,
+		Email:     imported.Email,
+		Password:  encoded,
+	}
+	if imported.Activated {
+		user.Status = domain.StatusActive
+	}
+	user.Prepare()
+
+	return s.userRepo.Create(user)
+}
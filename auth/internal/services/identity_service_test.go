@@ -2,6 +2,7 @@ package services
 
 import (
 	_ "database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/hashing"
 	"github.com/todo-app/internal/identity"
 	"github.com/todo-app/internal/repositories"
 	"github.com/todo-app/testutil"
@@ -93,7 +95,7 @@ func TestHandleLogin(t *testing.T) {
 		LastName:  "Goodbye",
 		Email:     "email@email.com",
 		Password:  password,
-		Activated: true,
+		Status:    domain.StatusActive,
 	}, t)
 
 	if err != nil {
@@ -148,6 +150,237 @@ func TestHandleLogin(t *testing.T) {
 	testutil.TeardownUserTable(db, t)
 }
 
+// TestHandleLoginRehashesPassword should upgrade a password hashed with an outdated
+// algorithm to the current one once the user logs in with the right password.
+func TestHandleLoginRehashesPassword(t *testing.T) {
+	testutil.SetupUserTable(db)
+	service := NewIdentityService(db)
+
+	password := "supersecret"
+	legacyHash, err := hashing.NewBcrypt(hashing.DefaultBcryptCost).Hash([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := repositories.UserDBModel{
+		ID:        uuid.New(),
+		FirstName: "Hello",
+		LastName:  "Goodbye",
+		Email:     "legacy@email.com",
+		Password:  legacyHash,
+		Status:    domain.StatusActive,
+	}
+	_, err = db.NamedExec(`INSERT INTO users (id, first_name, last_name, email, password, status)
+	 VALUES (:id, :first_name, :last_name, :email, :password, :status)`, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.HandleLogin(&identity.LoginRequest{Email: model.Email, Passsword: password})
+	if err != nil {
+		t.Fatalf("failed login with error %v", err)
+	}
+
+	user, err := service.GetUserById(model.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := hashing.Identify(user.Password); got != hashing.Default().Current().ID() {
+		t.Errorf("want password rehashed with %q; got %q", hashing.Default().Current().ID(), got)
+	}
+
+	// The user must still be able to log in with the upgraded hash
+	_, err = service.HandleLogin(&identity.LoginRequest{Email: model.Email, Passsword: password})
+	if err != nil {
+		t.Errorf("failed login after rehash with error %v", err)
+	}
+
+	testutil.TeardownUserTable(db, t)
+}
+
+// TestHandleLoginRepeppersPassword should move a password hashed before a pepper
+// was configured onto the current pepper version once the user logs in.
+func TestHandleLoginRepeppersPassword(t *testing.T) {
+	testutil.SetupUserTable(db)
+	service := NewIdentityService(db)
+
+	password := "supersecret"
+	user := &domain.User{
+		FirstName: "Hello",
+		LastName:  "Goodbye",
+		Email:     "pepper@email.com",
+		Password:  password,
+		Status:    domain.StatusActive,
+	}
+	user.Prepare()
+	if _, err := service.HandleRegister(user); err != nil {
+		t.Fatal(err)
+	}
+
+	peppers, err := hashing.ParsePeppers("1:a-test-pepper-secret-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashing.Default().SetPeppers(peppers)
+	defer hashing.Default().SetPeppers(nil)
+
+	_, err = service.HandleLogin(&identity.LoginRequest{Email: user.Email, Passsword: password})
+	if err != nil {
+		t.Fatalf("failed login with error %v", err)
+	}
+
+	repeppered, err := service.GetUserById(user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repeppered.PepperVersion != 1 {
+		t.Errorf("want pepper version 1; got %d", repeppered.PepperVersion)
+	}
+
+	_, err = service.HandleLogin(&identity.LoginRequest{Email: user.Email, Passsword: password})
+	if err != nil {
+		t.Errorf("failed login after re-peppering with error %v", err)
+	}
+
+	testutil.TeardownUserTable(db, t)
+}
+
+// TestHandleLoginLocksAccount should lock an account after too many failed sign
+// ins in a row, refuse even the right password while locked, and only hand out an
+// unlock token on the attempt that locked it.
+func TestHandleLoginLocksAccount(t *testing.T) {
+	testutil.SetupUserTable(db)
+	testutil.SetupLoginTables(db)
+	service := NewIdentityService(db)
+	service.SetLockoutPolicy(LockoutPolicy{
+		AccountThreshold: 3,
+		IPThreshold:      100,
+		BaseDuration:     time.Minute,
+		MaxDuration:      time.Hour,
+		Window:           time.Hour,
+		UnlockTokenTTL:   time.Hour,
+	})
+
+	password := "supersecret"
+	user := &domain.User{
+		FirstName: "Hello",
+		LastName:  "Goodbye",
+		Email:     "locked@email.com",
+		Password:  password,
+		Status:    domain.StatusActive,
+	}
+	user.Prepare()
+	if _, err := service.HandleRegister(user); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := &identity.LoginRequest{Email: user.Email, Passsword: "wrong", IP: "192.0.2.1"}
+	for i := 0; i < 2; i++ {
+		if _, err := service.HandleLogin(wrong); !errors.Is(err, identity.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d want: %v; got %v", i+1, identity.ErrInvalidCredentials, err)
+		}
+	}
+
+	_, err := service.HandleLogin(wrong)
+	var lockErr *identity.LockoutError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("want a LockoutError; got %v", err)
+	}
+	if lockErr.UnlockToken == nil || lockErr.User == nil {
+		t.Errorf("expected an unlock token for the attempt that locked the account")
+	}
+
+	_, err = service.HandleLogin(&identity.LoginRequest{Email: user.Email, Passsword: password, IP: "192.0.2.1"})
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("want a LockoutError for the right password while locked; got %v", err)
+	}
+	if lockErr.UnlockToken != nil {
+		t.Errorf("expected no unlock token once the account was already locked")
+	}
+
+	testutil.TeardownLoginTables(db, t)
+	testutil.TeardownUserTable(db, t)
+}
+
+func TestLockDuration(t *testing.T) {
+	policy := LockoutPolicy{BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{9, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := policy.LockDuration(tt.failures, 5); got != tt.want {
+			t.Errorf("LockDuration(%d, 5) want: %s; got %s", tt.failures, tt.want, got)
+		}
+	}
+
+	if got := policy.LockDuration(100, 0); got != 0 {
+		t.Errorf("expected a threshold of 0 to disable lockout, got %s", got)
+	}
+}
+
+// TestHandleImport should create users with foreign password hashes that can
+// log in with their existing password, and are moved to our hashing algorithm
+// when they do.
+func TestHandleImport(t *testing.T) {
+	testutil.SetupUserTable(db)
+	service := NewIdentityService(db)
+
+	imported, err := service.HandleImport(&domain.ImportUser{
+		Email:        "django@email.com",
+		FirstName:    "Hello",
+		LastName:     "Goodbye",
+		HashFormat:   hashing.FormatDjango,
+		PasswordHash: "pbkdf2_sha256$260000$seasaltseasalt$c8aAVwqwSycDmSdHTVJz8BZs6T//o/0GzmL6O3LoXY0=",
+		Activated:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.HandleLogin(&identity.LoginRequest{Email: imported.Email, Passsword: "notthepassword"})
+	if err != identity.ErrInvalidCredentials {
+		t.Errorf("want: %v; got %v", identity.ErrInvalidCredentials, err)
+	}
+
+	_, err = service.HandleLogin(&identity.LoginRequest{Email: imported.Email, Passsword: "password"})
+	if err != nil {
+		t.Fatalf("failed login with error %v", err)
+	}
+
+	user, err := service.GetUserById(imported.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hashing.Identify(user.Password); got != hashing.Default().Current().ID() {
+		t.Errorf("want imported password rehashed with %q; got %q", hashing.Default().Current().ID(), got)
+	}
+
+	// Importing the same email twice should fail like registering twice does
+	_, err = service.HandleImport(&domain.ImportUser{
+		Email:        "django@email.com",
+		FirstName:    "Hello",
+		LastName:     "Goodbye",
+		HashFormat:   hashing.FormatMD5Crypt,
+		PasswordHash: "$1$abcdefgh$G//4keteveJp0qb8z2DxG/",
+	})
+	if err != repositories.ErrDuplicateEmail {
+		t.Errorf("want: %v; got %v", repositories.ErrDuplicateEmail, err)
+	}
+
+	testutil.TeardownUserTable(db, t)
+}
+
 // TestHandleRegistration should return the user object is registration
 // is successful and an error if not. There are many points where registration might fail e.g.
 // - request does not pass model validation (password requirement, invalid email, etc.)
@@ -220,7 +453,7 @@ func TestHandleRegistration(t *testing.T) {
 					LastName:  tt.User.LastName,
 					Email:     tt.User.Email,
 					Password:  tt.User.Password,
-					Activated: tt.User.Activated,
+					Status:    tt.User.Status,
 				})
 				if err != nil {
 					t.Errorf("Failed creating user before tests. Error: %v", err)
@@ -263,7 +496,7 @@ func TestGetUserById(t *testing.T) {
 				LastName:  "Goodbye",
 				Email:     "test1@gmail.com",
 				Password:  "hellohello",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 			wantErr: nil,
 		},
@@ -276,7 +509,7 @@ func TestGetUserById(t *testing.T) {
 				LastName:  "Hello",
 				Email:     "email3@gmail.com",
 				Password:  "asdfalsdkf",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 			wantErr: nil,
 		},
@@ -289,7 +522,7 @@ func TestGetUserById(t *testing.T) {
 				LastName:  "goooodbye",
 				Email:     "asdf@gmail.com",
 				Password:  "asdfasdf",
-				Activated: false,
+				Status:    domain.StatusPending,
 			},
 			wantErr: repositories.ErrRecordNotFound,
 		},
@@ -303,7 +536,7 @@ func TestGetUserById(t *testing.T) {
 				LastName:  tt.wantUser.LastName,
 				Email:     tt.wantUser.Email,
 				Password:  tt.wantUser.Password,
-				Activated: tt.wantUser.Activated,
+				Status:    tt.wantUser.Status,
 			}, t)
 
 			_, err := service.GetUserById(tt.userId)
@@ -318,6 +551,64 @@ func TestGetUserById(t *testing.T) {
 	testutil.TeardownUserTable(db, t)
 }
 
+// TestHandleDeleteAccount should only delete the account when the supplied
+// password matches the one stored for the user.
+func TestHandleDeleteAccount(t *testing.T) {
+	testutil.SetupUserTable(db)
+	service := NewIdentityService(db)
+
+	password := "supersecret"
+	createdUser, err := createTestUser(db, &repositories.UserDBModel{
+		ID:        uuid.New(),
+		FirstName: "Hello",
+		LastName:  "Goodbye",
+		Email:     "delete@email.com",
+		Password:  password,
+		Status:    domain.StatusActive,
+	}, t)
+	if err != nil {
+		t.Fatal("failed to create test user")
+	}
+
+	tests := []struct {
+		name     string
+		userId   string
+		password string
+		wantErr  error
+	}{
+		{
+			name:     "Wrong password",
+			userId:   createdUser.ID.String(),
+			password: "notthepassword",
+			wantErr:  identity.ErrInvalidCredentials,
+		},
+		{
+			name:     "Correct password",
+			userId:   createdUser.ID.String(),
+			password: password,
+			wantErr:  nil,
+		},
+		{
+			name:     "Already deleted",
+			userId:   createdUser.ID.String(),
+			password: password,
+			wantErr:  repositories.ErrRecordNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.HandleDeleteAccount(tt.userId, tt.password)
+
+			if err != tt.wantErr {
+				t.Errorf("want: %v; got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	testutil.TeardownUserTable(db, t)
+}
+
 // ---------------------  Helpers ---------------------------- //
 
 func createTestUser(db *sqlx.DB, model *repositories.UserDBModel, t *testing.T) (*domain.User, error) {
@@ -328,8 +619,8 @@ func createTestUser(db *sqlx.DB, model *repositories.UserDBModel, t *testing.T)
 	}
 
 	model.Password = string(newPass)
-	_, err = db.NamedExec(`INSERT INTO users (id, first_name, last_name, email, password, activated)
-	 VALUES (:id, :first_name, :last_name, :email, :password, :activated)`, model)
+	_, err = db.NamedExec(`INSERT INTO users (id, first_name, last_name, email, password, status)
+	 VALUES (:id, :first_name, :last_name, :email, :password, :status)`, model)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/hashing"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/validator"
+)
+
+// ImportResult is the outcome of importing a single user.
+type ImportResult struct {
+	Email   string            `json:"email"`
+	Created bool              `json:"created"`
+	ID      *uuid.UUID        `json:"id,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// ImportUsers validates and imports each user in turn. A user that fails to
+// import doesn't stop the rest, the outcome of every user is reported in the
+// returned results, in the same order. Only unexpected errors (e.g. the database
+// going away) are returned as an error, along with the results so far.
+func ImportUsers(service IdentityServiceInterface, users []*domain.ImportUser) ([]ImportResult, error) {
+	results := make([]ImportResult, 0, len(users))
+
+	for _, imported := range users {
+		imported.Prepare()
+		result := ImportResult{Email: imported.Email}
+
+		v := validator.New()
+		if domain.ValidateImportUser(v, imported); !v.Valid() {
+			result.Errors = v.Errors
+			results = append(results, result)
+			continue
+		}
+
+		user, err := service.HandleImport(imported)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrDuplicateEmail):
+				v.AddError("email", err.Error())
+			case errors.Is(err, hashing.ErrInvalidHash):
+				v.AddError("passwordHash", err.Error())
+			case errors.Is(err, hashing.ErrUnknownAlgorithm):
+				v.AddError("hashFormat", err.Error())
+			default:
+				return results, err
+			}
+			result.Errors = v.Errors
+			results = append(results, result)
+			continue
+		}
+
+		result.Created = true
+		result.ID = &user.ID
+		results = append(results, result)
+	}
+
+	return results, nil
+}
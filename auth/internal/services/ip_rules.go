@@ -0,0 +1,33 @@
+package services
+
+import (
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/ipfilter"
+)
+
+// SetIPFilter sets the IP rules sign ins are checked against. By default there
+// are none.
+func (s *IdentityService) SetIPFilter(filter *ipfilter.Filter) {
+	s.ipFilter = filter
+}
+
+// checkIP returns ipfilter.ErrNotAllowed unless the IP address is allowed by the
+// rules of the whole service and of the organization the user is signed in to,
+// their oldest membership, so that organizations can keep their members to
+// signing in from their own networks. The rules of their other organizations
+// apply once they switch to them.
+func (s *IdentityService) checkIP(user *domain.User, ip string) error {
+	if s.ipFilter == nil {
+		return nil
+	}
+
+	orgs, err := s.orgRepo.GetForUser(user.ID.String())
+	if err != nil {
+		return err
+	}
+
+	if len(orgs) == 0 {
+		return s.ipFilter.Check(ip)
+	}
+	return s.ipFilter.Check(ip, orgs[0].ID.String())
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/ipfilter"
+	"github.com/todo-app/internal/repositories"
+)
+
+type fakeRuleSource []*domain.IPRule
+
+func (s fakeRuleSource) GetAll() ([]*domain.IPRule, error) { return s, nil }
+
+// memberships lists the organizations of every user, oldest membership first.
+type memberships struct {
+	repositories.OrganizationRepositoryInterface
+	orgs []*domain.Organization
+}
+
+func (m memberships) GetForUser(userId string) ([]*domain.Organization, error) {
+	return m.orgs, nil
+}
+
+func TestCheckIP(t *testing.T) {
+	home := &domain.Organization{ID: uuid.New(), Name: "Home"}
+	other := &domain.Organization{ID: uuid.New(), Name: "Other"}
+
+	s := &IdentityService{orgRepo: memberships{orgs: []*domain.Organization{home, other}}}
+	s.SetIPFilter(ipfilter.New(fakeRuleSource{
+		{CIDR: "198.51.100.7/32", Action: domain.IPRuleDeny},
+		{OrganizationID: home.ID.String(), CIDR: "203.0.113.0/24", Action: domain.IPRuleAllow},
+		{OrganizationID: other.ID.String(), CIDR: "192.0.2.0/24", Action: domain.IPRuleAllow},
+	}, time.Minute))
+	user := &domain.User{ID: uuid.New()}
+
+	tests := []struct {
+		name    string
+		ip      string
+		wantErr error
+	}{
+		// The user signs in to their oldest membership, so only its rules apply
+		{"In the signed in org's allowlist", "203.0.113.5", nil},
+		{"Only in another org's allowlist", "192.0.2.1", ipfilter.ErrNotAllowed},
+		{"Denied everywhere", "198.51.100.7", ipfilter.ErrNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.checkIP(user, tt.ip)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
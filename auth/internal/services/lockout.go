@@ -0,0 +1,143 @@
+package services
+
+import (
+	"time"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/pkg/logger"
+)
+
+// LockoutPolicy controls how failed sign in attempts are throttled. Once an account
+// or IP address reaches its threshold of failures in a row, it is locked for
+// BaseDuration, and every further failure doubles the lock up to MaxDuration.
+// A threshold of 0 disables that kind of lockout.
+type LockoutPolicy struct {
+	AccountThreshold int
+	IPThreshold      int
+	BaseDuration     time.Duration
+	MaxDuration      time.Duration
+	// Window is how long a failure is remembered for. A failure after a quiet
+	// period longer than Window starts counting from 1 again.
+	Window time.Duration
+	// UnlockTokenTTL is how long the unlock link emailed to a locked out user works.
+	UnlockTokenTTL time.Duration
+}
+
+var DefaultLockoutPolicy = LockoutPolicy{
+	AccountThreshold: 5,
+	IPThreshold:      20,
+	BaseDuration:     time.Minute,
+	MaxDuration:      24 * time.Hour,
+	Window:           24 * time.Hour,
+	UnlockTokenTTL:   24 * time.Hour,
+}
+
+// LockDuration returns how long to lock for after the given number of failures in
+// a row, 0 if the threshold hasn't been reached.
+func (p LockoutPolicy) LockDuration(failures, threshold int) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+
+	lock := p.BaseDuration
+	for i := threshold; i < failures && lock < p.MaxDuration; i++ {
+		lock *= 2
+	}
+	if lock > p.MaxDuration {
+		lock = p.MaxDuration
+	}
+	return lock
+}
+
+// SetLockoutPolicy replaces DefaultLockoutPolicy for this service.
+func (s *IdentityService) SetLockoutPolicy(p LockoutPolicy) {
+	s.lockout = p
+}
+
+// checkIPLock returns a LockoutError if sign ins from the IP address are locked.
+func (s *IdentityService) checkIPLock(ip string) error {
+	if ip == "" || s.lockout.IPThreshold <= 0 {
+		return nil
+	}
+
+	until, err := s.attemptRepo.IPLockedUntil(ip)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(until) {
+		return &identity.LockoutError{Until: until}
+	}
+	return nil
+}
+
+// recordIPFailure counts a failed sign in from the IP address, locking it once
+// it reaches the threshold. Errors are only logged, they shouldn't change the
+// response to a failed sign in.
+func (s *IdentityService) recordIPFailure(ip string) {
+	if ip == "" || s.lockout.IPThreshold <= 0 {
+		return
+	}
+
+	failures, err := s.attemptRepo.RecordIPFailure(ip, s.lockout.Window)
+	if err != nil {
+		logger.Error.Printf("failed recording failed sign in from %s: %v", ip, err)
+		return
+	}
+
+	if lock := s.lockout.LockDuration(failures, s.lockout.IPThreshold); lock > 0 {
+		logger.Info.Printf("locking sign ins from %s for %s after %d failures", ip, lock, failures)
+		if err := s.attemptRepo.LockIP(ip, time.Now().Add(lock)); err != nil {
+			logger.Error.Printf("failed locking sign ins from %s: %v", ip, err)
+		}
+	}
+}
+
+// recordUserFailure counts a failed sign in for the user, locking the account
+// once it reaches the threshold. It returns a LockoutError if the account is now
+// locked, with an unlock token the first time it gets locked.
+func (s *IdentityService) recordUserFailure(user *domain.User, req *identity.LoginRequest) error {
+	if s.lockout.AccountThreshold <= 0 {
+		return identity.ErrInvalidCredentials
+	}
+
+	failures, err := s.attemptRepo.RecordUserFailure(user.ID.String(), s.lockout.Window)
+	if err != nil {
+		return err
+	}
+
+	lock := s.lockout.LockDuration(failures, s.lockout.AccountThreshold)
+	if lock == 0 {
+		return identity.ErrInvalidCredentials
+	}
+
+	until := time.Now().Add(lock)
+	logger.Info.Printf("locking user %s for %s after %d failed sign ins", user.ID, lock, failures)
+	if err := s.attemptRepo.LockUser(user.ID.String(), until); err != nil {
+		return err
+	}
+	s.auditLog.Record(loginAuditEvent(req, domain.AuditAccountLocked).
+		SetTarget(user).
+		With("failures", failures).
+		With("locked_until", until))
+
+	lockErr := &identity.LockoutError{Until: until, Account: true}
+
+	// Only email the user when the account first gets locked, not every time a
+	// further failure extends the lock.
+	if failures == s.lockout.AccountThreshold {
+		err := s.tokenRepo.DeleteAllForUser(domain.TokenScopeUnlock, user.ID.String())
+		if err != nil {
+			return err
+		}
+
+		token, err := s.tokenRepo.New(user.ID.String(), s.lockout.UnlockTokenTTL, domain.TokenScopeUnlock)
+		if err != nil {
+			return err
+		}
+		lockErr.User = user
+		lockErr.UnlockToken = token
+	}
+
+	return lockErr
+}
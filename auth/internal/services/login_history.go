@@ -0,0 +1,50 @@
+package services
+
+import (
+	"github.com/todo-app/internal/device"
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/geoip"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/pkg/logger"
+)
+
+// SetGeoIP sets the database sign ins are located with for the sign in history.
+// Without one, sign ins are recorded without a location.
+func (s *IdentityService) SetGeoIP(reader *geoip.Reader) {
+	s.geoIP = reader
+}
+
+// recordLogin adds a sign in attempt to the sign in history. Failing to record
+// it doesn't fail the sign in.
+func (s *IdentityService) recordLogin(req *identity.LoginRequest, user *domain.User, err error) {
+	d := device.Identify(req.UserAgent, req.IP)
+	event := &domain.LoginEvent{
+		Email:     req.Email,
+		Succeeded: err == nil,
+		IP:        req.IP,
+		UserAgent: req.UserAgent,
+		Browser:   d.Browser,
+		OS:        d.OS,
+	}
+	if user != nil {
+		event.UserID = user.ID.String()
+	}
+	if err != nil {
+		event.FailureReason = loginFailureReason(err)
+	}
+
+	event.Location = s.locate(req.IP)
+
+	if err := s.loginEventRepo.Insert(event); err != nil {
+		logger.Error.Printf("failed recording sign in for %s: %v", req.Email, err)
+	}
+}
+
+// locate returns where the IP address is, or nil if it can't be located.
+func (s *IdentityService) locate(ip string) *domain.GeoLocation {
+	location, err := s.geoIP.Lookup(ip)
+	if err != nil {
+		logger.Error.Printf("failed locating %s: %v", ip, err)
+	}
+	return location
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/todo-app/internal/domain"
+	"github.com/todo-app/internal/identity"
+	"github.com/todo-app/internal/repositories"
+	"github.com/todo-app/internal/risk"
+)
+
+// riskHistorySize is how many of the user's last sign ins an attempt is
+// compared with.
+const riskHistorySize = 50
+
+// RiskPolicy controls which sign ins have to be confirmed by email. A sign in
+// with the right password that Engine scores at or above Threshold isn't signed
+// in until the user confirms it with the token they are emailed. A nil Engine or
+// a Threshold of 0 disables confirmations.
+type RiskPolicy struct {
+	Engine    *risk.Engine
+	Threshold int
+	// ConfirmationTTL is how long the emailed confirmation token works.
+	ConfirmationTTL time.Duration
+}
+
+// DefaultRiskPolicy confirms no sign ins, as it has no rules to score them with.
+var DefaultRiskPolicy = RiskPolicy{
+	ConfirmationTTL: 15 * time.Minute,
+}
+
+// SetRiskPolicy replaces DefaultRiskPolicy for this service.
+func (s *IdentityService) SetRiskPolicy(p RiskPolicy) {
+	s.risk = p
+}
+
+// checkRisk scores the user's sign in, and returns a ChallengeError with a
+// confirmation token if it is too risky to sign them in straight away.
+func (s *IdentityService) checkRisk(user *domain.User, req *identity.LoginRequest) error {
+	if s.risk.Engine == nil || s.risk.Threshold <= 0 {
+		return nil
+	}
+
+	history, err := s.loginEventRepo.ListRecentSucceeded(user.ID.String(), riskHistorySize)
+	if err != nil {
+		return err
+	}
+
+	location := s.locate(req.IP)
+	assessment := s.risk.Engine.Assess(&risk.Attempt{
+		IP:       req.IP,
+		Location: location,
+		Time:     time.Now(),
+		History:  history,
+	})
+	if assessment.Score < s.risk.Threshold {
+		return nil
+	}
+
+	s.auditLog.Record(loginAuditEvent(req, domain.AuditLoginChallenged).
+		SetTarget(user).
+		With("score", assessment.Score).
+		With("signals", assessment.Signals))
+
+	err = s.tokenRepo.DeleteAllForUser(domain.TokenScopeConfirmLogin, user.ID.String())
+	if err != nil {
+		return err
+	}
+
+	token, err := s.tokenRepo.New(user.ID.String(), s.risk.ConfirmationTTL, domain.TokenScopeConfirmLogin)
+	if err != nil {
+		return err
+	}
+	return &identity.ChallengeError{User: user, Token: token, Location: location}
+}
+
+// HandleLoginConfirmation signs in the user a challenged sign in was for, once
+// they confirm it with the token they were emailed. The sign in is checked again
+// in case the account changed since, but not scored again.
+func (s *IdentityService) HandleLoginConfirmation(req *identity.LoginConfirmationRequest) (*domain.User, error) {
+	user, err := s.userRepo.GetForToken(domain.TokenScopeConfirmLogin, req.Token)
+	if err != nil {
+		if errors.Is(err, repositories.ErrRecordNotFound) {
+			return nil, identity.ErrInvalidConfirmationToken
+		}
+		return nil, err
+	}
+
+	loginReq := &identity.LoginRequest{
+		Email:     user.Email,
+		IP:        req.IP,
+		UserAgent: req.UserAgent,
+		RequestID: req.RequestID,
+	}
+
+	err = s.checkConfirmedLogin(user, req.IP)
+	if err == nil {
+		err = s.tokenRepo.DeleteAllForUser(domain.TokenScopeConfirmLogin, user.ID.String())
+	}
+	if err == nil {
+		s.auditLog.Record(loginAuditEvent(loginReq, domain.AuditLoginConfirmed).SetTarget(user))
+	}
+	s.auditLogin(loginReq, user, err)
+	s.recordLogin(loginReq, user, err)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkConfirmedLogin returns why the user can't be signed in any more, if the
+// account was locked or changed since the sign in was challenged, or they are
+// confirming it from an address that isn't allowed.
+func (s *IdentityService) checkConfirmedLogin(user *domain.User, ip string) error {
+	if user.IsLocked() {
+		return &identity.LockoutError{Until: user.LockedUntil, Account: true}
+	}
+	if err := identity.CheckStatus(user.Status); err != nil {
+		return err
+	}
+	if user.PasswordResetRequired {
+		return identity.ErrPasswordResetRequired
+	}
+	return s.checkIP(user, ip)
+}
@@ -0,0 +1,320 @@
+package validator
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is a short list of the most frequently used passwords. It is
+// always part of the blocklist, and can be extended with a file of our own.
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Password violation codes. A violation is added to the validator errors under
+// the key "<field>.<code>", e.g. "password.minLength", so clients can tell every
+// failed rule apart rather than getting a single message back.
+const (
+	PasswordMinLength = "minLength"
+	PasswordMaxLength = "maxLength"
+	PasswordUppercase = "uppercase"
+	PasswordLowercase = "lowercase"
+	PasswordDigit     = "digit"
+	PasswordSymbol    = "symbol"
+	PasswordCommon    = "common"
+	PasswordSimilar   = "similar"
+	PasswordWeak      = "weak"
+	PasswordBreached  = "breached"
+)
+
+// Strength scores returned by PasswordStrength, loosely following the 0-4 scale
+// most password meters use.
+const (
+	StrengthVeryWeak = iota
+	StrengthWeak
+	StrengthFair
+	StrengthStrong
+	StrengthVeryStrong
+)
+
+// BreachChecker reports whether a password is known to have been exposed in a
+// data breach.
+type BreachChecker interface {
+	Contains(password string) bool
+}
+
+// PasswordPolicy holds the rules every new password has to satisfy.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes, when set, limits the length of the password in bytes, for
+	// hashing algorithms such as bcrypt that ignore anything past a byte limit.
+	MaxBytes      int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// MinStrength is the lowest score from PasswordStrength that is accepted.
+	MinStrength int
+	// Breached, when set, rejects passwords found in a corpus of breached passwords.
+	Breached  BreachChecker
+	blocklist map[string]struct{}
+}
+
+// PasswordViolation is a single rule a password failed to meet.
+type PasswordViolation struct {
+	Code    string
+	Message string
+}
+
+// NewPasswordPolicy returns a policy with the given length limits and the
+// built in blocklist of common passwords. The remaining rules can be set on the
+// returned struct directly.
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	p := &PasswordPolicy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		blocklist: make(map[string]struct{}),
+	}
+	p.addToBlocklist(strings.NewReader(commonPasswords))
+	return p
+}
+
+// LoadBlocklist adds every password in the file at path (one per line) to the
+// blocklist. Comparisons are case-insensitive.
+func (p *PasswordPolicy) LoadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.addToBlocklist(f)
+}
+
+func (p *PasswordPolicy) addToBlocklist(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Validate checks password against the policy and adds every violation to v under
+// the key "<key>.<code>". Personal details of the user (name, email, ...) can be
+// passed in so that passwords that are too similar to them are rejected.
+func (p *PasswordPolicy) Validate(v *Validator, key, password string, personal ...string) {
+	for _, violation := range p.Check(password, personal...) {
+		v.AddError(key+"."+violation.Code, violation.Message)
+	}
+}
+
+// Check returns every rule the password fails to meet. An empty slice means the
+// password is acceptable.
+func (p *PasswordPolicy) Check(password string, personal ...string) []PasswordViolation {
+	violations := []PasswordViolation{}
+	add := func(code, message string) {
+		violations = append(violations, PasswordViolation{Code: code, Message: message})
+	}
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		add(PasswordMinLength, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	switch {
+	case p.MaxLength > 0 && length > p.MaxLength:
+		add(PasswordMaxLength, fmt.Sprintf("must not be more than %d characters", p.MaxLength))
+	case p.MaxBytes > 0 && len(password) > p.MaxBytes:
+		add(PasswordMaxLength, fmt.Sprintf("must not be more than %d bytes", p.MaxBytes))
+	}
+
+	classes := characterClasses(password)
+	if p.RequireUpper && !classes.upper {
+		add(PasswordUppercase, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !classes.lower {
+		add(PasswordLowercase, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !classes.digit {
+		add(PasswordDigit, "must contain a number")
+	}
+	if p.RequireSymbol && !classes.symbol {
+		add(PasswordSymbol, "must contain a symbol")
+	}
+
+	if _, blocked := p.blocklist[strings.ToLower(password)]; blocked {
+		add(PasswordCommon, "is too common")
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		add(PasswordBreached, "has appeared in a data breach and can't be used")
+	}
+
+	if isSimilar(password, personal) {
+		add(PasswordSimilar, "is too similar to your name or email")
+	}
+
+	if PasswordStrength(password) < p.MinStrength {
+		add(PasswordWeak, "is too easy to guess")
+	}
+
+	return violations
+}
+
+type classSet struct {
+	upper, lower, digit, symbol bool
+}
+
+func characterClasses(password string) classSet {
+	var c classSet
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			c.upper = true
+		case unicode.IsLower(r):
+			c.lower = true
+		case unicode.IsDigit(r):
+			c.digit = true
+		default:
+			c.symbol = true
+		}
+	}
+	return c
+}
+
+// PasswordEntropy estimates the entropy of a password in bits. It starts from
+// the size of the character pool the password draws from, and only counts
+// characters that aren't a repeat of, or a step in a sequence with, the one
+// before, so "aaaaaaaa" or "12345678" score far lower than their length suggests.
+func PasswordEntropy(password string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	classes := characterClasses(password)
+	pool := 0
+	if classes.lower {
+		pool += 26
+	}
+	if classes.upper {
+		pool += 26
+	}
+	if classes.digit {
+		pool += 10
+	}
+	if classes.symbol {
+		pool += 33
+	}
+
+	effective := 1.0
+	for i := 1; i < len(runes); i++ {
+		diff := runes[i] - runes[i-1]
+		switch {
+		case diff == 0:
+			// Repeated characters add very little
+			effective += 0.25
+		case diff == 1 || diff == -1:
+			// So do sequences such as "abc" or "321"
+			effective += 0.5
+		default:
+			effective++
+		}
+	}
+
+	return effective * math.Log2(float64(pool))
+}
+
+// PasswordStrength scores a password from StrengthVeryWeak (0) to
+// StrengthVeryStrong (4) based on its estimated entropy.
+func PasswordStrength(password string) int {
+	bits := PasswordEntropy(password)
+	switch {
+	case bits < 28:
+		return StrengthVeryWeak
+	case bits < 36:
+		return StrengthWeak
+	case bits < 60:
+		return StrengthFair
+	case bits < 128:
+		return StrengthStrong
+	default:
+		return StrengthVeryStrong
+	}
+}
+
+// isSimilar reports whether the password contains, is contained in, or is only a
+// couple of edits away from any of the personal values. For email addresses the
+// local part is checked as well. An empty password is contained in everything,
+// so it is left to the length rule.
+func isSimilar(password string, personal []string) bool {
+	if password == "" {
+		return false
+	}
+	pw := strings.ToLower(password)
+
+	values := []string{}
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		values = append(values, value)
+		if at := strings.Index(value, "@"); at > 0 {
+			values = append(values, value[:at])
+		}
+	}
+
+	for _, value := range values {
+		// Ignore very short values such as initials, they'd reject far too much.
+		if len([]rune(value)) < 3 {
+			continue
+		}
+		if strings.Contains(pw, value) || strings.Contains(value, pw) {
+			return true
+		}
+		if levenshtein(pw, value) <= 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// levenshtein returns the number of single character edits needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,166 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := NewPasswordPolicy(10, 72)
+	policy.RequireUpper = true
+	policy.RequireDigit = true
+	policy.MinStrength = StrengthFair
+
+	tests := []struct {
+		name     string
+		password string
+		personal []string
+		want     []string
+	}{
+		{
+			name:     "Valid password",
+			password: "Correct7Horse-Battery",
+			personal: []string{"Jane", "Doe", "jane@email.com"},
+			want:     []string{},
+		},
+		{
+			name:     "Too short",
+			password: "Ab3$xZ",
+			want:     []string{PasswordMinLength},
+		},
+		{
+			name:     "Too long",
+			password: strings.Repeat("xQ7#", 20),
+			want:     []string{PasswordMaxLength},
+		},
+		{
+			name:     "Missing character classes",
+			password: "correct-horse-battery",
+			want:     []string{PasswordUppercase, PasswordDigit},
+		},
+		{
+			name:     "Common password",
+			password: "Password123",
+			want:     []string{PasswordCommon},
+		},
+		{
+			name:     "Contains email local part",
+			password: "Janedoe1984!",
+			personal: []string{"Jane", "Doe", "janedoe@email.com"},
+			want:     []string{PasswordSimilar},
+		},
+		{
+			name:     "Empty password",
+			password: "",
+			personal: []string{"Jane", "Doe", "jane@email.com"},
+			want:     []string{PasswordMinLength, PasswordUppercase, PasswordDigit, PasswordWeak},
+		},
+		{
+			name:     "Repetitive password",
+			password: "Aaaaaaaaaaaaa1",
+			want:     []string{PasswordWeak},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := policy.Check(tt.password, tt.personal...)
+
+			got := make(map[string]bool)
+			for _, v := range violations {
+				got[v.Code] = true
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("want violations %v; got %+v", tt.want, violations)
+			}
+			for _, code := range tt.want {
+				if !got[code] {
+					t.Errorf("expected violation %q; got %+v", code, violations)
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyMaxBytes(t *testing.T) {
+	policy := NewPasswordPolicy(10, 128)
+	policy.MaxBytes = 72
+
+	// 40 characters, but 80 bytes
+	password := strings.Repeat("é", 40)
+	violations := policy.Check(password)
+	if len(violations) != 1 || violations[0].Code != PasswordMaxLength {
+		t.Errorf("want violation %q; got %+v", PasswordMaxLength, violations)
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := NewPasswordPolicy(10, 72)
+	v := New()
+
+	policy.Validate(v, "password", "short")
+
+	if v.Valid() {
+		t.Fatal("expected validator to contain errors")
+	}
+	if _, ok := v.Errors["password."+PasswordMinLength]; !ok {
+		t.Errorf("expected error under %q; got %v", "password."+PasswordMinLength, v.Errors)
+	}
+}
+
+func TestPasswordPolicyLoadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	err := os.WriteFile(path, []byte("# company specific\nAcmeCorp2021!\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := NewPasswordPolicy(10, 72)
+	if err := policy.LoadBlocklist(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range policy.Check("acmecorp2021!") {
+		if v.Code == PasswordCommon {
+			return
+		}
+	}
+	t.Errorf("expected password from the blocklist file to be rejected")
+}
+
+type fakeBreachChecker map[string]bool
+
+func (f fakeBreachChecker) Contains(password string) bool { return f[password] }
+
+func TestPasswordPolicyBreached(t *testing.T) {
+	policy := NewPasswordPolicy(10, 72)
+	policy.Breached = fakeBreachChecker{"Correct7Horse-Battery": true}
+
+	violations := policy.Check("Correct7Horse-Battery")
+	if len(violations) != 1 || violations[0].Code != PasswordBreached {
+		t.Errorf("want a single %q violation; got %+v", PasswordBreached, violations)
+	}
+}
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"", StrengthVeryWeak},
+		{"aaaaaaaa", StrengthVeryWeak},
+		{"12345678", StrengthVeryWeak},
+		{"correcthorse", StrengthFair},
+		{"Tr0ub4dor&3", StrengthStrong},
+		{"Tr0ub4dor&3-staple-Horse", StrengthVeryStrong},
+	}
+
+	for _, tt := range tests {
+		if got := PasswordStrength(tt.password); got != tt.want {
+			t.Errorf("PasswordStrength(%q) = %d; want %d (%.1f bits)", tt.password, got, tt.want, PasswordEntropy(tt.password))
+		}
+	}
+}
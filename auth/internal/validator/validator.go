@@ -5,6 +5,12 @@ import (
 )
 
 var (
+	// IdentifierRX matches lowercase identifiers such as "support" or "billing-admin"
+	IdentifierRX = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	// PermissionRX matches permission names such as "users:read"
+	PermissionRX = regexp.MustCompile(`^[a-z][a-z0-9_-]*:[a-z][a-z0-9_-]*$`)
+	// SlugRX matches URL friendly names such as "acme-inc"
+	SlugRX  = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
@@ -46,11 +46,18 @@ func main() {
 		}
 	}()
 
+	app.AuditCheckpointer.Start()
+
 	exithandler.Init(func() {
 		if err := srv.Close(); err != nil {
 			log.Println(err.Error())
 		}
 
+		app.AuditCheckpointer.Stop()
+		if err := app.AuditLog.Close(); err != nil {
+			logger.Error.Println(err.Error())
+		}
+
 		if err := app.CloseDBConn(); err != nil {
 			logger.Error.Println(err.Error())
 		}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 )
 
 type Confg struct {
@@ -25,6 +26,102 @@ type Confg struct {
 		Password string
 		Sender   string
 	}
+	Export struct {
+		AsyncThreshold int
+	}
+	PasswordPolicy struct {
+		MinLength     int
+		MaxLength     int
+		RequireUpper  bool
+		RequireLower  bool
+		RequireDigit  bool
+		RequireSymbol bool
+		MinStrength   int
+		BlocklistFile string
+		BreachFilter  string
+	}
+	PasswordHashing struct {
+		Algorithm         string
+		BcryptCost        int
+		Argon2Memory      int
+		Argon2Iterations  int
+		Argon2Parallelism int
+		ScryptLogN        int
+		ScryptR           int
+		ScryptP           int
+		// Parameters of the Firebase project users are imported from
+		FirebaseSignerKey     string
+		FirebaseSaltSeparator string
+		FirebaseRounds        int
+		FirebaseMemCost       int
+		// Versioned secret peppers, either inline or in a file, in the form
+		// "<version>:<secret>". The highest version is used for new hashes.
+		Peppers    string
+		PepperFile string
+	}
+	Lockout struct {
+		AccountThreshold int
+		IPThreshold      int
+		BaseDuration     time.Duration
+		MaxDuration      time.Duration
+		Window           time.Duration
+	}
+	// EnumerationSafe makes responses the same, in content and timing, whether or
+	// not an email address is registered.
+	EnumerationSafe struct {
+		Enabled         bool
+		MinResponseTime time.Duration
+	}
+	Impersonation struct {
+		TTL time.Duration
+	}
+	// Checkpoints of the audit log are signed with an ed25519 key, and aren't
+	// made when there is no key. Events can also be sent to a syslog server and
+	// appended to a file, each as JSON or CEF.
+	Audit struct {
+		SigningKeyFile     string
+		CheckpointInterval time.Duration
+		Syslog             string
+		SyslogFormat       string
+		File               string
+		FileFormat         string
+		FileMaxSize        int
+		FileMaxBackups     int
+	}
+	// Sign ins are located with a MaxMind database, e.g. GeoLite2-City.mmdb, and
+	// recorded without a location when there is none.
+	GeoIP struct {
+		Database string
+	}
+	// TrustedProxies are the CIDR ranges of the proxies in front of the service,
+	// whose ClientIPHeader is believed, as a comma separated list.
+	TrustedProxies string
+	// ClientIPHeader is the header the trusted proxies record the client's
+	// address in, one of forwarded, x-forwarded-for or x-real-ip. The others are
+	// passed through by the proxies as the client sent them, so are never read.
+	ClientIPHeader string
+	// Sign ins with the right password are scored by each rule with a score above
+	// 0, and have to be confirmed by email once the total reaches Threshold.
+	// A Threshold of 0 disables confirmations.
+	Risk struct {
+		Threshold             int
+		NewCountryScore       int
+		ImpossibleTravelScore int
+		ImpossibleTravelSpeed float64
+		IPList                string
+		IPListScore           int
+		UnusualHourScore      int
+	}
+	// Rates are in the form "<limit>/<period>", e.g. "3/1h". "0" disables a limit.
+	RateLimit struct {
+		Store            string
+		Signin           string
+		Register         string
+		PasswordReset    string
+		PasswordResetIP  string
+		ActivationResend string
+		Export           string
+	}
 }
 
 const version string = "1.0.0"
@@ -48,6 +145,63 @@ func Get() *Confg {
 	flag.StringVar(&c.Smtp.Username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMPT username")
 	flag.StringVar(&c.Smtp.Password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&c.Smtp.Sender, "smtp-sender", "App With No Name <no-reply@nonameapp.aaronvk.com>", "SMTP sender email address")
+	flag.IntVar(&c.Export.AsyncThreshold, "export-async-threshold", 500, "Number of records above which a data export is generated in the background and emailed")
+	flag.IntVar(&c.PasswordPolicy.MinLength, "password-min-length", 10, "Minimum number of characters in a password")
+	flag.IntVar(&c.PasswordPolicy.MaxLength, "password-max-length", 128, "Maximum number of characters in a password")
+	flag.BoolVar(&c.PasswordPolicy.RequireUpper, "password-require-upper", false, "Require passwords to contain an uppercase letter")
+	flag.BoolVar(&c.PasswordPolicy.RequireLower, "password-require-lower", false, "Require passwords to contain a lowercase letter")
+	flag.BoolVar(&c.PasswordPolicy.RequireDigit, "password-require-digit", false, "Require passwords to contain a number")
+	flag.BoolVar(&c.PasswordPolicy.RequireSymbol, "password-require-symbol", false, "Require passwords to contain a symbol")
+	flag.IntVar(&c.PasswordPolicy.MinStrength, "password-min-strength", 2, "Minimum password strength score from 0 (very weak) to 4 (very strong)")
+	flag.StringVar(&c.PasswordPolicy.BlocklistFile, "password-blocklist-file", os.Getenv("PASSWORD_BLOCKLIST_FILE"), "File of additional blocked passwords, one per line")
+	flag.StringVar(&c.PasswordPolicy.BreachFilter, "password-breach-filter", os.Getenv("PASSWORD_BREACH_FILTER"), "Breached password filter file built with cmd/breachfilter")
+	flag.StringVar(&c.PasswordHashing.Algorithm, "password-hash-algorithm", "argon2id", "Algorithm used to hash new passwords - [argon2id, scrypt, bcrypt]")
+	flag.IntVar(&c.PasswordHashing.BcryptCost, "password-bcrypt-cost", 12, "bcrypt cost factor")
+	flag.IntVar(&c.PasswordHashing.Argon2Memory, "password-argon2-memory", 64*1024, "argon2id memory in KiB")
+	flag.IntVar(&c.PasswordHashing.Argon2Iterations, "password-argon2-iterations", 3, "argon2id number of iterations")
+	flag.IntVar(&c.PasswordHashing.Argon2Parallelism, "password-argon2-parallelism", 2, "argon2id degree of parallelism")
+	flag.IntVar(&c.PasswordHashing.ScryptLogN, "password-scrypt-logn", 15, "scrypt CPU/memory cost as a power of two")
+	flag.IntVar(&c.PasswordHashing.ScryptR, "password-scrypt-r", 8, "scrypt block size")
+	flag.IntVar(&c.PasswordHashing.ScryptP, "password-scrypt-p", 1, "scrypt parallelization")
+	flag.StringVar(&c.PasswordHashing.FirebaseSignerKey, "firebase-signer-key", os.Getenv("FIREBASE_SIGNER_KEY"), "base64 signer key of the Firebase project users are imported from")
+	flag.StringVar(&c.PasswordHashing.FirebaseSaltSeparator, "firebase-salt-separator", os.Getenv("FIREBASE_SALT_SEPARATOR"), "base64 salt separator of the Firebase project users are imported from")
+	flag.IntVar(&c.PasswordHashing.FirebaseRounds, "firebase-rounds", 8, "scrypt rounds of the Firebase project users are imported from")
+	flag.IntVar(&c.PasswordHashing.FirebaseMemCost, "firebase-mem-cost", 14, "scrypt memory cost of the Firebase project users are imported from")
+	flag.StringVar(&c.PasswordHashing.Peppers, "password-peppers", os.Getenv("PASSWORD_PEPPERS"), "Comma separated <version>:<secret> password peppers")
+	flag.StringVar(&c.PasswordHashing.PepperFile, "password-pepper-file", os.Getenv("PASSWORD_PEPPER_FILE"), "Path to a file of <version>:<secret> password peppers, one per line")
+	flag.IntVar(&c.Lockout.AccountThreshold, "lockout-account-threshold", 5, "Failed sign ins in a row after which an account is locked, 0 to disable")
+	flag.IntVar(&c.Lockout.IPThreshold, "lockout-ip-threshold", 20, "Failed sign ins in a row after which an IP address is locked, 0 to disable")
+	flag.DurationVar(&c.Lockout.BaseDuration, "lockout-base-duration", time.Minute, "Length of the first lockout, doubled by every further failure")
+	flag.DurationVar(&c.Lockout.MaxDuration, "lockout-max-duration", 24*time.Hour, "Longest an account or IP address can be locked for")
+	flag.DurationVar(&c.Lockout.Window, "lockout-window", 24*time.Hour, "How long a failed sign in is remembered for")
+	flag.StringVar(&c.RateLimit.Store, "rate-limit-store", "memory", "Where rate limit counters are kept - [memory, postgres]")
+	flag.StringVar(&c.RateLimit.Signin, "rate-limit-signin", "20/1m", "Sign in attempts allowed per IP address")
+	flag.StringVar(&c.RateLimit.Register, "rate-limit-register", "10/1h", "Registrations allowed per IP address")
+	flag.StringVar(&c.RateLimit.PasswordReset, "rate-limit-password-reset", "3/1h", "Password reset emails allowed per email address")
+	flag.StringVar(&c.RateLimit.PasswordResetIP, "rate-limit-password-reset-ip", "20/1h", "Password reset requests allowed per IP address")
+	flag.StringVar(&c.RateLimit.ActivationResend, "rate-limit-activation-resend", "3/1h", "Activation emails allowed per email address")
+	flag.StringVar(&c.RateLimit.Export, "rate-limit-export", "10/1h", "Data exports allowed per user")
+	flag.BoolVar(&c.EnumerationSafe.Enabled, "enumeration-safe", true, "Don't reveal through responses or their timing which email addresses are registered")
+	flag.DurationVar(&c.EnumerationSafe.MinResponseTime, "enumeration-safe-response-time", 500*time.Millisecond, "Minimum time to answer requests that could reveal whether an email address is registered")
+	flag.DurationVar(&c.Impersonation.TTL, "impersonation-ttl", 30*time.Minute, "How long an admin can impersonate a user before having to start again")
+	flag.StringVar(&c.Audit.SigningKeyFile, "audit-signing-key-file", os.Getenv("AUDIT_SIGNING_KEY_FILE"), "PEM encoded ed25519 private key audit log checkpoints are signed with")
+	flag.DurationVar(&c.Audit.CheckpointInterval, "audit-checkpoint-interval", 10*time.Minute, "How often the latest audit event is signed")
+	flag.StringVar(&c.Audit.Syslog, "audit-syslog", os.Getenv("AUDIT_SYSLOG"), "Syslog server audit events are sent to - [udp://host:port, tcp://host:port, unix:///path]")
+	flag.StringVar(&c.Audit.SyslogFormat, "audit-syslog-format", "cef", "Format of the audit events sent to syslog - [cef, json]")
+	flag.StringVar(&c.Audit.File, "audit-file", os.Getenv("AUDIT_FILE"), "File audit events are appended to, one per line")
+	flag.StringVar(&c.Audit.FileFormat, "audit-file-format", "json", "Format of the audit events appended to the file - [json, cef]")
+	flag.IntVar(&c.Audit.FileMaxSize, "audit-file-max-size", 100, "Size in MB the audit file is rotated at, 0 to never rotate it")
+	flag.IntVar(&c.Audit.FileMaxBackups, "audit-file-max-backups", 10, "Number of rotated audit files kept")
+	flag.StringVar(&c.GeoIP.Database, "geoip-database", os.Getenv("GEOIP_DATABASE"), "MaxMind city database sign ins are located with")
+	flag.StringVar(&c.TrustedProxies, "trusted-proxies", os.Getenv("TRUSTED_PROXIES"), "Comma separated CIDR ranges of proxies whose client IP header is believed")
+	flag.StringVar(&c.ClientIPHeader, "client-ip-header", "x-forwarded-for", "Header the trusted proxies record the client's address in - [forwarded, x-forwarded-for, x-real-ip]")
+	flag.IntVar(&c.Risk.Threshold, "risk-threshold", 50, "Risk score at which a sign in has to be confirmed by email, 0 to disable")
+	flag.IntVar(&c.Risk.NewCountryScore, "risk-new-country-score", 40, "Risk score of a sign in from a country the user hasn't signed in from before")
+	flag.IntVar(&c.Risk.ImpossibleTravelScore, "risk-impossible-travel-score", 60, "Risk score of a sign in too far from the last one to have travelled in time")
+	flag.Float64Var(&c.Risk.ImpossibleTravelSpeed, "risk-impossible-travel-speed", 1000, "Fastest speed in km/h a user is assumed to travel between sign ins")
+	flag.StringVar(&c.Risk.IPList, "risk-ip-list", os.Getenv("RISK_IP_LIST"), "File of risky IP addresses and CIDR ranges, e.g. Tor exit nodes, one per line")
+	flag.IntVar(&c.Risk.IPListScore, "risk-ip-list-score", 60, "Risk score of a sign in from an address on the risk IP list")
+	flag.IntVar(&c.Risk.UnusualHourScore, "risk-unusual-hour-score", 20, "Risk score of a sign in at an hour of the day the user doesn't usually sign in at")
 	flag.Parse()
 
 	return c
@@ -20,7 +20,15 @@ func SetupUserTable(db *sqlx.DB) {
 		last_name text NOT NULL,
 		email citext UNIQUE NOT NULL,
 		password bytea NOT NULL,
-		activated bool NOT NULL
+		status text NOT NULL DEFAULT 'pending',
+		status_reason text NOT NULL DEFAULT '',
+		status_changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+		password_pepper_version integer NOT NULL DEFAULT 0,
+		failed_login_attempts integer NOT NULL DEFAULT 0,
+		last_failed_login_at timestamp(0) with time zone,
+		locked_until timestamp(0) with time zone,
+		password_reset_required bool NOT NULL DEFAULT false,
+		sessions_revoked_at timestamp with time zone
 	);`
 	// log.Println("**** Creating User Table ****")
 	db.MustExec(schema)
@@ -37,6 +45,118 @@ func TeardownUserTable(db *sqlx.DB, t *testing.T) {
 
 }
 
+// SetupLoginTables creates the tables sign ins depend on besides users, which
+// must be set up first.
+func SetupLoginTables(db *sqlx.DB) {
+	var schema = `
+	CREATE TABLE IF NOT EXISTS tokens (
+		hash bytea PRIMARY KEY,
+		user_id text REFERENCES users ON DELETE CASCADE,
+		expiry timestamp(0) with time zone NOT NULL,
+		scope text NOT NULL,
+		invitation_id bigint
+	);
+
+	CREATE TABLE IF NOT EXISTS ip_login_failures (
+		ip text NOT NULL PRIMARY KEY,
+		failures integer NOT NULL DEFAULT 0,
+		last_failed_at timestamp(0) with time zone NOT NULL,
+		locked_until timestamp(0) with time zone
+	);
+
+	CREATE TABLE IF NOT EXISTS login_events (
+		id bigserial PRIMARY KEY,
+		user_id text REFERENCES users ON DELETE CASCADE,
+		email citext NOT NULL,
+		succeeded boolean NOT NULL,
+		failure_reason text NOT NULL DEFAULT '',
+		ip text NOT NULL,
+		user_agent text NOT NULL,
+		browser text NOT NULL,
+		os text NOT NULL,
+		city text NOT NULL DEFAULT '',
+		country text NOT NULL DEFAULT '',
+		country_code text NOT NULL DEFAULT '',
+		latitude double precision,
+		longitude double precision,
+		occurred_at timestamp with time zone NOT NULL DEFAULT NOW()
+	);`
+	db.MustExec(schema)
+}
+
+// TeardownLoginTables removes the tables created by SetupLoginTables. It has to
+// be called before TeardownUserTable.
+func TeardownLoginTables(db *sqlx.DB, t *testing.T) {
+	_, err := db.Exec(`DROP TABLE IF EXISTS tokens, ip_login_failures, login_events`)
+	if err != nil {
+		t.Error("Failed to clear login tables")
+	}
+}
+
+// SetupOrganizationTables creates the tables organizations and invitations are
+// stored in. The users table and SetupLoginTables must be set up first.
+func SetupOrganizationTables(db *sqlx.DB) {
+	var schema = `
+	CREATE TABLE IF NOT EXISTS organizations (
+		id text NOT NULL PRIMARY KEY,
+		name text NOT NULL,
+		slug citext UNIQUE NOT NULL,
+		created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS memberships (
+		organization_id text NOT NULL REFERENCES organizations ON DELETE CASCADE,
+		user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+		role text NOT NULL,
+		created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (organization_id, user_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS invitations (
+		id bigserial PRIMARY KEY,
+		organization_id text NOT NULL REFERENCES organizations ON DELETE CASCADE,
+		email citext NOT NULL,
+		role text NOT NULL,
+		invited_by text REFERENCES users ON DELETE SET NULL,
+		created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+		expiry timestamp(0) with time zone NOT NULL,
+		UNIQUE (organization_id, email)
+	);`
+	db.MustExec(schema)
+}
+
+// TeardownOrganizationTables removes the tables created by SetupOrganizationTables.
+// It has to be called before TeardownLoginTables and TeardownUserTable.
+func TeardownOrganizationTables(db *sqlx.DB, t *testing.T) {
+	_, err := db.Exec(`DROP TABLE IF EXISTS invitations, memberships, organizations`)
+	if err != nil {
+		t.Error("Failed to clear organization tables")
+	}
+}
+
+// SetupDataExportTable creates the table data exports are stored in. The users
+// table must be set up first.
+func SetupDataExportTable(db *sqlx.DB) {
+	var schema = `
+	CREATE TABLE IF NOT EXISTS data_exports (
+		id text NOT NULL PRIMARY KEY,
+		user_id text NOT NULL REFERENCES users ON DELETE CASCADE,
+		created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+		expiry timestamp(0) with time zone NOT NULL,
+		archive bytea NOT NULL
+	);`
+	db.MustExec(schema)
+}
+
+// TeardownDataExportTable removes the table created by SetupDataExportTable. It
+// has to be called before TeardownUserTable.
+func TeardownDataExportTable(db *sqlx.DB, t *testing.T) {
+	_, err := db.Exec(`DROP TABLE IF EXISTS data_exports`)
+	if err != nil {
+		t.Error("Failed to clear data export table")
+	}
+}
+
 func MakeRandEmail() string {
 	b := make([]byte, 10)
 	charset := "abcdefghijklmnopqrstuvwxyz" +